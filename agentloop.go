@@ -0,0 +1,217 @@
+// agentloop.go
+//
+// things for limiting recursive generations on tool calls (agent loop)
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+const (
+	defaultMaxToolRounds = 10 // NOTE: 0 = unlimited
+)
+
+var errAgentLoopStopped = errors.New("agent loop stopped")
+
+// statuses of tool calls in agent loop
+const (
+	toolCallStatusCalled    = `called`
+	toolCallStatusFailed    = `failed`
+	toolCallStatusSkipped   = `skipped`
+	toolCallStatusNotCalled = `not called`
+	toolCallStatusUnhandled = `unhandled`
+)
+
+// limits of agent loop (0 = unlimited)
+type agentLoopLimits struct {
+	MaxRounds       int
+	MaxToolCalls    int
+	MaxCallsPerTool int
+	RoundTimeout    time.Duration
+}
+
+// a tool call in agent loop
+type agentLoopCall struct {
+	round  int
+	fn     string
+	status string
+}
+
+// agent loop state which is kept between recursive generations
+type agentLoop struct {
+	limits agentLoopLimits
+
+	rounds       int
+	calls        []agentLoopCall
+	callsPerTool map[string]int
+
+	stopReason string
+}
+
+// newAgentLoop returns a new agent loop with given limits.
+func newAgentLoop(limits agentLoopLimits) *agentLoop {
+	return &agentLoop{
+		limits:       limits,
+		callsPerTool: map[string]int{},
+	}
+}
+
+// agentLoopLimitsFrom returns limits of agent loop from params and config.
+//
+// (params take precedence over config)
+func agentLoopLimitsFrom(conf config, p params) agentLoopLimits {
+	limits := agentLoopLimits{
+		MaxRounds:       defaultMaxToolRounds,
+		MaxToolCalls:    conf.MaxToolCalls,
+		MaxCallsPerTool: conf.MaxCallsPerTool,
+		RoundTimeout:    time.Duration(conf.ToolRoundTimeoutSeconds) * time.Second,
+	}
+	if conf.MaxToolRounds != nil {
+		limits.MaxRounds = *conf.MaxToolRounds
+	}
+
+	if p.Tools.MaxToolRounds != nil {
+		limits.MaxRounds = *p.Tools.MaxToolRounds
+	}
+	if p.Tools.MaxToolCalls != nil {
+		limits.MaxToolCalls = *p.Tools.MaxToolCalls
+	}
+	if p.Tools.MaxCallsPerTool != nil {
+		limits.MaxCallsPerTool = *p.Tools.MaxCallsPerTool
+	}
+	if p.Tools.ToolRoundTimeoutSeconds != nil {
+		limits.RoundTimeout = time.Duration(*p.Tools.ToolRoundTimeoutSeconds) * time.Second
+	}
+
+	return limits
+}
+
+// allowCall checks if a tool with given name can be called.
+//
+// If not, the loop will be stopped.
+//
+// NOTE: it doesn't count the call, as it may not be run (eg. declined by the user), so call `countCall` when it is run.
+func (l *agentLoop) allowCall(name string) bool {
+	if l.stopped() {
+		return false
+	}
+
+	if l.limits.MaxToolCalls > 0 && l.numCalled() >= l.limits.MaxToolCalls {
+		l.stop(fmt.Sprintf("reached the maximum number of tool calls (%d)", l.limits.MaxToolCalls))
+		return false
+	}
+	if l.limits.MaxCallsPerTool > 0 && l.callsPerTool[name] >= l.limits.MaxCallsPerTool {
+		l.stop(fmt.Sprintf("reached the maximum number of calls for tool '%s' (%d)", name, l.limits.MaxCallsPerTool))
+		return false
+	}
+
+	return true
+}
+
+// countCall counts a call of tool with given name.
+func (l *agentLoop) countCall(name string) {
+	l.callsPerTool[name]++
+}
+
+// allowRound checks if another round of generation on tool results is allowed, and counts it if so.
+//
+// If not, the loop will be stopped.
+func (l *agentLoop) allowRound() bool {
+	if l.stopped() {
+		return false
+	}
+
+	if l.limits.MaxRounds > 0 && l.rounds >= l.limits.MaxRounds {
+		l.stop(fmt.Sprintf("reached the maximum number of tool rounds (%d)", l.limits.MaxRounds))
+		return false
+	}
+
+	l.rounds++
+
+	return true
+}
+
+// record records a tool call in the current round.
+func (l *agentLoop) record(fn, status string) {
+	l.calls = append(l.calls, agentLoopCall{
+		round:  l.rounds,
+		fn:     fn,
+		status: status,
+	})
+}
+
+// numCalled returns the number of tools calls which were counted.
+func (l *agentLoop) numCalled() (num int) {
+	for _, n := range l.callsPerTool {
+		num += n
+	}
+	return num
+}
+
+// stop stops the loop with given reason (the first reason is kept).
+func (l *agentLoop) stop(reason string) {
+	if !l.stopped() {
+		l.stopReason = reason
+	}
+}
+
+// stopped checks if the loop was stopped.
+func (l *agentLoop) stopped() bool {
+	return len(l.stopReason) > 0
+}
+
+// err returns an error for the stopped loop.
+func (l *agentLoop) err() error {
+	return fmt.Errorf("%w: %s", errAgentLoopStopped, l.stopReason)
+}
+
+// printSummary prints the summary of tool calls and the reason of stop.
+func (l *agentLoop) printSummary(output *outputWriter) {
+	output.makeSureToEndWithNewLine()
+
+	output.errorColored(
+		color.FgHiYellow,
+		"Agent loop stopped: %s\n",
+		l.stopReason,
+	)
+	output.errorColored(
+		color.FgYellow,
+		"  rounds: %d, tool calls: %d (limits: rounds=%s, calls=%s, calls per tool=%s, round timeout=%s)\n",
+		l.rounds,
+		l.numCalled(),
+		limitToString(l.limits.MaxRounds),
+		limitToString(l.limits.MaxToolCalls),
+		limitToString(l.limits.MaxCallsPerTool),
+		durationLimitToString(l.limits.RoundTimeout),
+	)
+	for _, call := range l.calls {
+		output.errorColored(
+			color.FgYellow,
+			"  [round %d] %s: %s\n",
+			call.round,
+			call.status,
+			call.fn,
+		)
+	}
+}
+
+// limitToString converts given limit to a string.
+func limitToString(limit int) string {
+	if limit <= 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%d", limit)
+}
+
+// durationLimitToString converts given duration limit to a string.
+func durationLimitToString(limit time.Duration) string {
+	if limit <= 0 {
+		return "unlimited"
+	}
+	return limit.String()
+}
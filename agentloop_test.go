@@ -0,0 +1,88 @@
+// agentloop_test.go
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// callTool checks if a tool with given name can be called, and counts it if so (as it is run).
+func callTool(loop *agentLoop, name string) bool {
+	if !loop.allowCall(name) {
+		return false
+	}
+	loop.countCall(name)
+	return true
+}
+
+// test `agentLoop` for stopping at the limits
+func TestAgentLoopLimits(t *testing.T) {
+	loop := newAgentLoop(agentLoopLimits{
+		MaxRounds:       2,
+		MaxToolCalls:    3,
+		MaxCallsPerTool: 2,
+	})
+
+	if !callTool(loop, "a") || !callTool(loop, "a") {
+		t.Errorf("expected first two calls of 'a' to be allowed")
+	}
+	if callTool(loop, "a") {
+		t.Errorf("expected the third call of 'a' not to be allowed")
+	}
+	if !loop.stopped() || !strings.Contains(loop.stopReason, "'a'") {
+		t.Errorf("expected loop to be stopped by the limit of 'a', got '%s'", loop.stopReason)
+	}
+	if callTool(loop, "b") {
+		t.Errorf("expected no more calls after the loop was stopped")
+	}
+
+	loop = newAgentLoop(agentLoopLimits{
+		MaxRounds:    2,
+		MaxToolCalls: 3,
+	})
+	for _, name := range []string{"a", "b", "c"} {
+		if !callTool(loop, name) {
+			t.Errorf("expected call of '%s' to be allowed", name)
+		}
+	}
+	if callTool(loop, "d") {
+		t.Errorf("expected the fourth call not to be allowed")
+	}
+
+	// calls which were allowed but not run (eg. declined by the user) are not counted
+	loop = newAgentLoop(agentLoopLimits{
+		MaxToolCalls:    1,
+		MaxCallsPerTool: 1,
+	})
+	for range 3 {
+		if !loop.allowCall("a") {
+			t.Errorf("expected calls which were not run not to be counted")
+		}
+	}
+	if !callTool(loop, "a") || loop.numCalled() != 1 {
+		t.Errorf("expected only the run call to be counted, got %d", loop.numCalled())
+	}
+	if callTool(loop, "b") {
+		t.Errorf("expected no more calls after reaching the limit")
+	}
+
+	loop = newAgentLoop(agentLoopLimits{
+		MaxRounds: 2,
+	})
+	if !loop.allowRound() || !loop.allowRound() {
+		t.Errorf("expected first two rounds to be allowed")
+	}
+	if loop.allowRound() || !loop.stopped() {
+		t.Errorf("expected the third round not to be allowed")
+	}
+
+	// unlimited
+	loop = newAgentLoop(agentLoopLimits{})
+	for range 100 {
+		if !callTool(loop, "a") || !loop.allowRound() {
+			t.Errorf("expected no limits")
+			break
+		}
+	}
+}
@@ -0,0 +1,557 @@
+// archives.go
+//
+// things for treating archives (zip, tar, tar.gz) as virtual directories of files
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/fatih/color"
+)
+
+const (
+	// suffix of archives as virtual directories (eg. 'logs.zip!/app/error.log')
+	archivePathSuffix    = "!"
+	archivePathSeparator = archivePathSuffix + "/"
+
+	// max size of each entry in an archive (larger ones will be ignored)
+	maxArchiveEntryBytes = 64 * 1024 * 1024
+)
+
+// extensions of supported archives
+var _archiveExtensions = []string{
+	".zip",
+	".tar",
+	".tar.gz",
+	".tgz",
+}
+
+// a file entry in an archive
+type archiveEntry struct {
+	name string // slash-separated path in the archive
+	info os.FileInfo
+	data []byte // loaded only for ignore files
+}
+
+// listed file entries of an archive (indexed by their names)
+type archiveIndex struct {
+	entries []archiveEntry
+	byName  map[string]int
+}
+
+// listed archives (key: absolute path of archive)
+//
+// NOTE: it should be created for each expansion of filepaths, so that changed archives are listed again
+type archiveIndexes map[string]*archiveIndex
+
+// isArchivePath checks if given path is a supported archive (by its extension).
+func isArchivePath(fpath string) bool {
+	lowered := strings.ToLower(fpath)
+	return slices.ContainsFunc(_archiveExtensions, func(ext string) bool {
+		return strings.HasSuffix(lowered, ext)
+	})
+}
+
+// splitArchivePath splits given path of an entry in an archive (eg. 'logs.zip!/app/error.log')
+// to the path of archive and the entry's path in it.
+func splitArchivePath(fpath string) (archive, entry string, ok bool) {
+	for i := 0; ; {
+		index := strings.Index(fpath[i:], archivePathSeparator)
+		if index < 0 {
+			return "", "", false
+		}
+		i += index
+
+		if isArchivePath(fpath[:i]) {
+			return fpath[:i], fpath[i+len(archivePathSeparator):], true
+		}
+		i += len(archivePathSeparator)
+	}
+}
+
+// archiveEntryPath returns the path of given entry in an archive (eg. 'logs.zip!/app/error.log').
+func archiveEntryPath(archive, entry string) string {
+	return archive + archivePathSeparator + entry
+}
+
+// fileNameForPrompt returns the name of given file for prompts
+// (eg. 'error.log', or 'logs.zip!/app/error.log' for an entry in an archive).
+func fileNameForPrompt(fpath string) string {
+	if archive, entry, ok := splitArchivePath(fpath); ok {
+		return archiveEntryPath(filepath.Base(archive), entry)
+	}
+	return filepath.Base(fpath)
+}
+
+// listArchive lists file entries of given archive (listed archives are reused).
+//
+// Only headers of entries are read, except for ignore files.
+func (indexes archiveIndexes) listArchive(archive string) (index *archiveIndex, err error) {
+	key, err := filepath.Abs(archive)
+	if err != nil {
+		return nil, err
+	}
+	if listed, exists := indexes[key]; exists {
+		return listed, nil
+	}
+
+	r, err := openArchive(archive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive '%s': %w", archive, err)
+	}
+	defer func() { _ = r.Close() }()
+
+	index = &archiveIndex{
+		byName: map[string]int{},
+	}
+	for {
+		entry, open, err := r.next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read archive '%s': %w", archive, err)
+		}
+
+		// (ignore files are needed for filtering entries)
+		if slices.Contains(_ignoreFilenames, path.Base(entry.name)) && entry.info.Size() <= maxArchiveEntryBytes {
+			if entry.data, err = readAllAndClose(open()); err != nil {
+				return nil, fmt.Errorf("failed to read '%s' in archive '%s': %w", entry.name, archive, err)
+			}
+		}
+
+		if _, exists := index.byName[entry.name]; !exists { // NOTE: the first one wins on duplicated names
+			index.byName[entry.name] = len(index.entries)
+		}
+		index.entries = append(index.entries, entry)
+	}
+	indexes[key] = index
+
+	return index, nil
+}
+
+// readAllAndClose reads all bytes from given reader, and closes it.
+func readAllAndClose(rc io.ReadCloser, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rc.Close() }()
+
+	return io.ReadAll(io.LimitReader(rc, maxArchiveEntryBytes))
+}
+
+// cleanArchiveEntryName cleans given name of an entry in an archive.
+//
+// Returns false if it is not a safe relative path (eg. '../../etc/passwd').
+func cleanArchiveEntryName(name string) (string, bool) {
+	name = path.Clean(strings.TrimPrefix(filepath.ToSlash(name), "/"))
+	if name == "." || name == ".." || strings.HasPrefix(name, "../") {
+		return "", false
+	}
+	return name, true
+}
+
+// archiveReader iterates file entries of a zip, tar, or gzipped tar archive.
+type archiveReader struct {
+	closers []io.Closer
+
+	zipped  *zip.Reader
+	zipNext int
+
+	tarred *tar.Reader
+}
+
+// openArchive opens given archive for iterating its file entries.
+func openArchive(archive string) (r *archiveReader, err error) {
+	r = &archiveReader{}
+
+	lowered := strings.ToLower(archive)
+	if strings.HasSuffix(lowered, ".zip") {
+		zr, err := zip.OpenReader(archive)
+		if err != nil {
+			return nil, err
+		}
+		r.closers = append(r.closers, zr)
+		r.zipped = &zr.Reader
+
+		return r, nil
+	}
+
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	r.closers = append(r.closers, f)
+
+	var tr io.Reader = f
+	if !strings.HasSuffix(lowered, ".tar") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			_ = r.Close()
+			return nil, err
+		}
+		r.closers = append(r.closers, gz)
+		tr = gz
+	}
+	r.tarred = tar.NewReader(tr)
+
+	return r, nil
+}
+
+// next returns the next file entry (skipping directories, links, and entries with unsafe names),
+// and a function for opening its data.
+//
+// Returns `io.EOF` at the end of archive.
+//
+// NOTE: data of an entry in a tar archive can be read only until `next` is called again.
+func (r *archiveReader) next() (entry archiveEntry, open func() (io.ReadCloser, error), err error) {
+	if r.zipped != nil {
+		for r.zipNext < len(r.zipped.File) {
+			f := r.zipped.File[r.zipNext]
+			r.zipNext++
+
+			info := f.FileInfo()
+			if !info.Mode().IsRegular() {
+				continue
+			}
+			name, ok := cleanArchiveEntryName(f.Name)
+			if !ok {
+				continue
+			}
+
+			return archiveEntry{
+				name: name,
+				info: info,
+			}, f.Open, nil
+		}
+		return entry, nil, io.EOF
+	}
+
+	for {
+		header, err := r.tarred.Next()
+		if err != nil {
+			return entry, nil, err
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name, ok := cleanArchiveEntryName(header.Name)
+		if !ok {
+			continue
+		}
+
+		return archiveEntry{
+			name: name,
+			info: header.FileInfo(),
+		}, func() (io.ReadCloser, error) {
+			return io.NopCloser(r.tarred), nil
+		}, nil
+	}
+}
+
+// Close closes the archive.
+func (r *archiveReader) Close() error {
+	var errs []error
+	for _, c := range slices.Backward(r.closers) {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// an opened entry in an archive (closes the archive too on close)
+type archiveEntryReader struct {
+	io.Reader
+
+	entry   io.Closer
+	archive io.Closer
+}
+
+// Close closes the entry and its archive.
+func (r *archiveEntryReader) Close() error {
+	return errors.Join(r.entry.Close(), r.archive.Close())
+}
+
+// openArchiveEntry opens an entry in given archive, and returns its size.
+//
+// NOTE: entries are read directly from the archive (without being cached), so that changed archives are not read stale.
+// Entries in tar archives are found by scanning from the start of archive, so many of them should be read with `readTarEntries`.
+func openArchiveEntry(archive, entry string) (rc io.ReadCloser, size int64, err error) {
+	r, err := openArchive(archive)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read archive '%s': %w", archive, err)
+	}
+
+	for {
+		e, open, err := r.next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			_ = r.Close()
+			return nil, 0, fmt.Errorf("failed to read archive '%s': %w", archive, err)
+		}
+		if e.name != entry {
+			continue
+		}
+
+		if e.info.Size() > maxArchiveEntryBytes {
+			_ = r.Close()
+			return nil, 0, fmt.Errorf("'%s' in archive '%s' is too large (%s)", entry, archive, humanize.Bytes(uint64(e.info.Size())))
+		}
+		opened, err := open()
+		if err != nil {
+			_ = r.Close()
+			return nil, 0, fmt.Errorf("failed to open '%s' in archive '%s': %w", entry, archive, err)
+		}
+		return &archiveEntryReader{
+			Reader:  io.LimitReader(opened, maxArchiveEntryBytes),
+			entry:   opened,
+			archive: r,
+		}, e.info.Size(), nil
+	}
+	_ = r.Close()
+
+	return nil, 0, fmt.Errorf("'%s' not found in archive '%s'", entry, archive)
+}
+
+// data of entries in tar archives (key: path of entry, eg. 'src.tar.gz!/main.go')
+type tarEntries map[string][]byte
+
+// readTarEntries reads entries of tar archives in given paths with one sequential pass over each archive
+// (up to `limit` bytes of each entry, 0 = up to `maxArchiveEntryBytes`).
+//
+// Entries in zip archives (which can be opened randomly), too large or non-existing entries are not included,
+// so they should be read with `openFile` as usual.
+func readTarEntries(filepaths []*string, limit int64) (entries tarEntries, err error) {
+	if limit <= 0 || limit > maxArchiveEntryBytes {
+		limit = maxArchiveEntryBytes
+	}
+
+	// group entries by their archives
+	selected := map[string]map[string]bool{}
+	for _, fp := range filepaths {
+		if fp == nil {
+			continue
+		}
+		archive, entry, ok := splitArchivePath(*fp)
+		if !ok || strings.HasSuffix(strings.ToLower(archive), ".zip") {
+			continue
+		}
+		if _, exists := selected[archive]; !exists {
+			selected[archive] = map[string]bool{}
+		}
+		selected[archive][entry] = true
+	}
+
+	entries = tarEntries{}
+	for _, archive := range slices.Sorted(maps.Keys(selected)) {
+		if err := readSelectedTarEntries(archive, selected[archive], limit, entries); err != nil {
+			return nil, err
+		}
+	}
+
+	return entries, nil
+}
+
+// readSelectedTarEntries reads selected entries of given tar archive into `entries`.
+func readSelectedTarEntries(archive string, selected map[string]bool, limit int64, entries tarEntries) error {
+	r, err := openArchive(archive)
+	if err != nil {
+		return fmt.Errorf("failed to read archive '%s': %w", archive, err)
+	}
+	defer func() { _ = r.Close() }()
+
+	for remaining := len(selected); remaining > 0; {
+		e, open, err := r.next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("failed to read archive '%s': %w", archive, err)
+		}
+		if !selected[e.name] { // NOTE: the first one wins on duplicated names
+			continue
+		}
+		selected[e.name] = false
+		remaining--
+
+		if e.info.Size() > maxArchiveEntryBytes {
+			continue
+		}
+		opened, err := open()
+		if err != nil {
+			return fmt.Errorf("failed to open '%s' in archive '%s': %w", e.name, archive, err)
+		}
+		data, err := io.ReadAll(io.LimitReader(opened, limit))
+		_ = opened.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read '%s' in archive '%s': %w", e.name, archive, err)
+		}
+		entries[archiveEntryPath(archive, e.name)] = data
+	}
+
+	return nil
+}
+
+// openFile opens given file, or an entry in an archive (eg. 'logs.zip!/app/error.log'), and returns its size.
+func openFile(fpath string) (r io.ReadCloser, size int64, err error) {
+	if archive, entry, ok := splitArchivePath(fpath); ok {
+		return openArchiveEntry(archive, entry)
+	}
+
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, 0, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, 0, err
+	}
+	return f, stat.Size(), nil
+}
+
+// readFile reads all bytes of given file, or an entry in an archive (eg. 'logs.zip!/app/error.log').
+func readFile(fpath string) ([]byte, error) {
+	r, _, err := openFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = r.Close() }()
+
+	return io.ReadAll(r)
+}
+
+// filesInArchive returns paths of all file entries (eg. 'logs.zip!/app/error.log') in the given archive.
+//
+// Ignore files in the archive, and include/exclude globs of given filter are applied to the entries.
+// Entries exceeding `maxTotalBytes` (total uncompressed size, 0 = unlimited) are ignored.
+func filesInArchive(
+	output *outputWriter,
+	archives archiveIndexes,
+	archive string,
+	filter *fileFilter,
+	maxTotalBytes int64,
+	vbs []bool,
+) (files []*string, err error) {
+	index, err := archives.listArchive(archive)
+	if err != nil {
+		return nil, err
+	}
+	if filter, err = filter.forArchive(archive); err != nil {
+		return nil, err
+	}
+
+	// load ignore files first (they can be anywhere in the archive)
+	for _, name := range _ignoreFilenames {
+		for _, entry := range index.entries {
+			if path.Base(entry.name) == name && entry.data != nil {
+				dir := filepath.Join(filter.root, filepath.FromSlash(path.Dir(entry.name)))
+				if err := filter.addIgnoreFile(dir, bytes.NewReader(entry.data), archiveEntryPath(archive, entry.name)); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	// (total uncompressed size of attached entries)
+	var total int64
+
+	ignoredDirs := map[string]bool{}
+	for i, entry := range index.entries {
+		if index.byName[entry.name] != i { // (skip duplicated names)
+			continue
+		}
+		fpath := archiveEntryPath(archive, entry.name)
+
+		// check ancestor directories
+		ignored := false
+		if parent := path.Dir(entry.name); parent != "." {
+			dir := ""
+			for name := range strings.SplitSeq(parent, "/") {
+				dir = path.Join(dir, name)
+
+				if _, checked := ignoredDirs[dir]; !checked {
+					dirpath := archiveEntryPath(archive, dir)
+					if ignoredDirectory(output, dirpath) {
+						ignoredDirs[dir] = true
+					} else if ignoredByFilter, reason := filter.ignored(filepath.Join(filter.root, filepath.FromSlash(dir)), true); ignoredByFilter {
+						output.verbose(
+							verboseMedium,
+							vbs,
+							"ignoring directory '%s' (by %s)",
+							dirpath,
+							reason,
+						)
+						ignoredDirs[dir] = true
+					} else {
+						ignoredDirs[dir] = false
+					}
+				}
+				if ignored = ignoredDirs[dir]; ignored {
+					break
+				}
+			}
+		}
+		if ignored {
+			continue
+		}
+
+		// check the file
+		if ignored, reason := filter.ignored(filepath.Join(filter.root, filepath.FromSlash(entry.name)), false); ignored {
+			output.verbose(
+				verboseMedium,
+				vbs,
+				"ignoring file '%s' (by %s)",
+				fpath,
+				reason,
+			)
+			continue
+		}
+		if ignoredFile(output, fpath, entry.info) {
+			continue
+		}
+		if entry.info.Size() > maxArchiveEntryBytes {
+			output.printColored(
+				color.FgHiYellow,
+				"Ignoring too large file: %s (%s)\n",
+				fpath,
+				humanize.Bytes(uint64(entry.info.Size())),
+			)
+			continue
+		}
+		if maxTotalBytes > 0 && total >= maxTotalBytes {
+			output.printColored(
+				color.FgHiYellow,
+				"Ignoring file: %s; total size of files in archive exceeds the limit (%s)\n",
+				fpath,
+				humanize.Bytes(uint64(maxTotalBytes)),
+			)
+			continue
+		}
+		total += entry.info.Size()
+
+		output.verbose(
+			verboseMedium,
+			vbs,
+			"attaching file '%s'",
+			fpath,
+		)
+
+		files = append(files, &fpath)
+	}
+
+	return files, nil
+}
@@ -0,0 +1,150 @@
+// archives_test.go
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// test `splitArchivePath` and `fileNameForPrompt`
+func TestSplitArchivePath(t *testing.T) {
+	if archive, entry, ok := splitArchivePath("/tmp/logs.zip!/app/error.log"); !ok || archive != "/tmp/logs.zip" || entry != "app/error.log" {
+		t.Errorf("unexpected split: '%s', '%s', %v", archive, entry, ok)
+	}
+	if archive, entry, ok := splitArchivePath("/tmp/wow!/src.tar.gz!/a!/b.go"); !ok || archive != "/tmp/wow!/src.tar.gz" || entry != "a!/b.go" {
+		t.Errorf("unexpected split: '%s', '%s', %v", archive, entry, ok)
+	}
+	if _, _, ok := splitArchivePath("/tmp/logs.zip"); ok {
+		t.Errorf("expected an archive itself not to be split")
+	}
+
+	if name := fileNameForPrompt("/tmp/logs.zip!/app/error.log"); name != "logs.zip!/app/error.log" {
+		t.Errorf("unexpected file name: '%s'", name)
+	}
+	if name := fileNameForPrompt("/tmp/app/error.log"); name != "error.log" {
+		t.Errorf("unexpected file name: '%s'", name)
+	}
+}
+
+// test `filesInArchive` and `readFile` for zip and tar.gz archives
+func TestFilesInArchive(t *testing.T) {
+	entries := [][2]string{
+		{".gitignore", "*.log\n!keep.log\n"},
+		{"src/.ollignore", "generated/\n"},
+		{"src/main.go", "package main\n"},
+		{"src/main_test.go", "package main\n"},
+		{"src/generated/gen.go", "package generated\n"},
+		{"debug.log", "log\n"},
+		{"keep.log", "log\n"},
+		{"docs/README.md", "readme\n"},
+		{"node_modules/x/index.js", "x\n"},
+		{"empty.txt", ""},
+		{"../escaped.txt", "escaped\n"},
+	}
+
+	dir := t.TempDir()
+
+	// zip
+	var zipped bytes.Buffer
+	zw := zip.NewWriter(&zipped)
+	for _, entry := range entries {
+		w, _ := zw.Create(entry[0])
+		_, _ = w.Write([]byte(entry[1]))
+	}
+	_ = zw.Close()
+	zipPath := filepath.Join(dir, "project.zip")
+	if err := os.WriteFile(zipPath, zipped.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// tar.gz
+	var tarred bytes.Buffer
+	gw := gzip.NewWriter(&tarred)
+	tw := tar.NewWriter(gw)
+	for _, entry := range entries {
+		_ = tw.WriteHeader(&tar.Header{Name: "./" + entry[0], Mode: 0o644, Size: int64(len(entry[1])), Typeflag: tar.TypeReg})
+		_, _ = tw.Write([]byte(entry[1]))
+	}
+	_ = tw.Close()
+	_ = gw.Close()
+	tarPath := filepath.Join(dir, "project.tar.gz")
+	if err := os.WriteFile(tarPath, tarred.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, archive := range []string{zipPath, tarPath} {
+		filter, err := newGlobFileFilter(dir, nil, []string{"docs/", "*_test.go"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		files, err := filesInArchive(newOutputWriter(), archiveIndexes{}, archive, filter, 0, nil)
+		if err != nil {
+			t.Fatalf("failed to list files in '%s': %s", archive, err)
+		}
+
+		paths := []string{}
+		for _, f := range files {
+			paths = append(paths, *f)
+		}
+		slices.Sort(paths)
+
+		expected := []string{
+			archiveEntryPath(archive, ".gitignore"),
+			archiveEntryPath(archive, "keep.log"),
+			archiveEntryPath(archive, "src/main.go"),
+		}
+		if !slices.Equal(paths, expected) {
+			t.Errorf("expected %v, got %v", expected, paths)
+		}
+
+		if data, err := readFile(archiveEntryPath(archive, "src/main.go")); err != nil || string(data) != "package main\n" {
+			t.Errorf("unexpected data of entry: '%s' (err: %v)", string(data), err)
+		}
+		if _, err := readFile(archiveEntryPath(archive, "not/exist.go")); err == nil {
+			t.Errorf("expected an error for a non-existing entry")
+		}
+
+		// entries in tar archives are read at once (up to the limit), and the others are not
+		entries, err := readTarEntries([]*string{
+			ptr(archiveEntryPath(archive, "src/main.go")),
+			ptr(archiveEntryPath(archive, "keep.log")),
+			ptr(archiveEntryPath(archive, "not/exist.go")),
+			ptr(filepath.Join(dir, "not-archive.txt")),
+		}, 4)
+		if err != nil {
+			t.Errorf("failed to read entries of '%s': %s", archive, err)
+		} else if archive == zipPath && len(entries) != 0 {
+			t.Errorf("expected no entries of zip archive, got %d", len(entries))
+		} else if archive == tarPath && (len(entries) != 2 ||
+			string(entries[archiveEntryPath(archive, "src/main.go")]) != "pack" ||
+			string(entries[archiveEntryPath(archive, "keep.log")]) != "log\n") {
+			t.Errorf("unexpected entries of tar archive: %q", entries)
+		}
+
+		// total size of entries is limited (the one exceeding the limit is still listed, for the file limit policy)
+		if files, err := filesInArchive(newOutputWriter(), archiveIndexes{}, archive, filter, 1, nil); err != nil || len(files) != 1 || *files[0] != archiveEntryPath(archive, ".gitignore") {
+			t.Errorf("expected only the first entry within the total limit, got %d file(s) (err: %v)", len(files), err)
+		}
+	}
+
+	// changed archives should not be read stale
+	var changed bytes.Buffer
+	zw = zip.NewWriter(&changed)
+	w, _ := zw.Create("src/main.go")
+	_, _ = w.Write([]byte("package changed\n"))
+	_ = zw.Close()
+	if err := os.WriteFile(zipPath, changed.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := readFile(archiveEntryPath(zipPath, "src/main.go")); err != nil || string(data) != "package changed\n" {
+		t.Errorf("expected the changed data of entry, got '%s' (err: %v)", string(data), err)
+	}
+}
@@ -0,0 +1,507 @@
+// batch.go
+//
+// things for batch processing of prompts from a JSONL file
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/ollama/ollama/api"
+)
+
+const (
+	defaultBatchConcurrency    = 1
+	batchResultsFilenameSuffix = ".results.jsonl"
+	batchMaxLineBytes          = 16 * 1024 * 1024
+)
+
+// a request in batch file (a line of JSONL)
+type batchRequest struct {
+	ID         string          `json:"id,omitempty"` // NOTE: line number will be used if omitted
+	Prompt     string          `json:"prompt"`
+	Model      *string         `json:"model,omitempty"`
+	System     *string         `json:"system,omitempty"`
+	Files      []string        `json:"files,omitempty"`
+	Options    map[string]any  `json:"options,omitempty"`
+	JSONSchema json.RawMessage `json:"json_schema,omitempty"` // JSON object, or a string of it
+
+	line int
+}
+
+// a result of batch request (a line of results JSONL)
+type batchResult struct {
+	ID    string `json:"id"`
+	Line  int    `json:"line"`
+	Model string `json:"model"`
+
+	Content    string `json:"content,omitempty"`
+	Thinking   string `json:"thinking,omitempty"`
+	DoneReason string `json:"done_reason,omitempty"`
+
+	Metrics   *api.Metrics `json:"metrics,omitempty"`
+	ElapsedMs int64        `json:"elapsed_ms"`
+
+	Error string `json:"error,omitempty"`
+
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// batchConcurrencyFrom returns the number of concurrent batch requests from params and config.
+//
+// (params take precedence over config)
+func batchConcurrencyFrom(conf config, p params) int {
+	concurrency := defaultBatchConcurrency
+	if conf.BatchConcurrency > 0 {
+		concurrency = conf.BatchConcurrency
+	}
+	if p.Batch.Concurrency != nil && *p.Batch.Concurrency > 0 {
+		concurrency = *p.Batch.Concurrency
+	}
+	return concurrency
+}
+
+// batchResultsFilepath returns the filepath of results for given batch file.
+//
+// (eg. `requests.jsonl` => `requests.results.jsonl`)
+func batchResultsFilepath(batchFilepath string, given *string) string {
+	if given != nil {
+		return expandPath(*given)
+	}
+	return strings.TrimSuffix(batchFilepath, filepath.Ext(batchFilepath)) + batchResultsFilenameSuffix
+}
+
+// readBatchRequests reads requests from given JSONL file.
+//
+// (relative paths of files in requests are resolved against the directory of the batch file)
+func readBatchRequests(fpath string) (requests []batchRequest, err error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	ids := map[string]int{}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), batchMaxLineBytes)
+	for line := 1; scanner.Scan(); line++ {
+		trimmed := bytes.TrimSpace(scanner.Bytes())
+		if len(trimmed) <= 0 {
+			continue
+		}
+
+		var req batchRequest
+		if err := json.Unmarshal(trimmed, &req); err != nil {
+			return nil, fmt.Errorf("failed to parse line %d: %w", line, err)
+		}
+		if len(strings.TrimSpace(req.Prompt)) <= 0 {
+			return nil, fmt.Errorf("no prompt in line %d", line)
+		}
+		if len(req.ID) <= 0 {
+			req.ID = strconv.Itoa(line)
+		}
+		if prev, exists := ids[req.ID]; exists {
+			return nil, fmt.Errorf("duplicated id '%s' in line %d (already in line %d)", req.ID, line, prev)
+		}
+		ids[req.ID] = line
+		req.line = line
+
+		for i, file := range req.Files {
+			if file = expandPath(file); !filepath.IsAbs(file) {
+				file = filepath.Join(filepath.Dir(fpath), file)
+			}
+			req.Files[i] = file
+		}
+
+		requests = append(requests, req)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return requests, nil
+}
+
+// finishedBatchIDs reads ids of successfully finished requests from given results file.
+//
+// (lines which cannot be parsed, eg. partially written on interruption, are ignored)
+func finishedBatchIDs(fpath string) (finished map[string]bool, err error) {
+	finished = map[string]bool{}
+
+	f, err := os.Open(fpath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return finished, nil
+		}
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), batchMaxLineBytes)
+	for scanner.Scan() {
+		var res batchResult
+		if err := json.Unmarshal(scanner.Bytes(), &res); err != nil {
+			continue
+		}
+		if len(res.Error) <= 0 {
+			finished[res.ID] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return finished, nil
+}
+
+// openBatchResultsFile opens given results file for appending results.
+//
+// Existing results of requests with given ids (which will be retried) are removed first,
+// so that each request has only one result in the file.
+// (duplicated results of the same id and lines which cannot be parsed, eg. partially written on interruption, are also removed)
+func openBatchResultsFile(fpath string, retried map[string]bool) (*os.File, error) {
+	if err := compactBatchResults(fpath, retried); err != nil {
+		return nil, err
+	}
+
+	return os.OpenFile(fpath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+}
+
+// compactBatchResults rewrites given results file with the last result of each id,
+// excluding the results of given ids.
+func compactBatchResults(fpath string, excluded map[string]bool) error {
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	// (index of the last result of each id)
+	lines := [][]byte{}
+	ids := []string{}
+	last := map[string]int{}
+	for line := range bytes.Lines(data) {
+		var res batchResult
+		if err := json.Unmarshal(line, &res); err != nil {
+			continue
+		}
+		last[res.ID] = len(lines)
+		lines = append(lines, bytes.TrimRight(line, "\r\n"))
+		ids = append(ids, res.ID)
+	}
+
+	var compacted bytes.Buffer
+	for i, line := range lines {
+		if last[ids[i]] == i && !excluded[ids[i]] {
+			compacted.Write(line)
+			compacted.WriteByte('\n')
+		}
+	}
+	if bytes.Equal(compacted.Bytes(), data) {
+		return nil
+	}
+
+	// NOTE: write to a temporary file first, for not losing results on interruption
+	tmp := fpath + ".tmp"
+	if err := os.WriteFile(tmp, compacted.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fpath)
+}
+
+// doBatch runs requests in given batch file concurrently, and writes their results to a JSONL file.
+//
+// Requests which already have successful results in the results file are skipped.
+func doBatch(
+	ctx context.Context,
+	output *outputWriter,
+	conf config,
+	p params,
+) (exit int, e error) {
+	batchFilepath := expandPath(*p.Batch.Filepath)
+	resultsFilepath := batchResultsFilepath(batchFilepath, p.Batch.ResultsFilepath)
+
+	requests, err := readBatchRequests(batchFilepath)
+	if err != nil {
+		return 1, fmt.Errorf("failed to read batch file '%s': %w", batchFilepath, err)
+	}
+	finished, err := finishedBatchIDs(resultsFilepath)
+	if err != nil {
+		return 1, fmt.Errorf("failed to read results file '%s': %w", resultsFilepath, err)
+	}
+
+	pending := []batchRequest{}
+	for _, req := range requests {
+		if !finished[req.ID] {
+			pending = append(pending, req)
+		}
+	}
+	if skipped := len(requests) - len(pending); skipped > 0 {
+		output.printColored(
+			color.FgYellow,
+			"Skipping %d request(s) which already have results in '%s'.\n",
+			skipped,
+			resultsFilepath,
+		)
+	}
+	if len(pending) <= 0 {
+		output.printColored(
+			color.FgGreen,
+			"No pending requests in '%s'.\n",
+			batchFilepath,
+		)
+		return 0, nil
+	}
+
+	keepAlive, err := resolveKeepAlive(conf, p)
+	if err != nil {
+		return 1, err
+	}
+
+	retried := map[string]bool{}
+	for _, req := range pending {
+		retried[req.ID] = true
+	}
+	f, err := openBatchResultsFile(resultsFilepath, retried)
+	if err != nil {
+		return 1, fmt.Errorf("failed to open results file '%s': %w", resultsFilepath, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	concurrency := max(1, min(batchConcurrencyFrom(conf, p), len(pending)))
+	output.verbose(
+		verboseMinimum,
+		p.Verbose,
+		"running %d request(s) with concurrency %d, writing results to '%s'...",
+		len(pending),
+		concurrency,
+		resultsFilepath,
+	)
+
+	var mu sync.Mutex // for writing results and printing progresses
+	numDone, numFailed := 0, 0
+	var writeErr error
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, req := range pending {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(req batchRequest) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			res := runBatchRequest(ctx, conf, p, req, keepAlive)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			numDone++
+			if len(res.Error) > 0 {
+				numFailed++
+
+				output.printColored(
+					color.FgRed,
+					"[%d/%d] %s: failed (%s)\n",
+					numDone,
+					len(pending),
+					res.ID,
+					res.Error,
+				)
+			} else {
+				output.printColored(
+					color.FgGreen,
+					"[%d/%d] %s: done (%.1fs)\n",
+					numDone,
+					len(pending),
+					res.ID,
+					float64(res.ElapsedMs)/1000,
+				)
+			}
+
+			// NOTE: written line by line, for resuming after interruption
+			if marshalled, err := json.Marshal(res); err == nil {
+				if _, err := f.Write(append(marshalled, '\n')); err != nil && writeErr == nil {
+					writeErr = err
+				}
+			} else if writeErr == nil {
+				writeErr = err
+			}
+		}(req)
+	}
+	wg.Wait()
+
+	if writeErr != nil {
+		return 1, fmt.Errorf("failed to write results to '%s': %w", resultsFilepath, writeErr)
+	}
+
+	output.printColored(
+		color.FgGreen,
+		"Finished %d request(s) (%d failed), results written to '%s'.\n",
+		numDone,
+		numFailed,
+		resultsFilepath,
+	)
+
+	if numFailed > 0 {
+		return 1, fmt.Errorf("%d of %d request(s) failed", numFailed, numDone)
+	}
+	return 0, nil
+}
+
+// batchRequestOptions returns options for given batch request
+// (from config, profile, and params, overridden with the ones of the request).
+func batchRequestOptions(
+	conf config,
+	p params,
+	req batchRequest,
+	model string,
+) (options map[string]any, err error) {
+	if options, err = generationOptionsFor(conf, p, model); err != nil {
+		return nil, err
+	}
+	if len(req.Options) > 0 {
+		converted, err := convertOptions(req.Options)
+		if err != nil {
+			return nil, err
+		}
+		maps.Copy(options, converted)
+	}
+	return options, nil
+}
+
+// runBatchRequest runs given batch request with the existing generation path, and returns its result.
+func runBatchRequest(
+	ctx context.Context,
+	conf config,
+	p params,
+	req batchRequest,
+	keepAlive *api.Duration,
+) (res batchResult) {
+	startedAt := time.Now()
+
+	res = batchResult{
+		ID:    req.ID,
+		Line:  req.line,
+		Model: *p.Model,
+	}
+	if req.Model != nil {
+		res.Model = *req.Model
+	}
+	defer func() {
+		res.ElapsedMs = time.Since(startedAt).Milliseconds()
+		res.FinishedAt = time.Now()
+	}()
+
+	// NOTE: generated things are accumulated, not printed to stdout
+	jobOutput := newOutputWriter()
+	jobOutput.format = outputFormatJSON
+
+	systemInstruction := systemInstructionFor(p, res.Model)
+	if req.System != nil {
+		systemInstruction = *req.System
+	}
+
+	// options
+	options, err := batchRequestOptions(conf, p, req, res.Model)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	// JSON schema
+	outputJSONScheme := p.Generation.OutputJSONScheme
+	if len(req.JSONSchema) > 0 {
+		var str string
+		if err := json.Unmarshal(req.JSONSchema, &str); err == nil {
+			outputJSONScheme = ptr(str)
+		} else {
+			outputJSONScheme = ptr(string(req.JSONSchema))
+		}
+	}
+
+	// files (of the request, and from params)
+	fileOpts, err := fileOptionsFrom(conf, p)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	filepaths := p.Generation.Filepaths
+	if len(req.Files) > 0 {
+		fp := p
+		fp.Generation.Filepaths = nil
+		for _, file := range req.Files {
+			fp.Generation.Filepaths = append(fp.Generation.Filepaths, ptr(file))
+		}
+		expanded, err := expandFilepaths(jobOutput, fp, fileOpts)
+		if err != nil {
+			res.Error = fmt.Sprintf("failed to read given filepaths: %s", err)
+			return res
+		}
+		filepaths = append(append([]*string{}, filepaths...), expanded...)
+	}
+
+	_, conversation, err := doGeneration(
+		ctx,
+		jobOutput,
+		conf,
+		res.Model,
+		systemInstruction,
+		p.Generation.DetailedOptions.Stop,
+		options,
+		keepAlive,
+		outputJSONScheme,
+		p.Generation.Thinking.WithThinking,
+		false,
+		p.ContextWindowSize,
+		p.ContextOverflow,
+		req.Prompt,
+		filepaths,
+		fileOpts,
+		nil,
+		false,
+		false,
+		false,
+		defaultToolCallWorkers,
+		nil,
+		nil,
+		nil,
+		nil,
+		newAgentLoop(agentLoopLimitsFrom(conf, p)),
+		nil,
+		p.UserAgent,
+		p.ReplaceHTTPURLsInPrompt,
+		p.Verbose,
+	)
+
+	generated := generatedMessages(conversation)
+	res.Content = finalContentOf(generated)
+	res.Thinking = thinkingOf(generated)
+	res.DoneReason = jobOutput.result.DoneReason
+	res.Metrics = jobOutput.result.Metrics
+	if err != nil {
+		res.Error = err.Error()
+	}
+
+	return res
+}
@@ -0,0 +1,132 @@
+// batch_test.go
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// test `readBatchRequests` and `finishedBatchIDs` for resuming batches
+func TestBatchRequestsAndResults(t *testing.T) {
+	dir := t.TempDir()
+
+	batchFilepath := filepath.Join(dir, "requests.jsonl")
+	if err := os.WriteFile(batchFilepath, []byte(`{"id": "a", "prompt": "hello"}
+
+{"prompt": "without id", "model": "gemma3:4b", "options": {"seed": 42}}
+{"id": "c", "prompt": "with schema", "json_schema": {"type": "object"}}
+{"id": "d", "prompt": "with files", "files": ["docs/a.txt", "/tmp/b.txt"]}
+`), 0o644); err != nil {
+		t.Fatalf("failed to write batch file: %s", err)
+	}
+
+	requests, err := readBatchRequests(batchFilepath)
+	if err != nil {
+		t.Fatalf("failed to read batch requests: %s", err)
+	}
+	if len(requests) != 4 {
+		t.Fatalf("expected 4 requests, got %d", len(requests))
+	}
+	if requests[1].ID != "3" {
+		t.Errorf("expected line number '3' as id, got '%s'", requests[1].ID)
+	}
+	if expected := []string{filepath.Join(dir, "docs", "a.txt"), "/tmp/b.txt"}; !slices.Equal(requests[3].Files, expected) {
+		t.Errorf("expected files relative to the batch file, got %v", requests[3].Files)
+	}
+
+	resultsFilepath := batchResultsFilepath(batchFilepath, nil)
+	if resultsFilepath != filepath.Join(dir, "requests.results.jsonl") {
+		t.Errorf("unexpected results filepath: %s", resultsFilepath)
+	}
+
+	// (failed, succeeded, and partially written results)
+	if err := os.WriteFile(resultsFilepath, []byte(`{"id": "a", "error": "generation failed"}
+{"id": "3", "content": "done"}
+{"id": "c", "cont`), 0o644); err != nil {
+		t.Fatalf("failed to write results file: %s", err)
+	}
+
+	finished, err := finishedBatchIDs(resultsFilepath)
+	if err != nil {
+		t.Fatalf("failed to read finished ids: %s", err)
+	}
+	if len(finished) != 1 || !finished["3"] {
+		t.Errorf("expected only '3' to be finished, got %v", finished)
+	}
+
+	// results of retried requests should be replaced
+	f, err := openBatchResultsFile(resultsFilepath, map[string]bool{"a": true, "c": true})
+	if err != nil {
+		t.Fatalf("failed to open results file: %s", err)
+	}
+	_, _ = f.WriteString(`{"id": "a", "content": "retried"}` + "\n")
+	_ = f.Close()
+	if data, _ := os.ReadFile(resultsFilepath); string(data) != `{"id": "3", "content": "done"}`+"\n"+`{"id": "a", "content": "retried"}`+"\n" {
+		t.Errorf("unexpected results after retrying: %s", string(data))
+	}
+
+	// duplicated ids should fail
+	if err := os.WriteFile(batchFilepath, []byte(`{"id": "a", "prompt": "1"}
+{"id": "a", "prompt": "2"}
+`), 0o644); err != nil {
+		t.Fatalf("failed to write batch file: %s", err)
+	}
+	if _, err := readBatchRequests(batchFilepath); err == nil {
+		t.Errorf("expected an error for duplicated ids")
+	}
+}
+
+// test `systemInstructionFor` for models of batch requests (and comparisons, benchmarks)
+func TestSystemInstructionFor(t *testing.T) {
+	var p params
+	p.Model = ptr("model-a")
+	p.Generation.DetailedOptions.SystemInstruction = ptr(defaultSystemInstruction(p))
+	p.Generation.DetailedOptions.SystemInstructionIsDefault = true
+
+	// default one: generated for the given model
+	if instruction := systemInstructionFor(p, "model-b"); !strings.Contains(instruction, "'model-b'") || strings.Contains(instruction, "'model-a'") {
+		t.Errorf("expected the default system instruction for 'model-b', got '%s'", instruction)
+	}
+
+	// given one: kept as it is
+	p.Generation.DetailedOptions.SystemInstruction = ptr("be concise")
+	p.Generation.DetailedOptions.SystemInstructionIsDefault = false
+	if instruction := systemInstructionFor(p, "model-b"); instruction != "be concise" {
+		t.Errorf("expected the given system instruction, got '%s'", instruction)
+	}
+}
+
+// test `batchRequestOptions` for the precedence of options of requests
+func TestBatchRequestOptions(t *testing.T) {
+	conf := config{
+		Profiles: map[string]profile{
+			"work": {TopK: ptr(int32(40))},
+		},
+	}
+
+	var p params
+	p.Profile = ptr("work")
+	p.Generation.DetailedOptions.Temperature = ptr(float32(0.5))
+	p.Generation.DetailedOptions.Options = []string{"seed=1"}
+
+	options, err := batchRequestOptions(conf, p, batchRequest{
+		Options: map[string]any{
+			"temperature": float64(0.1),
+			"top_k":       float64(10),
+		},
+	}, "model-a")
+	if err != nil {
+		t.Fatalf("failed to get options: %s", err)
+	}
+	if options["temperature"] != float64(0.1) || options["top_k"] != 10 || options["seed"] != 1 {
+		t.Errorf("expected options of the request to take precedence, got %#v", options)
+	}
+
+	if _, err := batchRequestOptions(conf, p, batchRequest{Options: map[string]any{"no_such_option": 1}}, "model-a"); err == nil {
+		t.Errorf("expected an error for an invalid option of the request")
+	}
+}
@@ -0,0 +1,443 @@
+// benchmark.go
+//
+// things for benchmarking locally installed models
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/ollama/ollama/api"
+	mdl "github.com/ollama/ollama/types/model"
+)
+
+const (
+	defaultBenchmarkRuns        = 3
+	benchmarkHistoryFilename    = "benchmarks.jsonl"
+	benchmarkMaxHistoryLineSize = 1024 * 1024
+)
+
+// standard prompts for benchmark
+var defaultBenchmarkPrompts = []string{
+	"What is the capital of France? Answer in one word.",
+	"Explain how a hash table works in about 100 words.",
+	"Write a Go function which reverses a string, with a short explanation.",
+	"Summarize the plot of Romeo and Juliet in 5 bullet points.",
+}
+
+// statistics of samples
+type benchmarkStats struct {
+	Mean    float64 `json:"mean"`
+	P50     float64 `json:"p50"`
+	P95     float64 `json:"p95"`
+	Samples int     `json:"samples"`
+}
+
+// a benchmark result of a model (saved as a line of history file)
+type benchmarkRecord struct {
+	Model         string    `json:"model"`
+	Digest        string    `json:"digest,omitempty"`
+	OllamaVersion string    `json:"ollama_version,omitempty"`
+	Timestamp     time.Time `json:"timestamp"`
+
+	Runs    int `json:"runs"`
+	Prompts int `json:"prompts"`
+
+	ColdLoadSeconds       benchmarkStats `json:"cold_load_seconds"`
+	WarmLoadSeconds       benchmarkStats `json:"warm_load_seconds"`
+	PromptTokensPerSecond benchmarkStats `json:"prompt_tokens_per_second"`
+	TokensPerSecond       benchmarkStats `json:"tokens_per_second"`
+
+	Errors int `json:"errors,omitempty"`
+}
+
+// calculateStats calculates mean, p50, and p95 of given values.
+//
+// (percentiles are calculated with the nearest-rank method)
+func calculateStats(values []float64) (stats benchmarkStats) {
+	if len(values) <= 0 {
+		return stats
+	}
+
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+
+	sum := 0.0
+	for _, v := range sorted {
+		sum += v
+	}
+
+	return benchmarkStats{
+		Mean:    sum / float64(len(sorted)),
+		P50:     percentile(sorted, 50),
+		P95:     percentile(sorted, 95),
+		Samples: len(sorted),
+	}
+}
+
+// percentile returns the p-th percentile of given sorted values (nearest-rank method).
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(0, min(rank-1, len(sorted)-1))]
+}
+
+// resolveBenchmarkHistoryFilepath resolves the filepath of benchmark history.
+func resolveBenchmarkHistoryFilepath(given *string) string {
+	if given != nil {
+		return expandPath(*given)
+	}
+
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome != "" {
+		return filepath.Join(stateHome, appName, benchmarkHistoryFilename)
+	}
+
+	return filepath.Join(os.Getenv("HOME"), ".local", "state", appName, benchmarkHistoryFilename)
+}
+
+// readBenchmarkPrompts reads prompts (one per line) from given file.
+func readBenchmarkPrompts(fpath string) (prompts []string, err error) {
+	bytes, err := os.ReadFile(expandPath(fpath))
+	if err != nil {
+		return nil, err
+	}
+
+	for line := range strings.SplitSeq(string(bytes), "\n") {
+		if line = strings.TrimSpace(line); len(line) > 0 {
+			prompts = append(prompts, line)
+		}
+	}
+	if len(prompts) <= 0 {
+		return nil, fmt.Errorf("no prompts in '%s'", fpath)
+	}
+
+	return prompts, nil
+}
+
+// readLastBenchmarkRecords reads the last benchmark record of each model from given history file.
+func readLastBenchmarkRecords(fpath string) (records map[string]benchmarkRecord, err error) {
+	records = map[string]benchmarkRecord{}
+
+	f, err := os.Open(fpath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return records, nil
+		}
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), benchmarkMaxHistoryLineSize)
+	for scanner.Scan() {
+		var record benchmarkRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err == nil {
+			records[record.Model] = record
+		}
+	}
+
+	return records, scanner.Err()
+}
+
+// appendBenchmarkRecords appends given records to the history file.
+func appendBenchmarkRecords(fpath string, records []benchmarkRecord) error {
+	if err := os.MkdirAll(filepath.Dir(fpath), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(fpath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	for _, record := range records {
+		marshalled, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(append(marshalled, '\n')); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// benchmarkModels returns the models to benchmark, and digests of locally installed models.
+//
+// (all locally installed models which support completion, if not given)
+func benchmarkModels(
+	ctx context.Context,
+	conf config,
+	client *api.Client,
+	p params,
+) (models []string, digests map[string]string, err error) {
+	ctx, cancel := context.WithTimeout(
+		ctx,
+		time.Duration(conf.TimeoutSeconds)*time.Second,
+	)
+	defer cancel()
+
+	listed, err := client.List(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list models: %w", err)
+	}
+	digests = map[string]string{}
+	for _, model := range listed.Models {
+		digests[model.Name] = model.Digest
+	}
+
+	if p.Benchmark.Models != nil {
+		return parseModelList(*p.Benchmark.Models), digests, nil
+	}
+
+	for _, model := range listed.Models {
+		shown, err := client.Show(ctx, &api.ShowRequest{
+			Model: model.Name,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get model(%s) info: %w", model.Name, err)
+		}
+		if slices.Contains(shown.Capabilities, mdl.CapabilityCompletion) {
+			models = append(models, model.Name)
+		}
+	}
+
+	return models, digests, nil
+}
+
+// doBenchmark benchmarks models with a prompt set, and saves the results to the history file.
+//
+// Each run starts with unloading the model, so the first request of each run measures the cold load time,
+// and the other requests measure the warm load time. (runs which failed to unload the model have no cold load time)
+func doBenchmark(
+	ctx context.Context,
+	output *outputWriter,
+	conf config,
+	p params,
+) (exit int, e error) {
+	vbs := p.Verbose
+
+	// ollama api client
+	client, err := newOllamaClient()
+	if err != nil {
+		return 1, fmt.Errorf("failed to initialize Ollama API client: %w", err)
+	}
+
+	models, digests, err := benchmarkModels(ctx, conf, client, p)
+	if err != nil {
+		return 1, err
+	}
+	if len(models) <= 0 {
+		return 1, fmt.Errorf("no models to benchmark")
+	}
+
+	prompts := defaultBenchmarkPrompts
+	if p.Benchmark.PromptsFilepath != nil {
+		if prompts, err = readBenchmarkPrompts(*p.Benchmark.PromptsFilepath); err != nil {
+			return 1, fmt.Errorf("failed to read benchmark prompts: %w", err)
+		}
+	}
+
+	runs := defaultBenchmarkRuns
+	if p.Benchmark.Runs != nil && *p.Benchmark.Runs > 0 {
+		runs = *p.Benchmark.Runs
+	}
+
+	ollamaVersion, err := client.Version(ctx)
+	if err != nil {
+		output.warn("Failed to get the version of Ollama: %s", err)
+	}
+
+	historyFilepath := resolveBenchmarkHistoryFilepath(p.Benchmark.HistoryFilepath)
+	previous, err := readLastBenchmarkRecords(historyFilepath)
+	if err != nil {
+		output.warn("Failed to read benchmark history '%s': %s", historyFilepath, err)
+	}
+
+	keepAlive, err := resolveKeepAlive(conf, p)
+	if err != nil {
+		return 1, err
+	}
+
+	records := []benchmarkRecord{}
+	for _, model := range models {
+		output.printColored(
+			color.FgHiWhite,
+			"Benchmarking '%s' (%d run(s) x %d prompt(s))...\n",
+			model,
+			runs,
+			len(prompts),
+		)
+
+		record := benchmarkRecord{
+			Model:         model,
+			Digest:        digests[model],
+			OllamaVersion: ollamaVersion,
+			Timestamp:     time.Now(),
+			Runs:          runs,
+			Prompts:       len(prompts),
+		}
+
+		var coldLoads, warmLoads, promptRates, evalRates []float64
+		for run := 1; run <= runs; run++ {
+			// unload the model for measuring the cold load time
+			// (NOTE: if it fails, the run goes on without measuring the cold load time, so that other records are not lost)
+			unloaded := true
+			if err := sendEmptyRequest(ctx, conf, model, &api.Duration{Duration: 0}); err != nil {
+				output.warn("[%s run %d] failed to unload model, not measuring the cold load time: %s", model, run, err)
+				unloaded = false
+			}
+
+			for i, prompt := range prompts {
+				res := runBatchRequest(
+					ctx,
+					conf,
+					p,
+					batchRequest{
+						ID:     fmt.Sprintf("%s/%d/%d", model, run, i+1),
+						Prompt: prompt,
+						Model:  ptr(model),
+					},
+					keepAlive,
+				)
+				if len(res.Error) > 0 || res.Metrics == nil {
+					record.Errors++
+
+					output.warn("[%s run %d, prompt %d] failed: %s", model, run, i+1, res.Error)
+					continue
+				}
+
+				output.verbose(
+					verboseMinimum,
+					vbs,
+					"[%s run %d, prompt %d] load: %v, prompt eval: %.1f/s, eval: %.1f/s",
+					model,
+					run,
+					i+1,
+					res.Metrics.LoadDuration,
+					tokensPerSecond(res.Metrics.PromptEvalCount, res.Metrics.PromptEvalDuration),
+					tokensPerSecond(res.Metrics.EvalCount, res.Metrics.EvalDuration),
+				)
+
+				if i == 0 {
+					if unloaded {
+						coldLoads = append(coldLoads, res.Metrics.LoadDuration.Seconds())
+					}
+				} else {
+					warmLoads = append(warmLoads, res.Metrics.LoadDuration.Seconds())
+				}
+				if res.Metrics.PromptEvalDuration > 0 {
+					promptRates = append(promptRates, tokensPerSecond(res.Metrics.PromptEvalCount, res.Metrics.PromptEvalDuration))
+				}
+				if res.Metrics.EvalDuration > 0 {
+					evalRates = append(evalRates, tokensPerSecond(res.Metrics.EvalCount, res.Metrics.EvalDuration))
+				}
+			}
+		}
+
+		record.ColdLoadSeconds = calculateStats(coldLoads)
+		record.WarmLoadSeconds = calculateStats(warmLoads)
+		record.PromptTokensPerSecond = calculateStats(promptRates)
+		record.TokensPerSecond = calculateStats(evalRates)
+
+		var prev *benchmarkRecord
+		if r, exists := previous[model]; exists {
+			prev = &r
+		}
+		printBenchmarkRecord(output, record, prev)
+
+		records = append(records, record)
+	}
+
+	// save results to the history file
+	if err := appendBenchmarkRecords(historyFilepath, records); err != nil {
+		return 1, fmt.Errorf("failed to save benchmark history to '%s': %w", historyFilepath, err)
+	}
+	output.verbose(
+		verboseMedium,
+		vbs,
+		"saved benchmark results to '%s'",
+		historyFilepath,
+	)
+
+	return 0, nil
+}
+
+// printBenchmarkRecord prints given benchmark record (and changes from the previous one, if any).
+func printBenchmarkRecord(
+	output *outputWriter,
+	record benchmarkRecord,
+	prev *benchmarkRecord,
+) {
+	type row struct {
+		name     string
+		stats    benchmarkStats
+		unit     string
+		previous *benchmarkStats
+	}
+	rows := []row{
+		{name: "cold load", stats: record.ColdLoadSeconds, unit: "s"},
+		{name: "warm load", stats: record.WarmLoadSeconds, unit: "s"},
+		{name: "prompt eval", stats: record.PromptTokensPerSecond, unit: " tok/s"},
+		{name: "eval", stats: record.TokensPerSecond, unit: " tok/s"},
+	}
+	if prev != nil {
+		rows[0].previous = &prev.ColdLoadSeconds
+		rows[1].previous = &prev.WarmLoadSeconds
+		rows[2].previous = &prev.PromptTokensPerSecond
+		rows[3].previous = &prev.TokensPerSecond
+	}
+
+	output.printColored(
+		color.FgHiCyan,
+		"%s (ollama %s)\n",
+		record.Model,
+		record.OllamaVersion,
+	)
+	for _, r := range rows {
+		if r.stats.Samples <= 0 {
+			output.printColored(color.FgWhite, "  %-12s  no samples\n", r.name)
+			continue
+		}
+
+		line := fmt.Sprintf(
+			"  %-12s  mean %9.2f%s  p50 %9.2f%s  p95 %9.2f%s",
+			r.name,
+			r.stats.Mean, r.unit,
+			r.stats.P50, r.unit,
+			r.stats.P95, r.unit,
+		)
+		if r.previous != nil && r.previous.Samples > 0 && r.previous.Mean > 0 {
+			line += fmt.Sprintf("  (%+.1f%% from mean %.2f%s)", (r.stats.Mean/r.previous.Mean-1)*100, r.previous.Mean, r.unit)
+		}
+		output.printColored(color.FgWhite, "%s\n", line)
+	}
+	if prev != nil {
+		output.printColored(
+			color.FgHiBlack,
+			"  (compared with the previous benchmark at %s, ollama %s)\n",
+			prev.Timestamp.Format(time.RFC3339),
+			prev.OllamaVersion,
+		)
+	}
+	if record.Errors > 0 {
+		output.printColored(
+			color.FgRed,
+			"  %d request(s) failed\n",
+			record.Errors,
+		)
+	}
+}
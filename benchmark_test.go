@@ -0,0 +1,40 @@
+// benchmark_test.go
+
+package main
+
+import (
+	"testing"
+)
+
+// test `calculateStats` for mean and percentiles
+func TestCalculateStats(t *testing.T) {
+	type test struct {
+		values   []float64
+		expected benchmarkStats
+	}
+
+	tests := []test{
+		{
+			values:   nil,
+			expected: benchmarkStats{},
+		},
+		{
+			values:   []float64{3},
+			expected: benchmarkStats{Mean: 3, P50: 3, P95: 3, Samples: 1},
+		},
+		{
+			values:   []float64{5, 1, 4, 2, 3},
+			expected: benchmarkStats{Mean: 3, P50: 3, P95: 5, Samples: 5},
+		},
+		{
+			values:   []float64{10, 20, 30, 40, 50, 60, 70, 80, 90, 100, 110, 120, 130, 140, 150, 160, 170, 180, 190, 200},
+			expected: benchmarkStats{Mean: 105, P50: 100, P95: 190, Samples: 20},
+		},
+	}
+
+	for _, test := range tests {
+		if stats := calculateStats(test.values); stats != test.expected {
+			t.Errorf("expected %+v, got %+v", test.expected, stats)
+		}
+	}
+}
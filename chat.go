@@ -0,0 +1,333 @@
+// chat.go
+//
+// things for interactive (multi-turn) chat
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/ollama/ollama/api"
+)
+
+const (
+	chatInputPrompt       = `> `
+	chatInputContinuation = `. `
+	chatLineContinuation  = `\`
+)
+
+// slash commands for chat
+const (
+	chatCommandHelp   = `/help`
+	chatCommandModel  = `/model`
+	chatCommandSystem = `/system`
+	chatCommandClear  = `/clear`
+	chatCommandFiles  = `/files`
+	chatCommandSave   = `/save`
+	chatCommandExit   = `/exit`
+	chatCommandQuit   = `/quit`
+)
+
+const chatHelpMessage = `Available commands:
+  /model [NAME]       Show or change the model
+  /system [TEXT]      Show or change the system instruction
+  /clear              Clear the history of conversation
+  /files [PATH ...]   Show or attach files (or directories) to the next message ('/files clear' to detach them)
+  /save PATH          Save the history of conversation to a file (in JSON)
+  /help               Show this help message
+  /exit, /quit        Exit chat
+
+(end a line with '\' to continue typing on the next line)
+`
+
+// chat state which is kept between turns
+type chatState struct {
+	model             string
+	systemInstruction string
+
+	systemInstructionIsDefault bool // true if the system instruction is generated for the model (generated again on '/model')
+
+	history      []api.Message // past messages (without the system instruction)
+	pendingFiles []*string     // files to be attached to the next message
+
+	session *session // saved after each turn (if not nil)
+
+	fileOpts fileOptions // options for attached files
+}
+
+// messages returns all messages of the chat, including the system instruction.
+func (s *chatState) messages() []api.Message {
+	return append([]api.Message{
+		{
+			Role:    "system",
+			Content: s.systemInstruction,
+		},
+	}, s.history...)
+}
+
+// saveSession saves the chat to its session (if any).
+func (s *chatState) saveSession(output *outputWriter) {
+	if s.session == nil {
+		return
+	}
+
+	if err := updateSession(s.session, s.model, s.messages()); err != nil {
+		output.error("Failed to save session: %s", err)
+	}
+}
+
+// doChat runs an interactive chat which keeps the history of conversation between turns.
+func doChat(
+	ctx context.Context,
+	output *outputWriter,
+	conf config,
+	p params,
+	sess *session,
+	localTools []api.Tool,
+	mcpConnsAndTools mcpConnectionsAndTools,
+) (exit int, e error) {
+	state := chatState{
+		model:             *p.Model,
+		systemInstruction: *p.Generation.DetailedOptions.SystemInstruction,
+		pendingFiles:      p.Generation.Filepaths,
+		session:           sess,
+
+		systemInstructionIsDefault: p.Generation.DetailedOptions.SystemInstructionIsDefault,
+	}
+	if sess != nil {
+		state.history = sess.history()
+
+		output.printColored(
+			color.FgGreen,
+			"Resuming session '%s' with %d message(s)\n",
+			sess.Name,
+			len(state.history),
+		)
+	}
+
+	output.printColored(
+		color.FgGreen,
+		"Chatting with model '%s' (type '%s' for help, '%s' to exit)\n",
+		state.model,
+		chatCommandHelp,
+		chatCommandExit,
+	)
+
+	// the first message (if given)
+	var prompt string
+	if p.hasPrompt() {
+		prompt = *p.Generation.Prompt
+	}
+
+	keepAlive, err := resolveKeepAlive(conf, p)
+	if err != nil {
+		return 1, err
+	}
+	fileOpts, err := fileOptionsFrom(conf, p)
+	if err != nil {
+		return 1, err
+	}
+	state.fileOpts = fileOpts
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		if len(prompt) <= 0 {
+			line, err := readChatInput(output, reader)
+			if err != nil {
+				if err == io.EOF {
+					output.makeSureToEndWithNewLine()
+					return 0, nil
+				}
+				return 1, fmt.Errorf("failed to read chat input: %w", err)
+			}
+			if len(line) <= 0 {
+				continue
+			}
+
+			// handle slash commands
+			if strings.HasPrefix(line, "/") {
+				if quit := handleChatCommand(output, p, &state, line); quit {
+					return 0, nil
+				}
+				continue
+			}
+
+			prompt = line
+		}
+
+		options, err := generationOptionsFor(conf, p, state.model)
+		if err != nil {
+			return 1, err
+		}
+
+		_, conversation, err := doGeneration(
+			ctx,
+			output,
+			conf,
+			state.model,
+			state.systemInstruction,
+			p.Generation.DetailedOptions.Stop,
+			options,
+			keepAlive,
+			p.Generation.OutputJSONScheme,
+			p.Generation.Thinking.WithThinking,
+			p.Generation.Thinking.HideReasoning,
+			p.ContextWindowSize,
+			p.ContextOverflow,
+			prompt,
+			state.pendingFiles,
+			fileOpts,
+			state.history,
+			p.Tools.ShowCallbackResults,
+			p.Tools.RecurseOnCallbackResults,
+			p.Tools.ForceCallDestructiveTools,
+			toolCallWorkersFrom(conf, p),
+			localTools,
+			p.LocalTools.ToolCallbacks,
+			p.LocalTools.ToolCallbacksConfirm,
+			mcpConnsAndTools,
+			newAgentLoop(agentLoopLimitsFrom(conf, p)),
+			nil,
+			p.UserAgent,
+			p.ReplaceHTTPURLsInPrompt,
+			p.Verbose,
+		)
+		prompt = ""
+		if err != nil {
+			// NOTE: keep chatting even when a generation fails
+			output.emitError("Generation failed: %s", err)
+
+			// (keep the conversation if returned, eg. when stopped by limits of agent loop)
+			if len(conversation) <= 0 {
+				continue
+			}
+		}
+
+		// keep the history (without the system instruction), and detach sent files
+		if len(conversation) > 0 {
+			state.history = conversation[1:]
+		}
+		state.pendingFiles = nil
+
+		state.saveSession(output)
+	}
+}
+
+// readChatInput reads a (possibly multi-line) chat input from given reader.
+func readChatInput(
+	output *outputWriter,
+	reader *bufio.Reader,
+) (input string, err error) {
+	lines := []string{}
+
+	output.finishMarkdown()
+	output.makeSureToEndWithNewLine()
+	output.printColored(color.FgHiBlue, chatInputPrompt)
+	for {
+		var line string
+		line, err = reader.ReadString('\n')
+		if err != nil && (err != io.EOF || len(line) <= 0) {
+			return "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		if continued, exists := strings.CutSuffix(line, chatLineContinuation); exists && err == nil {
+			lines = append(lines, continued)
+
+			output.printColored(color.FgHiBlue, chatInputContinuation)
+			continue
+		}
+		lines = append(lines, line)
+
+		// NOTE: the last line without a trailing newline will be returned with no error
+		output.endsWithNewLine = true
+
+		return strings.TrimSpace(strings.Join(lines, "\n")), nil
+	}
+}
+
+// handleChatCommand handles given slash command, and returns whether to quit the chat or not.
+func handleChatCommand(
+	output *outputWriter,
+	p params,
+	state *chatState,
+	line string,
+) (quit bool) {
+	command, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+
+	switch command {
+	case chatCommandHelp:
+		output.printColored(color.FgGreen, chatHelpMessage)
+	case chatCommandModel:
+		if len(arg) > 0 {
+			state.model = arg
+			if state.systemInstructionIsDefault {
+				state.systemInstruction = systemInstructionFor(p, state.model)
+			}
+			output.printColored(color.FgGreen, "Model changed to '%s'.\n", state.model)
+		} else {
+			output.printColored(color.FgGreen, "Current model: '%s'\n", state.model)
+		}
+	case chatCommandSystem:
+		if len(arg) > 0 {
+			state.systemInstruction = arg
+			state.systemInstructionIsDefault = false
+			output.printColored(color.FgGreen, "System instruction changed.\n")
+		} else {
+			output.printColored(color.FgGreen, "Current system instruction:\n%s\n", state.systemInstruction)
+		}
+	case chatCommandClear:
+		state.history = nil
+		state.saveSession(output)
+		output.printColored(color.FgGreen, "History of conversation was cleared.\n")
+	case chatCommandFiles:
+		if arg == "clear" {
+			state.pendingFiles = nil
+			output.printColored(color.FgGreen, "Detached all files.\n")
+		} else if len(arg) > 0 {
+			p.Generation.Filepaths = nil
+			for _, fp := range strings.Fields(arg) {
+				p.Generation.Filepaths = append(p.Generation.Filepaths, ptr(fp))
+			}
+			if expanded, err := expandFilepaths(output, p, state.fileOpts); err == nil {
+				state.pendingFiles = uniqPtrs(append(state.pendingFiles, expanded...))
+				output.printColored(color.FgGreen, "%d file(s) will be attached to the next message.\n", len(state.pendingFiles))
+			} else {
+				output.error("Failed to attach files: %s", err)
+			}
+		} else {
+			if len(state.pendingFiles) > 0 {
+				for _, fp := range state.pendingFiles {
+					output.printColored(color.FgGreen, "%s\n", *fp)
+				}
+			} else {
+				output.printColored(color.FgGreen, "No files are attached.\n")
+			}
+		}
+	case chatCommandSave:
+		if len(arg) <= 0 {
+			output.error("Usage: %s PATH", chatCommandSave)
+			break
+		}
+		messages := state.messages()
+		fpath := expandPath(arg)
+		if err := os.WriteFile(fpath, []byte(prettify(messages)), 0o644); err == nil {
+			output.printColored(color.FgGreen, "Saved %d message(s) to: %s\n", len(messages), fpath)
+		} else {
+			output.error("Failed to save history of conversation: %s", err)
+		}
+	case chatCommandExit, chatCommandQuit:
+		return true
+	default:
+		output.error("Unknown command: '%s' (type '%s' for help)", command, chatCommandHelp)
+	}
+
+	return false
+}
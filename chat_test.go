@@ -0,0 +1,110 @@
+// chat_test.go
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ollama/ollama/api"
+)
+
+// test `readChatInput` for line continuations and EOF
+func TestReadChatInput(t *testing.T) {
+	output := newOutputWriter()
+	reader := bufio.NewReader(strings.NewReader("first line \\\nsecond line\r\nsingle\nwithout newline \\"))
+
+	for _, expected := range []string{
+		"first line \nsecond line",
+		"single",
+		"without newline \\", // (continuation at EOF is not continued)
+	} {
+		input, err := readChatInput(output, reader)
+		if err != nil {
+			t.Fatalf("failed to read input: %s", err)
+		}
+		if input != expected {
+			t.Errorf("expected '%s', got '%s'", expected, input)
+		}
+	}
+
+	if _, err := readChatInput(output, reader); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+// test `handleChatCommand` for slash commands
+func TestHandleChatCommand(t *testing.T) {
+	output := newOutputWriter()
+	state := &chatState{
+		model:             "model-a",
+		systemInstruction: "be helpful",
+		history: []api.Message{
+			{Role: "user", Content: "hello"},
+			{Role: "assistant", Content: "hi"},
+		},
+		pendingFiles: []*string{ptr("a.txt")},
+	}
+
+	// /model
+	if quit := handleChatCommand(output, params{}, state, "/model"); quit || state.model != "model-a" {
+		t.Errorf("expected the model not to be changed, got '%s'", state.model)
+	}
+	if handleChatCommand(output, params{}, state, "/model  model-b "); state.model != "model-b" {
+		t.Errorf("expected the model to be changed, got '%s'", state.model)
+	}
+	if state.systemInstruction != "be helpful" {
+		t.Errorf("expected the custom system instruction to be kept, got '%s'", state.systemInstruction)
+	}
+
+	// /model (with the default system instruction)
+	defaultState := &chatState{
+		model:                      "model-a",
+		systemInstruction:          defaultSystemInstruction(params{Model: ptr("model-a")}),
+		systemInstructionIsDefault: true,
+	}
+	if handleChatCommand(output, params{}, defaultState, "/model model-b"); !strings.Contains(defaultState.systemInstruction, "'model-b'") {
+		t.Errorf("expected the default system instruction to be generated for the new model, got '%s'", defaultState.systemInstruction)
+	}
+	if handleChatCommand(output, params{}, defaultState, "/system be brief"); defaultState.systemInstructionIsDefault {
+		t.Errorf("expected the changed system instruction not to be the default one")
+	}
+	if handleChatCommand(output, params{}, defaultState, "/model model-c"); defaultState.systemInstruction != "be brief" {
+		t.Errorf("expected the changed system instruction to be kept, got '%s'", defaultState.systemInstruction)
+	}
+
+	// /system
+	if handleChatCommand(output, params{}, state, "/system be concise"); state.systemInstruction != "be concise" {
+		t.Errorf("expected the system instruction to be changed, got '%s'", state.systemInstruction)
+	}
+	if messages := state.messages(); len(messages) != 3 || messages[0].Role != "system" || messages[0].Content != "be concise" {
+		t.Errorf("expected messages to start with the system instruction, got %+v", messages)
+	}
+
+	// /files clear
+	if handleChatCommand(output, params{}, state, "/files clear"); state.pendingFiles != nil {
+		t.Errorf("expected files to be detached, got %d file(s)", len(state.pendingFiles))
+	}
+
+	// /clear
+	if handleChatCommand(output, params{}, state, "/clear"); len(state.history) != 0 {
+		t.Errorf("expected history to be cleared, got %d message(s)", len(state.history))
+	}
+
+	// unknown command
+	if quit := handleChatCommand(output, params{}, state, "/unknown arg"); quit {
+		t.Errorf("expected not to quit on an unknown command")
+	}
+	if state.model != "model-b" || state.systemInstruction != "be concise" {
+		t.Errorf("expected the state not to be changed by an unknown command")
+	}
+
+	// /exit, /quit
+	for _, command := range []string{"/exit", "/quit"} {
+		if quit := handleChatCommand(output, params{}, state, command); !quit {
+			t.Errorf("expected to quit with '%s'", command)
+		}
+	}
+}
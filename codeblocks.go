@@ -0,0 +1,332 @@
+// codeblocks.go
+//
+// things for extracting fenced code blocks from generated contents
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+const (
+	defaultCodeBlockFilenamePrefix = "block"
+	defaultCodeBlockExtension      = "txt"
+)
+
+// a fenced code block in markdown
+type codeBlock struct {
+	Language string // from the info string (eg. `go`)
+	Filename string // from the filename hint, if any (eg. `main.go`)
+	Code     string
+}
+
+// a code block which is extracted to a file
+type extractedCodeBlock struct {
+	Path     string `json:"path"`
+	Language string `json:"language,omitempty"`
+	Lines    int    `json:"lines"`
+}
+
+// file extensions for languages of code blocks
+var codeBlockExtensions = map[string]string{
+	"bash":       "sh",
+	"c":          "c",
+	"c++":        "cpp",
+	"clojure":    "clj",
+	"cpp":        "cpp",
+	"csharp":     "cs",
+	"css":        "css",
+	"dart":       "dart",
+	"diff":       "diff",
+	"dockerfile": "Dockerfile",
+	"elixir":     "ex",
+	"go":         "go",
+	"golang":     "go",
+	"haskell":    "hs",
+	"html":       "html",
+	"java":       "java",
+	"javascript": "js",
+	"js":         "js",
+	"json":       "json",
+	"jsx":        "jsx",
+	"kotlin":     "kt",
+	"lua":        "lua",
+	"makefile":   "mk",
+	"markdown":   "md",
+	"md":         "md",
+	"nix":        "nix",
+	"perl":       "pl",
+	"php":        "php",
+	"python":     "py",
+	"py":         "py",
+	"ruby":       "rb",
+	"rust":       "rs",
+	"scala":      "scala",
+	"sh":         "sh",
+	"shell":      "sh",
+	"sql":        "sql",
+	"swift":      "swift",
+	"toml":       "toml",
+	"ts":         "ts",
+	"tsx":        "tsx",
+	"typescript": "ts",
+	"xml":        "xml",
+	"yaml":       "yaml",
+	"yml":        "yaml",
+	"zig":        "zig",
+	"zsh":        "zsh",
+}
+
+var (
+	// opening fence of a code block (eg. "```go", "~~~~ python")
+	codeFenceOpenRegexp = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})\\s*(.*)$")
+
+	// filename hints in info strings (eg. "go title=main.go", `python filename="a.py"`)
+	infoStringFilenameRegexp = regexp.MustCompile(`(?:title|file|filename|path)=["']?([^"'\s]+)["']?`)
+
+	// filename hints in the line right before a code block (eg. "**main.go**", "`src/lib.rs`:", "### hello.py")
+	precedingFilenameRegexp = regexp.MustCompile("^(?:#{1,6}\\s+)?(?:[Ff]ile(?:name)?:\\s*)?[*_`]*([\\w./-]+\\.\\w+)[*_`]*:?$")
+)
+
+// parseCodeBlocks parses fenced code blocks from given markdown text.
+//
+// Unclosed code blocks (eg. truncated generations) are also returned.
+func parseCodeBlocks(text string) (blocks []codeBlock) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+	for i := 0; i < len(lines); i++ {
+		matches := codeFenceOpenRegexp.FindStringSubmatch(lines[i])
+		if matches == nil {
+			continue
+		}
+		fence, info := matches[1], strings.TrimSpace(matches[2])
+
+		// NOTE: info strings of backtick fences cannot contain backticks
+		if fence[0] == '`' && strings.Contains(info, "`") {
+			continue
+		}
+
+		block := codeBlock{}
+		block.Language, block.Filename = parseInfoString(info)
+		if len(block.Filename) <= 0 && i > 0 {
+			if matches := precedingFilenameRegexp.FindStringSubmatch(strings.TrimSpace(lines[i-1])); matches != nil {
+				block.Filename = matches[1]
+			}
+		}
+
+		code := []string{}
+		for i++; i < len(lines); i++ {
+			if closesCodeFence(lines[i], fence) {
+				break
+			}
+			code = append(code, lines[i])
+		}
+		block.Code = strings.Join(code, "\n")
+
+		blocks = append(blocks, block)
+	}
+
+	return blocks
+}
+
+// parseInfoString parses language and filename hint from the info string of a code block.
+//
+// eg. "go", "go main.go", "go:main.go", "go title=main.go", "main.go"
+func parseInfoString(info string) (language, filename string) {
+	if matches := infoStringFilenameRegexp.FindStringSubmatch(info); matches != nil {
+		filename = matches[1]
+		info = strings.TrimSpace(strings.Replace(info, matches[0], "", 1))
+	}
+
+	fields := strings.Fields(info)
+	if len(fields) <= 0 {
+		return "", filename
+	}
+	language = strings.Trim(fields[0], "{}.")
+
+	if lang, name, ok := strings.Cut(language, ":"); ok {
+		language = lang
+		if len(filename) <= 0 {
+			filename = name
+		}
+	} else if len(fields) > 1 && len(filename) <= 0 && looksLikeFilename(fields[1]) {
+		filename = fields[1]
+	} else if looksLikeFilename(language) {
+		// only a filename is given (eg. "```main.go")
+		if len(filename) <= 0 {
+			filename = language
+		}
+		language = strings.TrimPrefix(filepath.Ext(language), ".")
+	}
+
+	return strings.ToLower(language), filename
+}
+
+// looksLikeFilename checks if given string looks like a filename (with an extension).
+func looksLikeFilename(str string) bool {
+	return strings.Contains(str, ".") &&
+		!strings.HasPrefix(str, ".") &&
+		!strings.HasSuffix(str, ".") &&
+		len(filepath.Ext(str)) > 1
+}
+
+// closesCodeFence checks if given line closes a code block opened with `fence`.
+func closesCodeFence(line, fence string) bool {
+	trimmed := strings.TrimSpace(line)
+	if len(line)-len(strings.TrimLeft(line, " ")) > 3 || len(trimmed) < len(fence) {
+		return false
+	}
+	return strings.Trim(trimmed, fence[:1]) == ""
+}
+
+// codeBlockFilenames returns relative filenames for given code blocks.
+//
+// Filename hints are used if they are safe (not absolute, and not escaping the directory),
+// otherwise filenames are generated from their indices and languages.
+// Duplicated filenames get numbered suffixes.
+func codeBlockFilenames(blocks []codeBlock) (filenames []string) {
+	used := map[string]bool{}
+
+	for i, block := range blocks {
+		filename := safeRelativePath(block.Filename)
+		if len(filename) <= 0 {
+			ext, exists := codeBlockExtensions[block.Language]
+			if !exists {
+				ext = defaultCodeBlockExtension
+			}
+			filename = fmt.Sprintf("%s-%02d.%s", defaultCodeBlockFilenamePrefix, i+1, ext)
+		}
+
+		// avoid duplicated filenames
+		if used[filename] {
+			ext := filepath.Ext(filename)
+			base := strings.TrimSuffix(filename, ext)
+			for n := 2; ; n++ {
+				if candidate := fmt.Sprintf("%s-%d%s", base, n, ext); !used[candidate] {
+					filename = candidate
+					break
+				}
+			}
+		}
+		used[filename] = true
+
+		filenames = append(filenames, filename)
+	}
+
+	return filenames
+}
+
+// safeRelativePath returns a cleaned relative path, or an empty string if it is not safe.
+func safeRelativePath(path string) string {
+	if len(path) <= 0 || filepath.IsAbs(path) || strings.HasPrefix(path, "~") {
+		return ""
+	}
+	cleaned := filepath.Clean(filepath.FromSlash(path))
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return ""
+	}
+	return cleaned
+}
+
+// extractCodeBlocks parses code blocks from given text and writes them to files in `dir`.
+//
+// If any of the files already exists and `overwrite` is false, nothing will be written.
+func extractCodeBlocks(
+	output *outputWriter,
+	text string,
+	dir string,
+	overwrite bool,
+	vbs []bool,
+) (extracted []extractedCodeBlock, err error) {
+	blocks := parseCodeBlocks(text)
+	if len(blocks) <= 0 {
+		output.warn("No code blocks to extract.")
+		return nil, nil
+	}
+
+	dir = expandPath(dir)
+	filenames := codeBlockFilenames(blocks)
+
+	// check existing files before writing any
+	if !overwrite {
+		existing := []string{}
+		for _, filename := range filenames {
+			fpath := filepath.Join(dir, filename)
+			if _, err := os.Stat(fpath); err == nil {
+				existing = append(existing, fpath)
+			} else if !errors.Is(err, os.ErrNotExist) {
+				return nil, fmt.Errorf("failed to check file '%s': %w", fpath, err)
+			}
+		}
+		if len(existing) > 0 {
+			return nil, fmt.Errorf(
+				"refusing to overwrite existing file(s): %s (use --overwrite-code to overwrite)",
+				strings.Join(existing, ", "),
+			)
+		}
+	}
+
+	for i, block := range blocks {
+		fpath := filepath.Join(dir, filenames[i])
+		if err := os.MkdirAll(filepath.Dir(fpath), 0o755); err != nil {
+			return extracted, fmt.Errorf("failed to create directory for '%s': %w", fpath, err)
+		}
+		if err := writeTextFile(fpath, block.Code); err != nil {
+			return extracted, fmt.Errorf("failed to write code block to '%s': %w", fpath, err)
+		}
+
+		output.verbose(
+			verboseMedium,
+			vbs,
+			"wrote code block #%d to '%s'",
+			i+1,
+			fpath,
+		)
+
+		extracted = append(extracted, extractedCodeBlock{
+			Path:     fpath,
+			Language: block.Language,
+			Lines:    strings.Count(block.Code, "\n") + 1,
+		})
+	}
+
+	return extracted, nil
+}
+
+// printCodeBlocksManifest prints the manifest of extracted code blocks.
+func printCodeBlocksManifest(
+	output *outputWriter,
+	extracted []extractedCodeBlock,
+) {
+	if len(extracted) <= 0 {
+		return
+	}
+
+	output.makeSureToEndWithNewLine()
+
+	output.printColored(
+		color.FgHiGreen,
+		"Extracted %d code block(s):\n",
+		len(extracted),
+	)
+	for _, block := range extracted {
+		language := block.Language
+		if len(language) <= 0 {
+			language = "unknown"
+		}
+		output.printColored(
+			color.FgGreen,
+			"  %s (%s, %d line(s))\n",
+			block.Path,
+			language,
+			block.Lines,
+		)
+	}
+}
@@ -0,0 +1,79 @@
+// codeblocks_test.go
+
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// test `parseCodeBlocks` with various fences and filename hints
+func TestParseCodeBlocks(t *testing.T) {
+	text := "Here is the code:\n" +
+		"\n" +
+		"**main.go**\n" +
+		"```go\n" +
+		"package main\n" +
+		"\n" +
+		"func main() {}\n" +
+		"```\n" +
+		"\n" +
+		"```python title=\"scripts/run.py\"\n" +
+		"print('hello')\n" +
+		"```\n" +
+		"\n" +
+		"````markdown\n" +
+		"```sh\n" +
+		"echo nested\n" +
+		"```\n" +
+		"````\n" +
+		"\n" +
+		"~~~rust:src/lib.rs\n" +
+		"pub fn f() {}\n" +
+		"~~~\n" +
+		"\n" +
+		"```\n" +
+		"no language\n" +
+		"```\n" +
+		"\n" +
+		"```bash\n" +
+		"echo truncated\n"
+
+	expected := []codeBlock{
+		{Language: "go", Filename: "main.go", Code: "package main\n\nfunc main() {}"},
+		{Language: "python", Filename: "scripts/run.py", Code: "print('hello')"},
+		{Language: "markdown", Code: "```sh\necho nested\n```"},
+		{Language: "rust", Filename: "src/lib.rs", Code: "pub fn f() {}"},
+		{Code: "no language"},
+		{Language: "bash", Code: "echo truncated\n"},
+	}
+
+	blocks := parseCodeBlocks(text)
+	if !slices.Equal(blocks, expected) {
+		t.Errorf("expected %+v, got %+v", expected, blocks)
+	}
+}
+
+// test `codeBlockFilenames` for generated, unsafe, and duplicated filenames
+func TestCodeBlockFilenames(t *testing.T) {
+	blocks := []codeBlock{
+		{Language: "go", Filename: "main.go"},
+		{Language: "python"},
+		{Language: "sh", Filename: "../../etc/passwd"},
+		{Language: "go", Filename: "main.go"},
+		{Language: "unknown-language"},
+	}
+
+	expected := []string{
+		"main.go",
+		"block-02.py",
+		"block-03.sh",
+		"main-2.go",
+		"block-05.txt",
+	}
+
+	filenames := codeBlockFilenames(blocks)
+	if !slices.Equal(filenames, expected) {
+		t.Errorf("expected %v, got %v", expected, filenames)
+	}
+}
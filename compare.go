@@ -0,0 +1,300 @@
+// compare.go
+//
+// things for comparing generations of multiple models with the same prompt
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// formats of comparison report
+const (
+	compareReportText     = `text`
+	compareReportMarkdown = `markdown`
+	compareReportJSON     = `json`
+)
+
+// a result of generation with a model in comparison
+type comparisonResult struct {
+	Model string `json:"model"`
+
+	Content    string `json:"content,omitempty"`
+	Thinking   string `json:"thinking,omitempty"`
+	DoneReason string `json:"done_reason,omitempty"`
+
+	LoadSeconds  float64 `json:"load_seconds"`
+	TotalSeconds float64 `json:"total_seconds"`
+
+	PromptEvalCount       int     `json:"prompt_eval_count"`
+	PromptTokensPerSecond float64 `json:"prompt_tokens_per_second"`
+	EvalCount             int     `json:"eval_count"`
+	TokensPerSecond       float64 `json:"tokens_per_second"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// a comparison report (in JSON)
+type comparisonReport struct {
+	Prompt  string             `json:"prompt"`
+	Results []comparisonResult `json:"results"`
+}
+
+// parseModelList parses comma-separated model names.
+func parseModelList(list string) (models []string) {
+	for model := range strings.SplitSeq(list, ",") {
+		if model = strings.TrimSpace(model); len(model) > 0 {
+			models = append(models, model)
+		}
+	}
+	return uniq(models)
+}
+
+// comparisonResultFrom converts given result of generation to a result of comparison.
+func comparisonResultFrom(res batchResult) comparisonResult {
+	compared := comparisonResult{
+		Model:      res.Model,
+		Content:    res.Content,
+		Thinking:   res.Thinking,
+		DoneReason: res.DoneReason,
+		Error:      res.Error,
+	}
+
+	if metrics := res.Metrics; metrics != nil {
+		compared.LoadSeconds = metrics.LoadDuration.Seconds()
+		compared.TotalSeconds = metrics.TotalDuration.Seconds()
+		compared.PromptEvalCount = metrics.PromptEvalCount
+		compared.PromptTokensPerSecond = tokensPerSecond(metrics.PromptEvalCount, metrics.PromptEvalDuration)
+		compared.EvalCount = metrics.EvalCount
+		compared.TokensPerSecond = tokensPerSecond(metrics.EvalCount, metrics.EvalDuration)
+	} else {
+		compared.TotalSeconds = float64(res.ElapsedMs) / 1000
+	}
+
+	return compared
+}
+
+// tokensPerSecond calculates tokens per second from given count and duration.
+func tokensPerSecond(count int, duration time.Duration) float64 {
+	if duration <= 0 {
+		return 0
+	}
+	return float64(count) / duration.Seconds()
+}
+
+// doCompare generates with the same prompt (with files and options) using multiple models,
+// and prints their results and metrics side by side.
+func doCompare(
+	ctx context.Context,
+	output *outputWriter,
+	conf config,
+	p params,
+) (exit int, e error) {
+	models := parseModelList(*p.Compare.Models)
+	if len(models) <= 0 {
+		return 1, fmt.Errorf("no models to compare in '%s'", *p.Compare.Models)
+	}
+
+	keepAlive, err := resolveKeepAlive(conf, p)
+	if err != nil {
+		return 1, err
+	}
+
+	// generate with each model
+	results := make([]comparisonResult, len(models))
+	// NOTE: `output` should not be used in `generate`, as it can be run concurrently
+	generate := func(i int) {
+		results[i] = comparisonResultFrom(runBatchRequest(
+			ctx,
+			conf,
+			p,
+			batchRequest{
+				ID:     models[i],
+				Prompt: *p.Generation.Prompt,
+				Model:  ptr(models[i]),
+			},
+			keepAlive,
+		))
+	}
+	if p.Compare.Concurrently {
+		output.verbose(
+			verboseMinimum,
+			p.Verbose,
+			"generating with models '%s' concurrently...",
+			strings.Join(models, "', '"),
+		)
+
+		var wg sync.WaitGroup
+		for i := range models {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				generate(i)
+			}(i)
+		}
+		wg.Wait()
+	} else {
+		for i := range models {
+			output.verbose(
+				verboseMinimum,
+				p.Verbose,
+				"generating with model '%s'...",
+				models[i],
+			)
+
+			generate(i)
+		}
+	}
+
+	// print the results
+	report := compareReportText
+	if p.Compare.Report != nil {
+		report = *p.Compare.Report
+	}
+	switch report {
+	case compareReportMarkdown:
+		fmt.Fprint(os.Stdout, comparisonToMarkdown(*p.Generation.Prompt, results))
+	case compareReportJSON:
+		marshalled, err := json.MarshalIndent(comparisonReport{
+			Prompt:  *p.Generation.Prompt,
+			Results: results,
+		}, "", "  ")
+		if err != nil {
+			return 1, fmt.Errorf("failed to marshal comparison report: %w", err)
+		}
+		fmt.Fprintln(os.Stdout, string(marshalled))
+	default:
+		printComparison(output, results)
+	}
+
+	numFailed := 0
+	for _, res := range results {
+		if len(res.Error) > 0 {
+			numFailed++
+		}
+	}
+	if numFailed > 0 {
+		return 1, fmt.Errorf("generation failed with %d of %d model(s)", numFailed, len(results))
+	}
+	return 0, nil
+}
+
+// comparisonTable returns rows (with a header) of metrics in given results.
+func comparisonTable(results []comparisonResult) (rows [][]string) {
+	rows = append(rows, []string{"model", "load", "total", "prompt eval", "eval", "tokens", "done"})
+	for _, res := range results {
+		if len(res.Error) > 0 {
+			rows = append(rows, []string{res.Model, "-", "-", "-", "-", "-", "error"})
+			continue
+		}
+		rows = append(rows, []string{
+			res.Model,
+			fmt.Sprintf("%.2fs", res.LoadSeconds),
+			fmt.Sprintf("%.2fs", res.TotalSeconds),
+			fmt.Sprintf("%.1f tok/s", res.PromptTokensPerSecond),
+			fmt.Sprintf("%.1f tok/s", res.TokensPerSecond),
+			fmt.Sprintf("%d", res.EvalCount),
+			res.DoneReason,
+		})
+	}
+	return rows
+}
+
+// printComparison prints given results and their metrics in aligned columns.
+func printComparison(
+	output *outputWriter,
+	results []comparisonResult,
+) {
+	for _, res := range results {
+		output.makeSureToEndWithNewLine()
+		output.printColored(
+			color.FgHiCyan,
+			"=== %s ===\n",
+			res.Model,
+		)
+		if len(res.Error) > 0 {
+			output.printColored(
+				color.FgRed,
+				"Error: %s\n",
+				res.Error,
+			)
+		} else {
+			output.printContent(strings.TrimSpace(res.Content) + "\n")
+			output.finishMarkdown()
+		}
+		output.println()
+	}
+
+	// metrics (aligned)
+	rows := comparisonTable(results)
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], displayWidth(cell))
+		}
+	}
+	for i, row := range rows {
+		cells := []string{}
+		for j, cell := range row {
+			if j == 0 || j == len(row)-1 {
+				cells = append(cells, padCell(cell, widths[j], ""))
+			} else {
+				cells = append(cells, padCell(cell, widths[j], "-:"))
+			}
+		}
+
+		c := color.FgHiWhite
+		if i == 0 {
+			c = color.FgWhite
+		}
+		output.printColored(
+			c,
+			"%s\n",
+			strings.TrimRight(strings.Join(cells, "  "), " "),
+		)
+	}
+}
+
+// comparisonToMarkdown generates a markdown report of given results.
+func comparisonToMarkdown(
+	prompt string,
+	results []comparisonResult,
+) string {
+	var sb strings.Builder
+
+	sb.WriteString("# Model Comparison\n\n")
+	sb.WriteString("## Prompt\n\n")
+	for line := range strings.SplitSeq(strings.TrimSpace(prompt), "\n") {
+		sb.WriteString("> " + line + "\n")
+	}
+
+	sb.WriteString("\n## Metrics\n\n")
+	for i, row := range comparisonTable(results) {
+		for j := range row {
+			row[j] = strings.ReplaceAll(row[j], "|", `\|`)
+		}
+		sb.WriteString("| " + strings.Join(row, " | ") + " |\n")
+		if i == 0 {
+			sb.WriteString("|---|---:|---:|---:|---:|---:|---|\n")
+		}
+	}
+
+	for _, res := range results {
+		sb.WriteString("\n## " + res.Model + "\n\n")
+		if len(res.Error) > 0 {
+			sb.WriteString("**Error:** " + res.Error + "\n")
+		} else {
+			sb.WriteString(strings.TrimSpace(res.Content) + "\n")
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,44 @@
+// compare_test.go
+
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// test `parseModelList` with comma-separated model names
+func TestParseModelList(t *testing.T) {
+	models := parseModelList(" gemma3:4b, qwen3.5:9b,,gemma3:4b ,")
+	expected := []string{"gemma3:4b", "qwen3.5:9b"}
+
+	if !slices.Equal(models, expected) {
+		t.Errorf("expected %v, got %v", expected, models)
+	}
+}
+
+// test `comparisonResultFrom` for calculating metrics
+func TestComparisonResultFrom(t *testing.T) {
+	compared := comparisonResultFrom(batchResult{
+		Model:   "gemma3:4b",
+		Content: "hello",
+		Metrics: &api.Metrics{
+			TotalDuration:      3 * time.Second,
+			LoadDuration:       500 * time.Millisecond,
+			PromptEvalCount:    100,
+			PromptEvalDuration: 500 * time.Millisecond,
+			EvalCount:          50,
+			EvalDuration:       2 * time.Second,
+		},
+	})
+
+	if compared.LoadSeconds != 0.5 || compared.TotalSeconds != 3 {
+		t.Errorf("unexpected durations: load=%f, total=%f", compared.LoadSeconds, compared.TotalSeconds)
+	}
+	if compared.PromptTokensPerSecond != 200 || compared.TokensPerSecond != 25 {
+		t.Errorf("unexpected rates: prompt=%f, eval=%f", compared.PromptTokensPerSecond, compared.TokensPerSecond)
+	}
+}
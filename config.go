@@ -6,8 +6,14 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ollama/ollama/api"
 )
 
 // config struct
@@ -23,6 +29,61 @@ type config struct {
 	ImageGenerationTimeoutSeconds int `json:"image_generation_timeout_seconds,omitempty"`
 
 	ReplaceHTTPURLTimeoutSeconds int `json:"replace_http_url_timeout_seconds,omitempty"`
+
+	// limits of agent loop (0 = unlimited)
+	MaxToolRounds           *int `json:"max_tool_rounds,omitempty"`
+	MaxToolCalls            int  `json:"max_tool_calls,omitempty"`
+	MaxCallsPerTool         int  `json:"max_calls_per_tool,omitempty"`
+	ToolRoundTimeoutSeconds int  `json:"tool_round_timeout_seconds,omitempty"`
+
+	// number of workers for executing tool calls in parallel
+	ToolCallWorkers int `json:"tool_call_workers,omitempty"`
+
+	// number of concurrent requests in batch
+	BatchConcurrency int `json:"batch_concurrency,omitempty"`
+
+	// how long models will stay loaded in memory (eg. '10m', '-1')
+	KeepAlive *string `json:"keep_alive,omitempty"`
+
+	// Ollama options for generation with each model (key: model name)
+	ModelOptions map[string]map[string]any `json:"model_options,omitempty"`
+
+	// limits of attached text files (eg. '512KB', '1MiB'), and what to do with files which exceed them ('skip', 'truncate', or 'fail')
+	MaxFileSize      *string `json:"max_file_size,omitempty"`
+	MaxTotalFileSize *string `json:"max_total_file_size,omitempty"`
+	FileLimitPolicy  *string `json:"file_limit_policy,omitempty"`
+
+	// also attach pages of PDF documents as PNG images (needs 'pdftoppm' from poppler)
+	RenderPDFPages bool `json:"render_pdf_pages,omitempty"`
+
+	// render generated markdown contents in terminal
+	RenderMarkdown bool `json:"render_markdown,omitempty"`
+
+	// named profiles (selected with `--profile`)
+	Profiles map[string]profile `json:"profiles,omitempty"`
+
+	// named MCP servers (enabled with `--mcp`)
+	MCPServers map[string]mcpServerConfig `json:"mcp_servers,omitempty"`
+
+	// named local tools with their callbacks (enabled with `--local-tool`)
+	LocalTools map[string]localToolConfig `json:"local_tools,omitempty"`
+}
+
+// MCP server config
+//
+// (only one of `url` and `command` should be set)
+type mcpServerConfig struct {
+	URL     *string           `json:"url,omitempty"`     // streamable HTTP URL
+	Headers map[string]string `json:"headers,omitempty"` // HTTP headers for `url` (eg. 'Authorization')
+	Command *string           `json:"command,omitempty"` // command of local stdio MCP server
+	Env     map[string]string `json:"env,omitempty"`     // environment variables for `command`
+}
+
+// local tool config
+type localToolConfig struct {
+	Definition api.Tool `json:"definition"`
+	Callback   *string  `json:"callback,omitempty"`
+	Confirm    bool     `json:"confirm,omitempty"`
 }
 
 // readConfig reads config from given filepath.
@@ -54,6 +115,96 @@ func readConfig(
 	return conf, err
 }
 
+// applyMCPServersFromConfig adds MCP servers with given names in config to params.
+func applyMCPServersFromConfig(
+	conf config,
+	names []string,
+	p *params,
+) error {
+	for _, name := range names {
+		server, exists := conf.MCPServers[name]
+		if !exists {
+			return fmt.Errorf(
+				"no such MCP server in config: '%s' (available: %s)",
+				name,
+				strings.Join(slices.Sorted(maps.Keys(conf.MCPServers)), ", "),
+			)
+		}
+
+		if server.URL != nil && server.Command == nil {
+			if len(server.Env) > 0 {
+				return fmt.Errorf("MCP server '%s' in config has `env`, which is only for `command`", name)
+			}
+
+			p.MCPTools.StreamableURLs = uniq(append(p.MCPTools.StreamableURLs, *server.URL))
+			if len(server.Headers) > 0 {
+				if p.MCPTools.Headers == nil {
+					p.MCPTools.Headers = map[string]map[string]string{}
+				}
+				p.MCPTools.Headers[*server.URL] = server.Headers
+			}
+		} else if server.Command != nil && server.URL == nil {
+			if len(server.Headers) > 0 {
+				return fmt.Errorf("MCP server '%s' in config has `headers`, which are only for `url`", name)
+			}
+
+			p.MCPTools.StdioCommands = uniq(append(p.MCPTools.StdioCommands, *server.Command))
+			if len(server.Env) > 0 {
+				if p.MCPTools.Envs == nil {
+					p.MCPTools.Envs = map[string]map[string]string{}
+				}
+				p.MCPTools.Envs[*server.Command] = server.Env
+			}
+		} else {
+			return fmt.Errorf("MCP server '%s' in config should have either `url` or `command`", name)
+		}
+	}
+
+	return nil
+}
+
+// localToolsFromConfig returns local tools with given names in config,
+// and adds their callbacks to params (if not given from command line).
+func localToolsFromConfig(
+	conf config,
+	names []string,
+	p *params,
+) (tools []api.Tool, err error) {
+	for _, name := range names {
+		tool, exists := conf.LocalTools[name]
+		if !exists {
+			return nil, fmt.Errorf(
+				"no such local tool in config: '%s' (available: %s)",
+				name,
+				strings.Join(slices.Sorted(maps.Keys(conf.LocalTools)), ", "),
+			)
+		}
+
+		// NOTE: use the name in config if the name of function is missing
+		if len(tool.Definition.Type) <= 0 {
+			tool.Definition.Type = "function"
+		}
+		if len(tool.Definition.Function.Name) <= 0 {
+			tool.Definition.Function.Name = name
+		}
+		fnName := tool.Definition.Function.Name
+		tools = append(tools, tool.Definition)
+
+		if tool.Callback != nil {
+			p.LocalTools.ToolCallbacks = mergeMissing(p.LocalTools.ToolCallbacks, map[string]string{
+				fnName: *tool.Callback,
+			})
+		}
+		if tool.Confirm {
+			p.LocalTools.ToolCallbacksConfirm = mergeMissing(p.LocalTools.ToolCallbacksConfirm, map[string]bool{
+				fnName: true,
+			})
+		}
+	}
+
+	return tools, nil
+}
+
 // resolveConfigFilepath resolves config filepath.
 func resolveConfigFilepath(
 	configFilepath *string,
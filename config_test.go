@@ -0,0 +1,127 @@
+// config_test.go
+
+package main
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ollama/ollama/api"
+)
+
+// test `applyMCPServersFromConfig`
+func TestApplyMCPServersFromConfig(t *testing.T) {
+	conf := config{
+		MCPServers: map[string]mcpServerConfig{
+			"remote": {
+				URL:     ptr("https://my-mcp-server.com/mcp"),
+				Headers: map[string]string{"Authorization": "Bearer token"},
+			},
+			"public": {
+				URL: ptr("https://public-mcp-server.com/mcp"),
+			},
+			"local": {
+				Command: ptr("/path/to/server --stdio"),
+				Env:     map[string]string{"API_KEY": "key"},
+			},
+			"both": {
+				URL:     ptr("https://my-mcp-server.com/mcp"),
+				Command: ptr("/path/to/server --stdio"),
+			},
+			"none": {},
+			"url with env": {
+				URL: ptr("https://my-mcp-server.com/mcp"),
+				Env: map[string]string{"API_KEY": "key"},
+			},
+			"command with headers": {
+				Command: ptr("/path/to/server --stdio"),
+				Headers: map[string]string{"Authorization": "Bearer token"},
+			},
+		},
+	}
+
+	var p params
+	p.MCPTools.StreamableURLs = []string{"https://public-mcp-server.com/mcp"}
+	if err := applyMCPServersFromConfig(conf, []string{"remote", "public", "local"}, &p); err != nil {
+		t.Fatalf("failed to apply MCP servers: %s", err)
+	}
+	if expected := []string{"https://public-mcp-server.com/mcp", "https://my-mcp-server.com/mcp"}; !slices.Equal(p.MCPTools.StreamableURLs, expected) {
+		t.Errorf("expected %v, got %v", expected, p.MCPTools.StreamableURLs)
+	}
+	if expected := []string{"/path/to/server --stdio"}; !slices.Equal(p.MCPTools.StdioCommands, expected) {
+		t.Errorf("expected %v, got %v", expected, p.MCPTools.StdioCommands)
+	}
+	if headers := p.MCPTools.Headers; len(headers) != 1 || headers["https://my-mcp-server.com/mcp"]["Authorization"] != "Bearer token" {
+		t.Errorf("unexpected headers: %v", headers)
+	}
+	if envs := p.MCPTools.Envs; len(envs) != 1 || envs["/path/to/server --stdio"]["API_KEY"] != "key" {
+		t.Errorf("unexpected environment variables: %v", envs)
+	}
+
+	// invalid or unknown servers
+	for _, name := range []string{"both", "none", "url with env", "command with headers", "unknown"} {
+		if err := applyMCPServersFromConfig(conf, []string{name}, &params{}); err == nil {
+			t.Errorf("expected an error for MCP server '%s'", name)
+		}
+	}
+}
+
+// test `localToolsFromConfig`
+func TestLocalToolsFromConfig(t *testing.T) {
+	conf := config{
+		LocalTools: map[string]localToolConfig{
+			"clock": {
+				Definition: api.Tool{
+					Function: api.ToolFunction{Description: "returns the current time"},
+				},
+				Callback: ptr("/path/to/clock.sh"),
+			},
+			"remove": {
+				Definition: api.Tool{
+					Type:     "function",
+					Function: api.ToolFunction{Name: "remove_dir", Description: "removes a directory"},
+				},
+				Callback: ptr("/path/to/remove.sh"),
+				Confirm:  true,
+			},
+			"declared only": {
+				Definition: api.Tool{
+					Function: api.ToolFunction{Name: "declared", Description: "has no callback"},
+				},
+			},
+		},
+	}
+
+	var p params
+	p.LocalTools.ToolCallbacks = map[string]string{"remove_dir": "/flag/remove.sh"}
+	tools, err := localToolsFromConfig(conf, []string{"clock", "remove", "declared only"}, &p)
+	if err != nil {
+		t.Fatalf("failed to get local tools: %s", err)
+	}
+
+	names := []string{}
+	for _, tool := range tools {
+		if tool.Type != "function" {
+			t.Errorf("expected type 'function', got '%s'", tool.Type)
+		}
+		names = append(names, tool.Function.Name)
+	}
+	if expected := []string{"clock", "remove_dir", "declared"}; !slices.Equal(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+
+	// callbacks from command line take precedence
+	if expected := map[string]string{"clock": "/path/to/clock.sh", "remove_dir": "/flag/remove.sh"}; !maps.Equal(p.LocalTools.ToolCallbacks, expected) {
+		t.Errorf("expected %v, got %v", expected, p.LocalTools.ToolCallbacks)
+	}
+	if expected := map[string]bool{"remove_dir": true}; !maps.Equal(p.LocalTools.ToolCallbacksConfirm, expected) {
+		t.Errorf("expected %v, got %v", expected, p.LocalTools.ToolCallbacksConfirm)
+	}
+
+	// unknown tool
+	if _, err := localToolsFromConfig(conf, []string{"unknown"}, &params{}); err == nil || !strings.Contains(err.Error(), "available: clock, declared only, remove") {
+		t.Errorf("expected an error with available tools, got %v", err)
+	}
+}
@@ -0,0 +1,456 @@
+// contextwindow.go
+//
+// things for estimating the size of prompts and handling the overflow of context window
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ollama/ollama/api"
+)
+
+// strategies for handling the overflow of context window
+const (
+	contextOverflowError         = `error`
+	contextOverflowDropOldest    = `drop-oldest`
+	contextOverflowTruncateFiles = `truncate-files`
+	contextOverflowSummarize     = `summarize`
+
+	defaultContextOverflow = contextOverflowError
+)
+
+const (
+	// NOTE: these are rough estimations, as no tokenizer is used
+	estimatedBytesPerToken    = 4    // for ASCII characters
+	estimatedTokensPerMedia   = 1024 // for each image/audio file
+	estimatedTokensPerMsg     = 4    // overhead of each message (role, delimiters, etc.)
+	reservedTokensForResp     = 1024 // reserved for the response
+	truncatedFileMarkerFormat = "\n... (truncated %d bytes)"
+
+	summarizationInstruction = `You are a summarizer of conversations.
+
+Summarize the given conversation between a user and an assistant, keeping all the facts, decisions, names, numbers, and unresolved questions which may be needed for continuing the conversation.
+Respond only with the summary.`
+	summarizedHistoryFormat = `Summary of the previous conversation:
+
+%s`
+	summarizedHistoryAck = `Understood. I will continue the conversation with this summary in mind.`
+)
+
+// estimateTokens roughly estimates the number of tokens in given text.
+//
+// NOTE: ~4 bytes per token for ASCII characters, and ~1 token per non-ASCII character
+func estimateTokens(text string) int {
+	ascii, others := 0, 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			others++
+		}
+	}
+	return (ascii+estimatedBytesPerToken-1)/estimatedBytesPerToken + others
+}
+
+// estimateMessagesTokens roughly estimates the number of tokens in given messages.
+func estimateMessagesTokens(messages []api.Message) (tokens int) {
+	for _, message := range messages {
+		tokens += estimatedTokensPerMsg
+		tokens += estimateTokens(message.Content)
+		tokens += estimateTokens(message.Thinking)
+		tokens += len(message.Images) * estimatedTokensPerMedia
+		if len(message.ToolCalls) > 0 {
+			if marshalled, err := json.Marshal(message.ToolCalls); err == nil {
+				tokens += estimateTokens(string(marshalled))
+			}
+		}
+	}
+	return tokens
+}
+
+// estimateToolsTokens roughly estimates the number of tokens in given tools.
+func estimateToolsTokens(tools []api.Tool) int {
+	if len(tools) <= 0 {
+		return 0
+	}
+	if marshalled, err := json.Marshal(tools); err == nil {
+		return estimateTokens(string(marshalled))
+	}
+	return 0
+}
+
+// contextLengthOf returns the length of context window for generation.
+//
+// The first known one of these is used:
+//
+//   - `contextWindowSize` (from params),
+//   - `num_ctx` in `options` (from config),
+//   - `num_ctx` in the parameters of model (from its Modelfile),
+//   - the model's maximum context length.
+//
+// Returns 0 if it is unknown.
+func contextLengthOf(
+	shown *api.ShowResponse,
+	contextWindowSize *int,
+	options map[string]any,
+) int {
+	if contextWindowSize != nil && *contextWindowSize > 0 {
+		return *contextWindowSize
+	}
+
+	if numCtx, ok := intValue(options["num_ctx"]); ok && numCtx > 0 {
+		return numCtx
+	}
+
+	if shown != nil {
+		for line := range strings.SplitSeq(shown.Parameters, "\n") {
+			if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "num_ctx" {
+				if numCtx, err := strconv.Atoi(fields[1]); err == nil && numCtx > 0 {
+					return numCtx
+				}
+			}
+		}
+	}
+
+	return modelContextLength(shown)
+}
+
+// modelContextLength returns the maximum context length of the model (0 if it is unknown).
+func modelContextLength(shown *api.ShowResponse) int {
+	if shown != nil {
+		for key, value := range shown.ModelInfo {
+			if strings.HasSuffix(key, ".context_length") {
+				if length, ok := intValue(value); ok {
+					return length
+				}
+			}
+		}
+	}
+
+	return 0
+}
+
+// intValue converts given numeric value (eg. from JSON) to an int.
+func intValue(value any) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	}
+	return 0, false
+}
+
+// fitToContextWindow checks if the prompt fits in the context window,
+// and handles the overflow with given strategy.
+//
+// Returns an error if the prompt still does not fit in the context window.
+func fitToContextWindow(
+	ctx context.Context,
+	client *api.Client,
+	output *outputWriter,
+	model string,
+	contextLength int,
+	strategy *string,
+	systemInstruction string,
+	history []api.Message,
+	prompt string,
+	files []promptFile,
+	numMedia int,
+	pastGenerations []api.Message,
+	tools []api.Tool,
+	vbs []bool,
+) (fittedHistory []api.Message, fittedFiles []promptFile, err error) {
+	if contextLength <= 0 {
+		output.verbose(
+			verboseMedium,
+			vbs,
+			"context length of model(%s) is unknown, skipping the check of context window",
+			model,
+		)
+
+		return history, files, nil
+	}
+
+	overflow := defaultContextOverflow
+	if strategy != nil {
+		overflow = *strategy
+	}
+
+	budget := contextLength - min(reservedTokensForResp, contextLength/4)
+	estimateWith := func(files []promptFile) int {
+		return estimateTokens(systemInstruction) +
+			estimateMessagesTokens(history) +
+			estimateTokens(buildPromptWithFiles(prompt, files)) +
+			numMedia*estimatedTokensPerMedia +
+			estimateMessagesTokens(pastGenerations) +
+			estimateToolsTokens(tools)
+	}
+	estimate := func() int {
+		return estimateWith(files)
+	}
+
+	estimated := estimate()
+	output.verbose(
+		verboseMedium,
+		vbs,
+		"estimated prompt size: ~%d tokens (context length: %d, budget: %d)",
+		estimated,
+		contextLength,
+		budget,
+	)
+	if estimated <= budget {
+		return history, files, nil
+	}
+
+	switch overflow {
+	case contextOverflowDropOldest:
+		numMessages := len(history)
+		for len(history) > 0 && estimate() > budget {
+			history = dropOldestTurn(history)
+		}
+		dropped := numMessages - len(history)
+
+		output.verbose(
+			verboseMinimum,
+			vbs,
+			"context overflow (~%d > %d tokens): dropped %d oldest message(s) of history",
+			estimated,
+			budget,
+			dropped,
+		)
+	case contextOverflowTruncateFiles:
+		var truncated int
+		files, truncated = truncateLargestFiles(files, estimateWith, budget)
+
+		output.verbose(
+			verboseMinimum,
+			vbs,
+			"context overflow (~%d > %d tokens): truncated %d byte(s) of the largest file(s)",
+			estimated,
+			budget,
+			truncated,
+		)
+	case contextOverflowSummarize:
+		if len(history) > 0 {
+			summarized, err := summarizeHistory(ctx, client, model, history, budget)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to summarize history for the overflow of context window: %w", err)
+			}
+
+			output.verbose(
+				verboseMinimum,
+				vbs,
+				"context overflow (~%d > %d tokens): summarized %d message(s) of history into ~%d tokens",
+				estimated,
+				budget,
+				len(history),
+				estimateMessagesTokens(summarized),
+			)
+
+			history = summarized
+		} else {
+			output.verbose(
+				verboseMinimum,
+				vbs,
+				"context overflow (~%d > %d tokens): no history to summarize",
+				estimated,
+				budget,
+			)
+		}
+	default:
+		// do nothing (error)
+	}
+
+	if estimated = estimate(); estimated > budget {
+		return nil, nil, fmt.Errorf(
+			"estimated prompt size (~%d tokens) exceeds the context window (%d tokens, %d reserved for the response) with strategy '%s'; try with a larger context window size (--context-window-size), another strategy (--context-overflow), or fewer files",
+			estimated,
+			contextLength,
+			contextLength-budget,
+			overflow,
+		)
+	}
+
+	output.verbose(
+		verboseMedium,
+		vbs,
+		"estimated prompt size after handling the overflow: ~%d tokens",
+		estimated,
+	)
+
+	return history, files, nil
+}
+
+// dropOldestTurn drops the oldest turn (a user message and its following non-user messages) from given history.
+func dropOldestTurn(history []api.Message) []api.Message {
+	if len(history) <= 0 {
+		return history
+	}
+
+	// drop the first message, and following messages until the next user message
+	// (for not leaving orphaned assistant/tool messages)
+	history = history[1:]
+	for len(history) > 0 && history[0].Role != "user" {
+		history = history[1:]
+	}
+	return history
+}
+
+// truncateLargestFiles truncates the largest files first, until the estimated size fits in the budget.
+//
+// Files larger than a common level are cut down to it (including the truncation marker),
+// and the level is lowered until the estimated size fits in the budget.
+// Files are always truncated from their original data, so markers are never stacked.
+//
+// `estimate` returns the estimated number of tokens of the whole prompt with given files.
+func truncateLargestFiles(
+	files []promptFile,
+	estimate func(files []promptFile) int,
+	budget int,
+) (truncatedFiles []promptFile, truncatedBytes int) {
+	sizes := make([]int, len(files))
+	for i, file := range files {
+		sizes[i] = len(file.data)
+	}
+
+	// truncateTo truncates files larger than `level` bytes to it (with markers)
+	truncateTo := func(level int) []promptFile {
+		truncated := slices.Clone(files)
+		for i, file := range files {
+			size := len(file.data)
+			if size <= level {
+				continue
+			}
+
+			keep := max(level-len(fmt.Sprintf(truncatedFileMarkerFormat, size)), 0)
+			if kept := strings.ToValidUTF8(string(file.data[:keep]), ""); len(kept) > 0 {
+				truncated[i].data = []byte(kept + fmt.Sprintf(truncatedFileMarkerFormat, size-len(kept)))
+			} else {
+				truncated[i].data = []byte{}
+			}
+		}
+		return truncated
+	}
+
+	truncatedFiles = files
+	removal := 0
+	for excess := estimate(files) - budget; excess > 0; excess = estimate(truncatedFiles) - budget {
+		// NOTE: `removal` grows on every pass, so the level always goes down
+		removal += excess * estimatedBytesPerToken
+		level := levelForRemoval(sizes, removal)
+		truncatedFiles = truncateTo(level)
+
+		if level <= 0 {
+			break // nothing left to truncate
+		}
+	}
+
+	for i, file := range truncatedFiles {
+		if sizes[i] > len(file.data) {
+			truncatedBytes += sizes[i] - len(file.data)
+		}
+	}
+
+	return truncatedFiles, truncatedBytes
+}
+
+// levelForRemoval returns the highest level of sizes which removes at least `removal` bytes
+// when all sizes above it are cut down to it.
+func levelForRemoval(sizes []int, removal int) int {
+	removed := func(level int) (sum int) {
+		for _, size := range sizes {
+			sum += max(size-level, 0)
+		}
+		return sum
+	}
+
+	low, high := 0, 0
+	for _, size := range sizes {
+		high = max(high, size)
+	}
+	for low < high {
+		mid := (low + high + 1) / 2
+		if removed(mid) >= removal {
+			low = mid
+		} else {
+			high = mid - 1
+		}
+	}
+	return low
+}
+
+// summarizeHistory summarizes given history with the model, and returns it as a new history.
+//
+// NOTE: the summary is paired with an acknowledgement of the assistant,
+// so that roles of the new history still alternate when the next user message is appended.
+func summarizeHistory(
+	ctx context.Context,
+	client *api.Client,
+	model string,
+	history []api.Message,
+	budget int,
+) (summarized []api.Message, err error) {
+	// build up the transcript of history
+	lines := []string{}
+	for _, message := range history {
+		switch {
+		case len(message.Content) > 0:
+			lines = append(lines, fmt.Sprintf("[%s]\n%s", message.Role, strings.TrimSpace(message.Content)))
+		case len(message.ToolCalls) > 0:
+			lines = append(lines, fmt.Sprintf("[%s]\n(tool calls) %s", message.Role, prettify(message.ToolCalls, true)))
+		}
+	}
+	transcript := strings.Join(lines, "\n\n")
+
+	// NOTE: keep only the latest part of the transcript if it is too long to be summarized at once
+	if maxLen := budget * estimatedBytesPerToken; len(transcript) > maxLen {
+		transcript = strings.ToValidUTF8(transcript[len(transcript)-maxLen:], "")
+	}
+
+	stream := false
+	var sb strings.Builder
+	if err = client.Chat(
+		ctx,
+		&api.ChatRequest{
+			Model: model,
+			Messages: []api.Message{
+				{
+					Role:    "system",
+					Content: summarizationInstruction,
+				},
+				{
+					Role:    "user",
+					Content: transcript,
+				},
+			},
+			Stream: &stream,
+		},
+		func(resp api.ChatResponse) error {
+			sb.WriteString(resp.Message.Content)
+			return nil
+		},
+	); err != nil {
+		return nil, err
+	}
+
+	return []api.Message{
+		{
+			Role:    "user",
+			Content: fmt.Sprintf(summarizedHistoryFormat, strings.TrimSpace(sb.String())),
+		},
+		{
+			Role:    "assistant",
+			Content: summarizedHistoryAck,
+		},
+	}, nil
+}
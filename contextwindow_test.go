@@ -0,0 +1,173 @@
+// contextwindow_test.go
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ollama/ollama/api"
+)
+
+// test `dropOldestTurn` for not leaving orphaned messages
+func TestDropOldestTurn(t *testing.T) {
+	history := []api.Message{
+		{Role: "user", Content: "first question"},
+		{Role: "assistant", Content: "calling a tool"},
+		{Role: "tool", Content: "tool result"},
+		{Role: "assistant", Content: "first answer"},
+		{Role: "user", Content: "second question"},
+		{Role: "assistant", Content: "second answer"},
+	}
+
+	dropped := dropOldestTurn(history)
+	if len(dropped) != 2 || dropped[0].Content != "second question" {
+		t.Errorf("expected history to start with the second question, got %+v", dropped)
+	}
+
+	dropped = dropOldestTurn(dropped)
+	if len(dropped) != 0 {
+		t.Errorf("expected empty history, got %+v", dropped)
+	}
+}
+
+// test `truncateLargestFiles` for truncating the largest file first
+func TestTruncateLargestFiles(t *testing.T) {
+	files := []promptFile{
+		{location: "small.txt", mimeType: "text/plain", data: []byte(strings.Repeat("a", 100))},
+		{location: "large.txt", mimeType: "text/plain", data: []byte(strings.Repeat("b", 10000))},
+	}
+	estimate := func(files []promptFile) int {
+		return estimateTokens(buildPromptWithFiles("prompt", files))
+	}
+	budget := estimate(files) - 1000
+
+	truncated, truncatedBytes := truncateLargestFiles(files, estimate, budget)
+
+	if estimate(truncated) > budget {
+		t.Errorf("expected estimated tokens <= %d, got %d", budget, estimate(truncated))
+	}
+	if len(truncated[0].data) != 100 {
+		t.Errorf("expected the small file not to be truncated, got %d bytes", len(truncated[0].data))
+	}
+	if truncatedBytes <= 0 || !strings.Contains(string(truncated[1].data), "(truncated") {
+		t.Errorf("expected the large file to be truncated with a marker, got %d bytes truncated", truncatedBytes)
+	}
+	if len(files[1].data) != 10000 {
+		t.Errorf("expected the original files not to be modified")
+	}
+}
+
+// test `truncateLargestFiles` for truncating several equal-sized files (without looping forever)
+func TestTruncateLargestFilesEqualSizes(t *testing.T) {
+	for _, content := range []string{"a", "가"} {
+		files := []promptFile{
+			{location: "a.txt", mimeType: "text/plain", data: []byte(strings.Repeat(content, 10000))},
+			{location: "b.txt", mimeType: "text/plain", data: []byte(strings.Repeat(content, 10000))},
+			{location: "c.txt", mimeType: "text/plain", data: []byte(strings.Repeat(content, 10000))},
+		}
+		estimate := func(files []promptFile) int {
+			return estimateTokens(buildPromptWithFiles("prompt", files))
+		}
+
+		for _, under := range []int{10, 1000, estimate(files) / 2} {
+			budget := estimate(files) - under
+
+			truncated, truncatedBytes := truncateLargestFiles(files, estimate, budget)
+
+			if estimate(truncated) > budget {
+				t.Errorf("[%s, -%d] expected estimated tokens <= %d, got %d", content, under, budget, estimate(truncated))
+			}
+			if truncatedBytes <= 0 {
+				t.Errorf("[%s, -%d] expected some bytes to be truncated", content, under)
+			}
+			for _, file := range truncated {
+				if diff := len(file.data) - len(truncated[0].data); diff > 8 || diff < -8 {
+					t.Errorf("[%s, -%d] expected files to be truncated evenly, got %d and %d bytes", content, under, len(truncated[0].data), len(file.data))
+				}
+				if strings.Count(string(file.data), "(truncated") > 1 {
+					t.Errorf("[%s, -%d] expected at most one marker in a file", content, under)
+				}
+			}
+		}
+	}
+}
+
+// test `levelForRemoval`
+func TestLevelForRemoval(t *testing.T) {
+	if level := levelForRemoval([]int{100, 100, 10}, 50); level != 75 {
+		t.Errorf("expected level 75, got %d", level)
+	}
+	if level := levelForRemoval([]int{100, 50}, 60); level != 45 {
+		t.Errorf("expected level 45, got %d", level)
+	}
+	if level := levelForRemoval([]int{100, 50}, 1000); level != 0 {
+		t.Errorf("expected level 0, got %d", level)
+	}
+}
+
+// test `contextLengthOf` for the precedence of context lengths
+func TestContextLengthOf(t *testing.T) {
+	shown := &api.ShowResponse{
+		Parameters: "stop \"<end>\"\nnum_ctx 8192",
+		ModelInfo: map[string]any{
+			"llama.context_length": float64(131072),
+		},
+	}
+
+	if length := contextLengthOf(shown, ptr(4096), map[string]any{"num_ctx": 16384}); length != 4096 {
+		t.Errorf("expected the context window size from params, got %d", length)
+	}
+	if length := contextLengthOf(shown, nil, map[string]any{"num_ctx": float64(16384)}); length != 16384 {
+		t.Errorf("expected num_ctx in options, got %d", length)
+	}
+	if length := contextLengthOf(shown, nil, nil); length != 8192 {
+		t.Errorf("expected num_ctx in the parameters of model, got %d", length)
+	}
+	if length := contextLengthOf(&api.ShowResponse{ModelInfo: shown.ModelInfo}, nil, nil); length != 131072 {
+		t.Errorf("expected the model's context length, got %d", length)
+	}
+	if length := contextLengthOf(nil, nil, nil); length != 0 {
+		t.Errorf("expected an unknown context length, got %d", length)
+	}
+}
+
+// test `summarizeHistory` for keeping roles of the summarized history alternating
+func TestSummarizeHistory(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req api.ChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Messages) != 2 || !strings.Contains(req.Messages[1].Content, "[user]\nfirst question") {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(api.ChatResponse{
+			Model:   req.Model,
+			Message: api.Message{Role: "assistant", Content: " the user asked a question. "},
+			Done:    true,
+		})
+	}))
+	defer server.Close()
+
+	base, _ := url.Parse(server.URL)
+	client := api.NewClient(base, server.Client())
+
+	summarized, err := summarizeHistory(context.Background(), client, "model", []api.Message{
+		{Role: "user", Content: "first question"},
+		{Role: "assistant", Content: "first answer"},
+	}, 1024)
+	if err != nil {
+		t.Fatalf("failed to summarize history: %s", err)
+	}
+
+	// (followed by the next user message)
+	if len(summarized) != 2 ||
+		summarized[0].Role != "user" || !strings.HasSuffix(summarized[0].Content, "\n\nthe user asked a question.") ||
+		summarized[1].Role != "assistant" || summarized[1].Content != summarizedHistoryAck {
+		t.Errorf("expected the summary paired with an acknowledgement, got %+v", summarized)
+	}
+}
@@ -0,0 +1,899 @@
+// documents.go
+//
+// things for converting office documents (DOCX, XLSX, PPTX, ODT) and e-books (EPUB) to texts
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// mime types of documents which can be converted to texts
+const (
+	docxMimeType = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	xlsxMimeType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	pptxMimeType = "application/vnd.openxmlformats-officedocument.presentationml.presentation"
+	odtMimeType  = "application/vnd.oasis.opendocument.text"
+	epubMimeType = "application/epub+zip"
+)
+
+var _documentMimeTypes = []string{
+	docxMimeType,
+	xlsxMimeType,
+	pptxMimeType,
+	odtMimeType,
+	epubMimeType,
+}
+
+const (
+	// max size of each (uncompressed) entry in a document (for avoiding zip bombs)
+	maxDocumentEntryBytes = 64 * 1024 * 1024
+
+	// max number of repeated cells in a row of ODT tables
+	maxRepeatedTableCells = 100
+)
+
+// documentMimeType returns the mime type of given one, and whether it is a document which can be converted to text.
+func documentMimeType(mimeType *mimetype.MIME) (string, bool) {
+	for _, supported := range _documentMimeTypes {
+		if mimeType.Is(supported) {
+			return supported, true
+		}
+	}
+	return mimeType.String(), false
+}
+
+// documentToText converts given document (of `mimeType`) to a markdown-like text.
+func documentToText(mimeType string, data []byte) (text string, err error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("failed to open document: %w", err)
+	}
+	doc := &zipDocument{
+		files: map[string]*zip.File{},
+	}
+	for _, f := range zr.File {
+		doc.files[f.Name] = f
+	}
+
+	switch mimeType {
+	case docxMimeType:
+		text, err = docxToText(doc)
+	case xlsxMimeType:
+		text, err = xlsxToText(doc)
+	case pptxMimeType:
+		text, err = pptxToText(doc)
+	case odtMimeType:
+		text, err = odtToText(doc)
+	case epubMimeType:
+		text, err = epubToText(doc)
+	default:
+		return "", fmt.Errorf("unsupported document type: %s", mimeType)
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(strings.TrimSpace(text)) <= 0 {
+		return "", fmt.Errorf("no texts found in document")
+	}
+
+	return text, nil
+}
+
+// a document which is a zip archive of xml files
+type zipDocument struct {
+	files map[string]*zip.File
+}
+
+// read reads an entry of given name from the document.
+func (d *zipDocument) read(name string) ([]byte, error) {
+	f, exists := d.files[strings.TrimPrefix(name, "/")]
+	if !exists {
+		return nil, fmt.Errorf("'%s' not found in document", name)
+	}
+	if f.UncompressedSize64 > maxDocumentEntryBytes {
+		return nil, fmt.Errorf("'%s' in document is too large (%s)", name, humanize.Bytes(f.UncompressedSize64))
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open '%s' in document: %w", name, err)
+	}
+	defer func() { _ = rc.Close() }()
+
+	data, err := io.ReadAll(io.LimitReader(rc, maxDocumentEntryBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read '%s' in document: %w", name, err)
+	}
+	if len(data) > maxDocumentEntryBytes {
+		return nil, fmt.Errorf("'%s' in document is too large", name)
+	}
+
+	return data, nil
+}
+
+// xml reads and parses an xml entry of given name from the document.
+func (d *zipDocument) xml(name string) (*xmlNode, error) {
+	data, err := d.read(name)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := parseXMLTree(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse '%s' in document: %w", name, err)
+	}
+	return root, nil
+}
+
+// relationships returns paths of parts related to given part (by relationship ids) in an OOXML document.
+func (d *zipDocument) relationships(part string) map[string]string {
+	targets := map[string]string{}
+
+	rels, err := d.xml(path.Join(path.Dir(part), "_rels", path.Base(part)+".rels"))
+	if err != nil {
+		return targets
+	}
+	for _, rel := range rels.findAll("Relationship") {
+		if rel.attr("TargetMode") == "External" {
+			continue
+		}
+		targets[rel.attr("Id")] = resolvePartPath(part, rel.attr("Target"))
+	}
+
+	return targets
+}
+
+// resolvePartPath resolves given (relative or absolute) target path from the path of `base` part.
+func resolvePartPath(base, target string) string {
+	target, _, _ = strings.Cut(target, "#")
+	if unescaped, err := url.PathUnescape(target); err == nil {
+		target = unescaped
+	}
+
+	if strings.HasPrefix(target, "/") {
+		return strings.TrimPrefix(path.Clean(target), "/")
+	}
+	return path.Join(path.Dir(base), target)
+}
+
+// a node of parsed xml tree
+type xmlNode struct {
+	name     string // local name (empty for texts)
+	attrs    []xml.Attr
+	children []*xmlNode
+
+	text string
+}
+
+// parseXMLTree parses given xml (or xhtml) data to a tree.
+func parseXMLTree(data []byte) (*xmlNode, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	dec.AutoClose = xml.HTMLAutoClose
+	dec.Entity = xml.HTMLEntity
+	dec.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil // NOTE: (best effort) treat other encodings as utf-8
+	}
+
+	root := &xmlNode{}
+	stack := []*xmlNode{root}
+	for {
+		token, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		parent := stack[len(stack)-1]
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{
+				name:  t.Name.Local,
+				attrs: t.Attr,
+			}
+			parent.children = append(parent.children, node)
+			stack = append(stack, node)
+		case xml.EndElement:
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			parent.children = append(parent.children, &xmlNode{
+				text: string(t),
+			})
+		}
+	}
+
+	return root, nil
+}
+
+// attr returns the value of an attribute with given local name.
+func (n *xmlNode) attr(local string) string {
+	for _, attr := range n.attrs {
+		if attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// relationshipID returns the value of `r:id` attribute (of OOXML documents).
+func (n *xmlNode) relationshipID() string {
+	for _, attr := range n.attrs {
+		if attr.Name.Local == "id" && strings.Contains(attr.Name.Space, "relationships") {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// find returns the first descendant node of given local name.
+func (n *xmlNode) find(name string) *xmlNode {
+	for _, child := range n.children {
+		if child.name == name {
+			return child
+		}
+		if found := child.find(name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// findAll returns all descendant nodes of given local name (in document order).
+func (n *xmlNode) findAll(name string) (found []*xmlNode) {
+	for _, child := range n.children {
+		if child.name == name {
+			found = append(found, child)
+		}
+		found = append(found, child.findAll(name)...)
+	}
+	return found
+}
+
+// innerText returns all texts of the node and its descendants.
+func (n *xmlNode) innerText() string {
+	if len(n.name) <= 0 {
+		return n.text
+	}
+
+	var sb strings.Builder
+	for _, child := range n.children {
+		sb.WriteString(child.innerText())
+	}
+	return sb.String()
+}
+
+// markdownTable formats given rows as a markdown table (the first row as its header).
+func markdownTable(rows [][]string) string {
+	width := 0
+	for _, row := range rows {
+		width = max(width, len(row))
+	}
+	if width <= 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	for i, row := range rows {
+		cells := make([]string, width)
+		for j := range cells {
+			if j < len(row) {
+				cells[j] = strings.ReplaceAll(strings.TrimSpace(row[j]), "|", `\|`)
+				cells[j] = strings.ReplaceAll(cells[j], "\n", "<br>")
+			}
+		}
+		sb.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+		if i == 0 {
+			sb.WriteString("|" + strings.Repeat("---|", width) + "\n")
+		}
+	}
+
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// appendBlock appends given block to `blocks`, joining consecutive list items with a single newline.
+func appendBlock(blocks []string, block string, isListItem, wasListItem bool) []string {
+	if isListItem && wasListItem && len(blocks) > 0 {
+		blocks[len(blocks)-1] += "\n" + block
+		return blocks
+	}
+	return append(blocks, block)
+}
+
+// trimLines trims each line of given text, and removes empty ones.
+func trimLines(text string) string {
+	lines := []string{}
+	for line := range strings.SplitSeq(text, "\n") {
+		if line = strings.TrimSpace(line); len(line) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+var _headingStyleRegexp = regexp.MustCompile(`^(?i)heading\s*([1-9])$`)
+
+// docxToText converts paragraphs (with headings and lists) and tables of a DOCX document to text.
+func docxToText(doc *zipDocument) (string, error) {
+	root, err := doc.xml("word/document.xml")
+	if err != nil {
+		return "", err
+	}
+	body := root.find("body")
+	if body == nil {
+		return "", fmt.Errorf("no body found in document")
+	}
+
+	return strings.Join(docxBlocks(body, docxHeadingLevels(doc)), "\n\n"), nil
+}
+
+// docxHeadingLevels returns levels of heading styles (by style ids) in a DOCX document.
+func docxHeadingLevels(doc *zipDocument) map[string]int {
+	levels := map[string]int{}
+
+	styles, err := doc.xml("word/styles.xml")
+	if err != nil {
+		return levels
+	}
+	for _, style := range styles.findAll("style") {
+		if style.attr("type") != "paragraph" {
+			continue
+		}
+
+		var name string
+		if n := style.find("name"); n != nil {
+			name = strings.ToLower(n.attr("val"))
+		}
+		if name == "title" {
+			levels[style.attr("styleId")] = 1
+		} else if matches := _headingStyleRegexp.FindStringSubmatch(name); matches != nil {
+			levels[style.attr("styleId")], _ = strconv.Atoi(matches[1])
+		} else if outline := style.find("outlineLvl"); outline != nil {
+			if level, err := strconv.Atoi(outline.attr("val")); err == nil && level < 9 {
+				levels[style.attr("styleId")] = level + 1
+			}
+		}
+	}
+
+	return levels
+}
+
+// docxBlocks returns blocks of texts from paragraphs and tables in given node.
+func docxBlocks(node *xmlNode, headingLevels map[string]int) (blocks []string) {
+	wasListItem := false
+	for _, child := range node.children {
+		switch child.name {
+		case "p":
+			text := trimLines(docxParagraphText(child))
+			if len(text) <= 0 {
+				continue
+			}
+
+			isListItem := false
+			if props := child.find("pPr"); props != nil {
+				var style string
+				if s := props.find("pStyle"); s != nil {
+					style = s.attr("val")
+				}
+				level, isHeading := headingLevels[style]
+				if !isHeading {
+					if matches := _headingStyleRegexp.FindStringSubmatch(style); matches != nil {
+						level, _ = strconv.Atoi(matches[1])
+						isHeading = true
+					} else if strings.EqualFold(style, "title") {
+						level, isHeading = 1, true
+					}
+				}
+
+				if isHeading {
+					text = strings.Repeat("#", max(level, 1)) + " " + strings.ReplaceAll(text, "\n", " ")
+				} else if numbering := props.find("numPr"); numbering != nil {
+					var indent int
+					if ilvl := numbering.find("ilvl"); ilvl != nil {
+						indent, _ = strconv.Atoi(ilvl.attr("val"))
+					}
+					text = strings.Repeat("  ", indent) + "- " + text
+					isListItem = true
+				}
+			}
+			blocks = appendBlock(blocks, text, isListItem, wasListItem)
+			wasListItem = isListItem
+		case "tbl":
+			rows := [][]string{}
+			for _, tr := range child.findAll("tr") {
+				row := []string{}
+				for _, tc := range tr.children {
+					if tc.name == "tc" {
+						row = append(row, strings.Join(docxBlocks(tc, headingLevels), " "))
+					}
+				}
+				rows = append(rows, row)
+			}
+			if table := markdownTable(rows); len(table) > 0 {
+				blocks = append(blocks, table)
+			}
+			wasListItem = false
+		case "sdt", "sdtContent", "customXml", "ins":
+			blocks = append(blocks, docxBlocks(child, headingLevels)...)
+			wasListItem = false
+		}
+	}
+	return blocks
+}
+
+// docxParagraphText returns the text of a paragraph in a DOCX document.
+func docxParagraphText(node *xmlNode) string {
+	var sb strings.Builder
+
+	var walk func(n *xmlNode)
+	walk = func(n *xmlNode) {
+		for _, child := range n.children {
+			switch child.name {
+			case "t":
+				sb.WriteString(child.innerText())
+			case "tab":
+				sb.WriteString("\t")
+			case "br", "cr":
+				sb.WriteString("\n")
+			case "pPr", "rPr", "delText", "instrText", "fldData":
+				// skip properties and deleted texts
+			default:
+				walk(child)
+			}
+		}
+	}
+	walk(node)
+
+	return sb.String()
+}
+
+// xlsxToText converts sheets of a XLSX document to markdown tables (with their names as headings).
+func xlsxToText(doc *zipDocument) (string, error) {
+	workbook, err := doc.xml("xl/workbook.xml")
+	if err != nil {
+		return "", err
+	}
+	rels := doc.relationships("xl/workbook.xml")
+
+	sharedStrings := []string{}
+	if shared, err := doc.xml("xl/sharedStrings.xml"); err == nil {
+		for _, si := range shared.findAll("si") {
+			sharedStrings = append(sharedStrings, xlsxStringItem(si))
+		}
+	}
+
+	blocks := []string{}
+	for _, sheet := range workbook.findAll("sheet") {
+		target, exists := rels[sheet.relationshipID()]
+		if !exists {
+			continue
+		}
+		worksheet, err := doc.xml(target)
+		if err != nil {
+			return "", err
+		}
+
+		block := "## " + sheet.attr("name") + "\n\n"
+		if table := markdownTable(xlsxRows(worksheet, sharedStrings)); len(table) > 0 {
+			block += table
+		} else {
+			block += "(empty)"
+		}
+		blocks = append(blocks, block)
+	}
+
+	return strings.Join(blocks, "\n\n"), nil
+}
+
+// xlsxStringItem returns the text of a (shared or inline) string item of a XLSX document.
+func xlsxStringItem(node *xmlNode) string {
+	var sb strings.Builder
+	for _, child := range node.children {
+		switch child.name {
+		case "t":
+			sb.WriteString(child.innerText())
+		case "r":
+			if t := child.find("t"); t != nil {
+				sb.WriteString(t.innerText())
+			}
+		}
+	}
+	return sb.String()
+}
+
+// xlsxRows returns non-empty rows of cell values in a worksheet of a XLSX document.
+func xlsxRows(worksheet *xmlNode, sharedStrings []string) (rows [][]string) {
+	for _, row := range worksheet.findAll("row") {
+		values := []string{}
+		for _, c := range row.children {
+			if c.name != "c" {
+				continue
+			}
+
+			var value string
+			switch c.attr("t") {
+			case "s":
+				if v := c.find("v"); v != nil {
+					if index, err := strconv.Atoi(strings.TrimSpace(v.innerText())); err == nil && index >= 0 && index < len(sharedStrings) {
+						value = sharedStrings[index]
+					}
+				}
+			case "inlineStr":
+				if is := c.find("is"); is != nil {
+					value = xlsxStringItem(is)
+				}
+			case "b":
+				if v := c.find("v"); v != nil {
+					value = map[bool]string{true: "TRUE", false: "FALSE"}[strings.TrimSpace(v.innerText()) == "1"]
+				}
+			default:
+				if v := c.find("v"); v != nil {
+					value = v.innerText()
+				}
+			}
+
+			column := len(values)
+			if ref := c.attr("r"); len(ref) > 0 {
+				column = columnIndex(ref)
+			}
+			for len(values) <= column {
+				values = append(values, "")
+			}
+			values[column] = value
+		}
+
+		for len(values) > 0 && len(strings.TrimSpace(values[len(values)-1])) <= 0 {
+			values = values[:len(values)-1]
+		}
+		if len(values) > 0 {
+			rows = append(rows, values)
+		}
+	}
+
+	return rows
+}
+
+// columnIndex returns the (0-based) column index of given cell reference (eg. "AB12" => 27).
+func columnIndex(ref string) (index int) {
+	for _, r := range strings.ToUpper(ref) {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		index = index*26 + int(r-'A'+1)
+	}
+	return max(index-1, 0)
+}
+
+// pptxToText converts texts and tables of slides in a PPTX document to text (with slide numbers and titles as headings).
+func pptxToText(doc *zipDocument) (string, error) {
+	presentation, err := doc.xml("ppt/presentation.xml")
+	if err != nil {
+		return "", err
+	}
+	rels := doc.relationships("ppt/presentation.xml")
+
+	blocks := []string{}
+	for i, slideID := range presentation.findAll("sldId") {
+		target, exists := rels[slideID.relationshipID()]
+		if !exists {
+			continue
+		}
+		slide, err := doc.xml(target)
+		if err != nil {
+			return "", err
+		}
+
+		title, texts := pptxSlideTexts(slide)
+		heading := fmt.Sprintf("## Slide %d", i+1)
+		if len(title) > 0 {
+			heading += ": " + title
+		}
+		blocks = append(blocks, strings.Join(append([]string{heading}, texts...), "\n\n"))
+	}
+
+	return strings.Join(blocks, "\n\n"), nil
+}
+
+// pptxSlideTexts returns the title and other texts (including tables) of a slide in a PPTX document.
+func pptxSlideTexts(slide *xmlNode) (title string, texts []string) {
+	var walk func(n *xmlNode)
+	walk = func(n *xmlNode) {
+		for _, child := range n.children {
+			switch child.name {
+			case "sp":
+				paragraphs := []string{}
+				for _, p := range child.findAll("p") {
+					if text := trimLines(drawingParagraphText(p)); len(text) > 0 {
+						paragraphs = append(paragraphs, text)
+					}
+				}
+				if len(paragraphs) <= 0 {
+					continue
+				}
+
+				if placeholder := child.find("ph"); placeholder != nil && len(title) <= 0 &&
+					(placeholder.attr("type") == "title" || placeholder.attr("type") == "ctrTitle") {
+					title = strings.ReplaceAll(strings.Join(paragraphs, " "), "\n", " ")
+				} else {
+					texts = append(texts, strings.Join(paragraphs, "\n"))
+				}
+			case "graphicFrame":
+				if tbl := child.find("tbl"); tbl != nil {
+					rows := [][]string{}
+					for _, tr := range tbl.findAll("tr") {
+						row := []string{}
+						for _, tc := range tr.findAll("tc") {
+							paragraphs := []string{}
+							for _, p := range tc.findAll("p") {
+								paragraphs = append(paragraphs, trimLines(drawingParagraphText(p)))
+							}
+							row = append(row, strings.Join(paragraphs, " "))
+						}
+						rows = append(rows, row)
+					}
+					if table := markdownTable(rows); len(table) > 0 {
+						texts = append(texts, table)
+					}
+				}
+			default: // (eg. group shapes)
+				walk(child)
+			}
+		}
+	}
+	walk(slide)
+
+	return title, texts
+}
+
+// drawingParagraphText returns the text of a paragraph in DrawingML (of PPTX documents).
+func drawingParagraphText(p *xmlNode) string {
+	var sb strings.Builder
+	for _, child := range p.children {
+		switch child.name {
+		case "r", "fld":
+			if t := child.find("t"); t != nil {
+				sb.WriteString(t.innerText())
+			}
+		case "br":
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
+
+// odtToText converts paragraphs (with headings and lists) and tables of an ODT document to text.
+func odtToText(doc *zipDocument) (string, error) {
+	content, err := doc.xml("content.xml")
+	if err != nil {
+		return "", err
+	}
+
+	var text *xmlNode
+	if body := content.find("body"); body != nil {
+		text = body.find("text")
+	}
+	if text == nil {
+		return "", fmt.Errorf("no body found in document")
+	}
+
+	return strings.Join(odtBlocks(text), "\n\n"), nil
+}
+
+// odtBlocks returns blocks of texts from paragraphs, lists, and tables in given node.
+func odtBlocks(node *xmlNode) (blocks []string) {
+	for _, child := range node.children {
+		switch child.name {
+		case "h":
+			if text := strings.ReplaceAll(trimLines(odtText(child)), "\n", " "); len(text) > 0 {
+				level, err := strconv.Atoi(child.attr("outline-level"))
+				if err != nil {
+					level = 1
+				}
+				blocks = append(blocks, strings.Repeat("#", max(level, 1))+" "+text)
+			}
+		case "p":
+			if text := trimLines(odtText(child)); len(text) > 0 {
+				blocks = append(blocks, text)
+			}
+		case "list":
+			items := []string{}
+			for _, item := range child.children {
+				if item.name != "list-item" && item.name != "list-header" {
+					continue
+				}
+				for i, block := range odtBlocks(item) {
+					for j, line := range strings.Split(block, "\n") {
+						if i == 0 && j == 0 {
+							items = append(items, "- "+line)
+						} else {
+							items = append(items, "  "+line)
+						}
+					}
+				}
+			}
+			if len(items) > 0 {
+				blocks = append(blocks, strings.Join(items, "\n"))
+			}
+		case "table":
+			rows := [][]string{}
+			for _, tr := range child.findAll("table-row") {
+				row := []string{}
+				for _, tc := range tr.children {
+					if tc.name != "table-cell" && tc.name != "covered-table-cell" {
+						continue
+					}
+
+					cell := strings.Join(odtBlocks(tc), " ")
+					repeat, err := strconv.Atoi(tc.attr("number-columns-repeated"))
+					if err != nil || repeat < 1 {
+						repeat = 1
+					}
+					for range min(repeat, maxRepeatedTableCells) {
+						row = append(row, cell)
+					}
+				}
+				for len(row) > 0 && len(strings.TrimSpace(row[len(row)-1])) <= 0 {
+					row = row[:len(row)-1]
+				}
+				rows = append(rows, row)
+			}
+			if table := markdownTable(rows); len(table) > 0 {
+				blocks = append(blocks, table)
+			}
+		case "section", "index-body", "table-of-content", "alphabetical-index", "illustration-index":
+			blocks = append(blocks, odtBlocks(child)...)
+		}
+	}
+	return blocks
+}
+
+// odtText returns the text of a paragraph or heading in an ODT document.
+func odtText(node *xmlNode) string {
+	var sb strings.Builder
+	for _, child := range node.children {
+		switch child.name {
+		case "":
+			sb.WriteString(child.text)
+		case "s":
+			count, err := strconv.Atoi(child.attr("c"))
+			if err != nil || count < 1 {
+				count = 1
+			}
+			sb.WriteString(strings.Repeat(" ", count))
+		case "tab":
+			sb.WriteString("\t")
+		case "line-break":
+			sb.WriteString("\n")
+		case "note", "annotation", "bookmark-ref":
+			// skip footnotes and comments
+		default:
+			sb.WriteString(odtText(child))
+		}
+	}
+	return sb.String()
+}
+
+// epubToText converts chapters of an EPUB document to text (in reading order, separated with horizontal rules).
+func epubToText(doc *zipDocument) (string, error) {
+	container, err := doc.xml("META-INF/container.xml")
+	if err != nil {
+		return "", err
+	}
+	rootfile := container.find("rootfile")
+	if rootfile == nil || len(rootfile.attr("full-path")) <= 0 {
+		return "", fmt.Errorf("no package document found in EPUB")
+	}
+	packagePath := rootfile.attr("full-path")
+	pkg, err := doc.xml(packagePath)
+	if err != nil {
+		return "", err
+	}
+
+	type manifestItem struct {
+		href      string
+		mediaType string
+	}
+	manifest := map[string]manifestItem{}
+	for _, item := range pkg.findAll("item") {
+		manifest[item.attr("id")] = manifestItem{
+			href:      resolvePartPath(packagePath, item.attr("href")),
+			mediaType: item.attr("media-type"),
+		}
+	}
+
+	blocks := []string{}
+	if title := pkg.find("title"); title != nil {
+		if text := strings.TrimSpace(title.innerText()); len(text) > 0 {
+			blocks = append(blocks, "# "+text)
+		}
+	}
+	for _, itemref := range pkg.findAll("itemref") {
+		item, exists := manifest[itemref.attr("idref")]
+		if !exists || !strings.Contains(item.mediaType, "html") {
+			continue
+		}
+		chapter, err := doc.xml(item.href)
+		if err != nil {
+			return "", err
+		}
+
+		body := chapter.find("body")
+		if body == nil {
+			body = chapter
+		}
+		if text := xhtmlToText(body); len(text) > 0 {
+			blocks = append(blocks, text)
+		}
+	}
+
+	return strings.Join(blocks, "\n\n---\n\n"), nil
+}
+
+var _whitespacesRegexp = regexp.MustCompile(`\s+`)
+
+// xhtmlToText converts given xhtml node to a markdown-like text (with headings and list items).
+func xhtmlToText(node *xmlNode) string {
+	blocks := []string{}
+	var inline strings.Builder
+	flush := func(prefix string) {
+		text := trimLines(inline.String())
+		if len(prefix) > 0 && prefix[0] == '#' { // (headings in a single line)
+			text = strings.ReplaceAll(text, "\n", " ")
+		}
+		if len(text) > 0 {
+			blocks = append(blocks, prefix+text)
+		}
+		inline.Reset()
+	}
+
+	var walk func(n *xmlNode)
+	walk = func(n *xmlNode) {
+		for _, child := range n.children {
+			switch child.name {
+			case "":
+				inline.WriteString(_whitespacesRegexp.ReplaceAllString(child.text, " "))
+			case "script", "style", "head", "title":
+				// skip
+			case "br":
+				inline.WriteString("\n")
+			case "h1", "h2", "h3", "h4", "h5", "h6":
+				flush("")
+				walk(child)
+				level, _ := strconv.Atoi(child.name[1:])
+				flush(strings.Repeat("#", level) + " ")
+			case "li":
+				flush("")
+				walk(child)
+				flush("- ")
+			case "td", "th":
+				walk(child)
+				inline.WriteString(" ")
+			case "p", "div", "section", "article", "blockquote", "pre", "tr", "table", "ul", "ol", "dl", "dt", "dd", "figure", "figcaption", "hr":
+				flush("")
+				walk(child)
+				flush("")
+			default:
+				walk(child)
+			}
+		}
+	}
+	walk(node)
+	flush("")
+
+	return strings.Join(blocks, "\n\n")
+}
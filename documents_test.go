@@ -0,0 +1,166 @@
+// documents_test.go
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// buildTestDocument builds a zip document with given entries (in order).
+func buildTestDocument(entries [][2]string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		method := zip.Deflate
+		if entry[0] == "mimetype" { // (should be stored uncompressed)
+			method = zip.Store
+		}
+		f, _ := w.CreateHeader(&zip.FileHeader{Name: entry[0], Method: method})
+		_, _ = f.Write([]byte(entry[1]))
+	}
+	_ = w.Close()
+	return buf.Bytes()
+}
+
+const testOOXMLRelationships = `xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"`
+
+// test `documentMimeType` and `documentToText` for converting documents to texts
+func TestDocumentToText(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		entries  [][2]string
+		expected []string
+	}{
+		{
+			name: "docx",
+			entries: [][2]string{
+				{"[Content_Types].xml", `<Types/>`},
+				{"word/styles.xml", `<w:styles xmlns:w="w"><w:style w:type="paragraph" w:styleId="Berschrift1"><w:name w:val="heading 1"/></w:style></w:styles>`},
+				{"word/document.xml", `<w:document xmlns:w="w"><w:body>
+<w:p><w:pPr><w:pStyle w:val="Berschrift1"/></w:pPr><w:r><w:t>Intro</w:t></w:r></w:p>
+<w:p><w:r><w:t xml:space="preserve">Hello, </w:t></w:r><w:r><w:t>world</w:t></w:r><w:del><w:r><w:delText>deleted</w:delText></w:r></w:del></w:p>
+<w:p><w:pPr><w:numPr><w:ilvl w:val="0"/></w:numPr></w:pPr><w:r><w:t>first</w:t></w:r></w:p>
+<w:p><w:pPr><w:numPr><w:ilvl w:val="1"/></w:numPr></w:pPr><w:r><w:t>second</w:t></w:r></w:p>
+<w:tbl><w:tr><w:tc><w:p><w:r><w:t>a</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>b|c</w:t></w:r></w:p></w:tc></w:tr></w:tbl>
+</w:body></w:document>`},
+			},
+			expected: []string{
+				"# Intro\n\nHello, world\n\n- first\n  - second\n\n| a | b\\|c |\n|---|---|",
+			},
+		},
+		{
+			name: "xlsx",
+			entries: [][2]string{
+				{"[Content_Types].xml", `<Types/>`},
+				{"xl/workbook.xml", `<workbook ` + testOOXMLRelationships + `><sheets><sheet name="Scores" sheetId="1" r:id="rId1"/><sheet name="Empty" sheetId="2" r:id="rId2"/></sheets></workbook>`},
+				{"xl/_rels/workbook.xml.rels", `<Relationships><Relationship Id="rId1" Target="worksheets/sheet1.xml"/><Relationship Id="rId2" Target="/xl/worksheets/sheet2.xml"/></Relationships>`},
+				{"xl/sharedStrings.xml", `<sst><si><t>name</t></si><si><r><t>sco</t></r><r><t>re</t></r></si><si><t>kim</t></si></sst>`},
+				{"xl/worksheets/sheet1.xml", `<worksheet><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c></row>
+<row r="2"><c r="A2" t="s"><v>2</v></c><c r="C2"><v>42</v></c></row>
+<row r="3"><c r="A3" t="inlineStr"><is><t>lee</t></is></c><c r="B3" t="b"><v>1</v></c></row>
+</sheetData></worksheet>`},
+				{"xl/worksheets/sheet2.xml", `<worksheet><sheetData/></worksheet>`},
+			},
+			expected: []string{
+				"## Scores\n\n| name | score |  |\n|---|---|---|\n| kim |  | 42 |\n| lee | TRUE |  |",
+				"## Empty\n\n(empty)",
+			},
+		},
+		{
+			name: "pptx",
+			entries: [][2]string{
+				{"[Content_Types].xml", `<Types/>`},
+				{"ppt/presentation.xml", `<p:presentation xmlns:p="p" ` + testOOXMLRelationships + `><p:sldIdLst><p:sldId id="256" r:id="rId2"/><p:sldId id="257" r:id="rId1"/></p:sldIdLst></p:presentation>`},
+				{"ppt/_rels/presentation.xml.rels", `<Relationships><Relationship Id="rId1" Target="slides/slide1.xml"/><Relationship Id="rId2" Target="slides/slide2.xml"/></Relationships>`},
+				{"ppt/slides/slide1.xml", `<p:sld xmlns:p="p" xmlns:a="a"><p:cSld><p:spTree><p:sp><p:txBody><a:p><a:r><a:t>no title</a:t></a:r></a:p></p:txBody></p:sp></p:spTree></p:cSld></p:sld>`},
+				{"ppt/slides/slide2.xml", `<p:sld xmlns:p="p" xmlns:a="a"><p:cSld><p:spTree>
+<p:sp><p:nvSpPr><p:nvPr><p:ph type="title"/></p:nvPr></p:nvSpPr><p:txBody><a:p><a:r><a:t>Agenda</a:t></a:r></a:p></p:txBody></p:sp>
+<p:grpSp><p:sp><p:txBody><a:p><a:r><a:t>one</a:t></a:r></a:p><a:p><a:r><a:t>two</a:t></a:r></a:p></p:txBody></p:sp></p:grpSp>
+</p:spTree></p:cSld></p:sld>`},
+			},
+			expected: []string{
+				"## Slide 1: Agenda\n\none\ntwo",
+				"## Slide 2\n\nno title",
+			},
+		},
+		{
+			name: "odt",
+			entries: [][2]string{
+				{"mimetype", odtMimeType},
+				{"content.xml", `<office:document-content xmlns:office="o" xmlns:text="t"><office:body><office:text>
+<text:h text:outline-level="2">Chapter</text:h>
+<text:p>a<text:s text:c="2"/>b<text:note><text:note-body><text:p>footnote</text:p></text:note-body></text:note></text:p>
+<text:list><text:list-item><text:p>item</text:p></text:list-item></text:list>
+</office:text></office:body></office:document-content>`},
+			},
+			expected: []string{
+				"## Chapter\n\na  b\n\n- item",
+			},
+		},
+		{
+			name: "epub",
+			entries: [][2]string{
+				{"mimetype", epubMimeType},
+				{"META-INF/container.xml", `<container><rootfiles><rootfile full-path="OEBPS/content.opf"/></rootfiles></container>`},
+				{"OEBPS/content.opf", `<package><metadata><dc:title xmlns:dc="dc">The Book</dc:title></metadata>
+<manifest><item id="c1" href="text/ch%201.xhtml" media-type="application/xhtml+xml"/><item id="css" href="style.css" media-type="text/css"/></manifest>
+<spine><itemref idref="c1"/><itemref idref="css"/></spine></package>`},
+				{"OEBPS/text/ch 1.xhtml", `<html><head><title>ignored</title></head><body><h1>First
+Chapter</h1><p>Some&nbsp;text<br/>next   line</p><ul><li>x</li><li>y</li></ul></body></html>`},
+			},
+			expected: []string{
+				"# The Book\n\n---\n\n# First Chapter\n\nSome text\nnext line\n\n- x\n\n- y",
+			},
+		},
+	} {
+		data := buildTestDocument(tc.entries)
+
+		matched, isDocument := documentMimeType(mimetype.Detect(data))
+		if !isDocument {
+			t.Errorf("[%s] expected to be detected as a document, got '%s'", tc.name, matched)
+			continue
+		}
+
+		text, err := documentToText(matched, data)
+		if err != nil {
+			t.Errorf("[%s] failed to convert document: %s", tc.name, err)
+			continue
+		}
+		if expected := strings.Join(tc.expected, "\n\n"); text != expected {
+			t.Errorf("[%s] expected '%s', got '%s'", tc.name, expected, text)
+		}
+	}
+
+	// not a document
+	if _, isDocument := documentMimeType(mimetype.Detect([]byte("hello"))); isDocument {
+		t.Errorf("expected plain text not to be a document")
+	}
+
+	// document without texts
+	if _, err := documentToText(docxMimeType, buildTestDocument([][2]string{
+		{"[Content_Types].xml", `<Types/>`},
+		{"word/document.xml", `<w:document xmlns:w="w"><w:body/></w:document>`},
+	})); err == nil {
+		t.Errorf("expected an error for document without texts")
+	}
+}
+
+// test `columnIndex`
+func TestColumnIndex(t *testing.T) {
+	for ref, expected := range map[string]int{
+		"A1":   0,
+		"C12":  2,
+		"Z3":   25,
+		"AB12": 27,
+	} {
+		if index := columnIndex(ref); index != expected {
+			t.Errorf("expected %d for '%s', got %d", expected, ref, index)
+		}
+	}
+}
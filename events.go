@@ -0,0 +1,212 @@
+// events.go
+//
+// things for machine-readable output (NDJSON events, and the final result in JSON)
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/ollama/ollama/api"
+)
+
+// output formats
+type outputFormat string
+
+const (
+	outputFormatText   outputFormat = `text`
+	outputFormatNDJSON outputFormat = `ndjson`
+	outputFormatJSON   outputFormat = `json`
+)
+
+// reasons of exit (in the final result)
+const (
+	exitReasonDone         = `done`
+	exitReasonLimitReached = `limit_reached`
+	exitReasonError        = `error`
+)
+
+// types of output events
+const (
+	eventThinking    = `thinking`
+	eventContent     = `content`
+	eventToolCall    = `tool_call`
+	eventToolResult  = `tool_result`
+	eventToolSkipped = `tool_skipped`
+	eventDone        = `done`
+	eventError       = `error`
+)
+
+// an output event (printed as a line of NDJSON)
+type outputEvent struct {
+	Type string `json:"type"`
+
+	Model string `json:"model,omitempty"`
+
+	// for thinking/content
+	Delta string `json:"delta,omitempty"`
+
+	// for tool calls
+	Name      string  `json:"name,omitempty"`
+	Arguments any     `json:"arguments,omitempty"`
+	Result    *string `json:"result,omitempty"`
+	Status    string  `json:"status,omitempty"`
+	Reason    string  `json:"reason,omitempty"`
+
+	// for done
+	DoneReason string       `json:"done_reason,omitempty"`
+	Metrics    *api.Metrics `json:"metrics,omitempty"`
+
+	// for error
+	Error string `json:"error,omitempty"`
+}
+
+// the final result (printed as a JSON object at the end, in JSON format)
+type outputResult struct {
+	Model    string `json:"model,omitempty"`
+	Content  string `json:"content,omitempty"`
+	Thinking string `json:"thinking,omitempty"`
+
+	ToolCalls []outputResultToolCall `json:"tool_calls,omitempty"`
+
+	DoneReason string       `json:"done_reason,omitempty"`
+	Metrics    *api.Metrics `json:"metrics,omitempty"` // NOTE: summed up over all rounds of generation
+
+	Embeddings any                 `json:"embeddings,omitempty"`
+	Images     []outputResultImage `json:"images,omitempty"`
+	Models     any                 `json:"models,omitempty"`
+
+	CodeBlocks []extractedCodeBlock `json:"code_blocks,omitempty"`
+
+	ExitCode   int    `json:"exit_code"`
+	ExitReason string `json:"exit_reason"`
+	Error      string `json:"error,omitempty"`
+}
+
+// a tool call in the final result
+type outputResultToolCall struct {
+	Name      string  `json:"name"`
+	Arguments any     `json:"arguments,omitempty"`
+	Status    string  `json:"status,omitempty"`
+	Result    *string `json:"result,omitempty"`
+	Reason    string  `json:"reason,omitempty"`
+}
+
+// a generated image in the final result
+type outputResultImage struct {
+	Path string `json:"path"`
+	Seed int    `json:"seed"`
+}
+
+// machineReadable checks if the output is in a machine-readable format.
+//
+// (in that case, stdout is reserved for machine-readable output, and other things are printed to stderr)
+func (w *outputWriter) machineReadable() bool {
+	return w.format != outputFormatText
+}
+
+// emit prints given event as a line of NDJSON to stdout (in NDJSON format),
+// or accumulates it to the final result (in JSON format).
+func (w *outputWriter) emit(event outputEvent) {
+	switch w.format {
+	case outputFormatNDJSON:
+		if marshalled, err := json.Marshal(event); err == nil {
+			fmt.Fprintln(os.Stdout, string(marshalled))
+		} else {
+			w.error("Failed to marshal output event: %s", err)
+		}
+	case outputFormatJSON:
+		w.result.accumulate(event)
+	}
+}
+
+// emitError prints given error string to stderr, and emits it as an error event too.
+func (w *outputWriter) emitError(
+	format string,
+	a ...any,
+) {
+	w.error(format, a...)
+
+	w.emit(outputEvent{
+		Type:  eventError,
+		Error: fmt.Sprintf(format, a...),
+	})
+}
+
+// accumulate accumulates given event to the final result.
+func (r *outputResult) accumulate(event outputEvent) {
+	switch event.Type {
+	case eventThinking:
+		r.Thinking += event.Delta
+	case eventContent:
+		r.Content += event.Delta
+	case eventToolCall:
+		r.ToolCalls = append(r.ToolCalls, outputResultToolCall{
+			Name:      event.Name,
+			Arguments: event.Arguments,
+		})
+	case eventToolResult, eventToolSkipped:
+		// NOTE: results are emitted in the order of tool calls
+		for i := range r.ToolCalls {
+			if call := &r.ToolCalls[i]; call.Name == event.Name && len(call.Status) <= 0 {
+				if event.Type == eventToolResult {
+					call.Status = toolCallStatusCalled
+					call.Result = event.Result
+				} else {
+					call.Status = event.Status
+					call.Reason = event.Reason
+				}
+				break
+			}
+		}
+	case eventDone:
+		r.Model = event.Model
+		r.DoneReason = event.DoneReason
+		if event.Metrics != nil {
+			if r.Metrics == nil {
+				r.Metrics = &api.Metrics{}
+			}
+			r.Metrics.TotalDuration += event.Metrics.TotalDuration
+			r.Metrics.LoadDuration += event.Metrics.LoadDuration
+			r.Metrics.PromptEvalCount += event.Metrics.PromptEvalCount
+			r.Metrics.PromptEvalDuration += event.Metrics.PromptEvalDuration
+			r.Metrics.EvalCount += event.Metrics.EvalCount
+			r.Metrics.EvalDuration += event.Metrics.EvalDuration
+		}
+	case eventError:
+		r.Error = event.Error
+	}
+}
+
+// printResult prints the final result as a JSON object to stdout (only in JSON format).
+func (w *outputWriter) printResult(
+	exit int,
+	err error,
+) {
+	if w.format != outputFormatJSON {
+		return
+	}
+
+	w.result.ExitCode = exit
+	if err != nil {
+		w.result.Error = err.Error()
+		if errors.Is(err, errAgentLoopStopped) {
+			w.result.ExitReason = exitReasonLimitReached
+		} else {
+			w.result.ExitReason = exitReasonError
+		}
+	} else if exit != 0 {
+		w.result.ExitReason = exitReasonError
+	} else {
+		w.result.ExitReason = exitReasonDone
+	}
+
+	if marshalled, err := json.MarshalIndent(w.result, "", "  "); err == nil {
+		fmt.Fprintln(os.Stdout, string(marshalled))
+	} else {
+		w.error("Failed to marshal output result: %s", err)
+	}
+}
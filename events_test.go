@@ -0,0 +1,142 @@
+// events_test.go
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ollama/ollama/api"
+)
+
+// test `outputResult.accumulate` for accumulating events into the final result
+func TestOutputResultAccumulate(t *testing.T) {
+	var r outputResult
+
+	for _, event := range []outputEvent{
+		{Type: eventThinking, Delta: "let me "},
+		{Type: eventThinking, Delta: "think"},
+		{Type: eventToolCall, Name: "fn_a"},
+		{Type: eventToolCall, Name: "fn_a"},
+		{Type: eventToolCall, Name: "fn_b"},
+		{Type: eventToolResult, Name: "fn_a", Result: ptr("first")},
+		{Type: eventToolSkipped, Name: "fn_a", Status: toolCallStatusSkipped, Reason: "declined"},
+		{Type: eventToolResult, Name: "fn_b", Result: ptr("third")},
+		{Type: eventDone, Model: "model", DoneReason: "stop", Metrics: &api.Metrics{EvalCount: 3}},
+		{Type: eventContent, Delta: "hello, "},
+		{Type: eventContent, Delta: "world"},
+		{Type: eventDone, Model: "model", DoneReason: "stop", Metrics: &api.Metrics{EvalCount: 4}},
+	} {
+		r.accumulate(event)
+	}
+
+	if r.Thinking != "let me think" {
+		t.Errorf("expected thinking to be accumulated, got '%s'", r.Thinking)
+	}
+	if r.Content != "hello, world" {
+		t.Errorf("expected content to be accumulated, got '%s'", r.Content)
+	}
+	if len(r.ToolCalls) != 3 {
+		t.Fatalf("expected 3 tool calls, got %d", len(r.ToolCalls))
+	}
+	if r.ToolCalls[0].Status != toolCallStatusCalled || r.ToolCalls[0].Result == nil || *r.ToolCalls[0].Result != "first" {
+		t.Errorf("expected the first tool call to be called with its result, got %+v", r.ToolCalls[0])
+	}
+	if r.ToolCalls[1].Status != toolCallStatusSkipped || r.ToolCalls[1].Reason != "declined" {
+		t.Errorf("expected the second tool call to be skipped, got %+v", r.ToolCalls[1])
+	}
+	if r.ToolCalls[2].Result == nil || *r.ToolCalls[2].Result != "third" {
+		t.Errorf("expected the third tool call to have its result, got %+v", r.ToolCalls[2])
+	}
+	if r.Metrics == nil || r.Metrics.EvalCount != 7 {
+		t.Errorf("expected metrics to be summed up, got %+v", r.Metrics)
+	}
+}
+
+// captureStdout returns what was printed to stdout while running given function.
+func captureStdout(t *testing.T, fn func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	captured := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		captured <- string(data)
+	}()
+
+	fn()
+
+	_ = w.Close()
+	return <-captured
+}
+
+// test the stream of NDJSON events (generated contents, tool calls, done, and errors) against the golden output
+func TestOutputEventsNDJSON(t *testing.T) {
+	output := newOutputWriter()
+	output.format = outputFormatNDJSON
+
+	stream := captureStdout(t, func() {
+		output.emit(outputEvent{Type: eventThinking, Delta: "hmm"})
+		output.emit(outputEvent{Type: eventContent, Delta: "let me check"})
+
+		calls := []api.ToolCall{
+			testToolCall("format", `{"text": "hi"}`),
+			testToolCall("unknown", `{}`),
+		}
+		if _, _, err := executeToolCalls(
+			context.Background(),
+			config{},
+			output,
+			calls,
+			nil,
+			false, true, false,
+			1,
+			map[string]string{
+				"format": fnCallbackFormatter + "=FORMATTED",
+			},
+			nil,
+			nil,
+			newAgentLoop(agentLoopLimits{}),
+			nil,
+		); err != nil {
+			t.Errorf("failed to execute tool calls: %s", err)
+		}
+
+		output.emit(outputEvent{Type: eventDone, Model: "model", DoneReason: "stop"})
+
+		// (as a failed generation in chat)
+		output.emitError("Generation failed: %s", errors.New("connection refused"))
+	})
+
+	golden := strings.Join([]string{
+		`{"type":"thinking","delta":"hmm"}`,
+		`{"type":"content","delta":"let me check"}`,
+		`{"type":"tool_call","name":"format","arguments":{"text":"hi"}}`,
+		`{"type":"tool_call","name":"unknown","arguments":{}}`,
+		`{"type":"tool_result","name":"format","result":"FORMATTED"}`,
+		`{"type":"tool_skipped","name":"unknown","status":"unhandled","reason":"Function 'unknown({})' was not called: no callback for the function."}`,
+		`{"type":"done","model":"model","done_reason":"stop"}`,
+		`{"type":"error","error":"Generation failed: connection refused"}`,
+	}, "\n") + "\n"
+	if stream != golden {
+		t.Errorf("unexpected stream of events:\n%s\nexpected:\n%s", stream, golden)
+	}
+
+	// (nothing is emitted in text format)
+	output.format = outputFormatText
+	if stream := captureStdout(t, func() {
+		output.emit(outputEvent{Type: eventContent, Delta: "hello"})
+		output.emitError("Generation failed: %s", errors.New("connection refused"))
+	}); len(stream) > 0 {
+		t.Errorf("expected no events in text format, got '%s'", stream)
+	}
+}
@@ -0,0 +1,371 @@
+// filefilter.go
+//
+// things for filtering files in directories (with .gitignore, .ollignore, and include/exclude globs)
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	gitIgnoreFilename = ".gitignore"
+	ollIgnoreFilename = ".ollignore"
+	gitDirname        = ".git"
+)
+
+// names of ignore files (in the order of precedence: latter ones take precedence)
+var _ignoreFilenames = []string{
+	gitIgnoreFilename,
+	ollIgnoreFilename,
+}
+
+// a pattern in ignore files (in .gitignore format), or in include/exclude globs
+type ignorePattern struct {
+	source string // eg. '/path/to/.gitignore', '--exclude'
+
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// filter for files in directories
+type fileFilter struct {
+	root string // root directory for include/exclude globs
+	top  string // top directory for ignore files (root of git repository, or `root`)
+
+	ignorePatterns map[string][]*ignorePattern // key: directory which has ignore files
+
+	includes []*ignorePattern
+	excludes []*ignorePattern
+}
+
+// compileIgnorePattern compiles a line in .gitignore format.
+//
+// Returns false if the line is empty or a comment.
+//
+// https://git-scm.com/docs/gitignore#_pattern_format
+func compileIgnorePattern(line, source string) (pattern *ignorePattern, ok bool) {
+	line = strings.TrimSuffix(line, "\r")
+
+	// trailing spaces are ignored unless they are escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if len(line) <= 0 || strings.HasPrefix(line, "#") {
+		return nil, false
+	}
+
+	pattern = &ignorePattern{
+		source: source,
+	}
+
+	if strings.HasPrefix(line, "!") {
+		pattern.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		pattern.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if len(line) <= 0 {
+		return nil, false
+	}
+
+	// patterns with a slash (not at the end) are relative to the directory of the ignore file
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	expr := globToRegexp(line)
+	if anchored {
+		expr = "^" + expr + "$"
+	} else {
+		expr = "^(?:.*/)?" + expr + "$"
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, false
+	}
+	pattern.re = re
+
+	return pattern, true
+}
+
+// globToRegexp converts given glob (in .gitignore format) to a regular expression.
+func globToRegexp(glob string) string {
+	var sb strings.Builder
+
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				if i+2 < len(glob) && glob[i+2] == '/' { // '**/': zero or more directories
+					sb.WriteString("(?:.*/)?")
+					i += 2
+				} else { // '**': everything
+					sb.WriteString(".*")
+					i++
+				}
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			if end := strings.IndexByte(glob[i+1:], ']'); end > 0 {
+				class := glob[i+1 : i+1+end]
+				if strings.HasPrefix(class, "!") {
+					class = "^" + class[1:]
+				}
+				sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+				i += end + 1
+			} else {
+				sb.WriteString(`\[`)
+			}
+		case '\\':
+			if i+1 < len(glob) {
+				sb.WriteString(regexp.QuoteMeta(string(glob[i+1])))
+				i++
+			}
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	return sb.String()
+}
+
+// matches checks if given relative path (with slashes) matches the pattern.
+func (p *ignorePattern) matches(relPath string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	return p.re.MatchString(relPath)
+}
+
+// newFileFilter returns a new filter for files in `root` directory.
+//
+// Ignore files in the ancestor directories (up to the root of git repository, if any) are also loaded.
+func newFileFilter(
+	root string,
+	includes, excludes []string,
+) (filter *fileFilter, err error) {
+	if filter, err = newGlobFileFilter(root, includes, excludes); err != nil {
+		return nil, err
+	}
+	root = filter.root
+
+	// find the root of git repository
+	for dir := root; ; dir = filepath.Dir(dir) {
+		if stat, err := os.Stat(filepath.Join(dir, gitDirname)); err == nil && stat.IsDir() {
+			filter.top = dir
+			break
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			break
+		}
+	}
+
+	// load ignore files from the top to the root
+	rel, err := filepath.Rel(filter.top, root)
+	if err != nil {
+		return nil, err
+	}
+	dir := filter.top
+	if err := filter.loadIgnoreFiles(dir); err != nil {
+		return nil, err
+	}
+	if rel != "." {
+		for name := range strings.SplitSeq(rel, string(filepath.Separator)) {
+			dir = filepath.Join(dir, name)
+			if err := filter.loadIgnoreFiles(dir); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return filter, nil
+}
+
+// newGlobFileFilter returns a new filter for files in `root` directory, with include/exclude globs only.
+func newGlobFileFilter(
+	root string,
+	includes, excludes []string,
+) (filter *fileFilter, err error) {
+	if root, err = filepath.Abs(root); err != nil {
+		return nil, err
+	}
+
+	filter = &fileFilter{
+		root:           root,
+		top:            root,
+		ignorePatterns: map[string][]*ignorePattern{},
+	}
+
+	// include/exclude globs
+	for _, glob := range includes {
+		if pattern, ok := compileIgnorePattern(glob, "--include"); ok {
+			filter.includes = append(filter.includes, pattern)
+		} else {
+			return nil, fmt.Errorf("invalid glob for --include: '%s'", glob)
+		}
+	}
+	for _, glob := range excludes {
+		if pattern, ok := compileIgnorePattern(glob, "--exclude"); ok {
+			filter.excludes = append(filter.excludes, pattern)
+		} else {
+			return nil, fmt.Errorf("invalid glob for --exclude: '%s'", glob)
+		}
+	}
+
+	return filter, nil
+}
+
+// forArchive returns a new filter for entries in given archive (as a virtual directory),
+// with the same include/exclude globs.
+//
+// (ignore files in the archive should be added with `addIgnoreFile`)
+func (f *fileFilter) forArchive(archivePath string) (*fileFilter, error) {
+	root, err := filepath.Abs(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	root += archivePathSuffix
+
+	return &fileFilter{
+		root:           root,
+		top:            root,
+		ignorePatterns: map[string][]*ignorePattern{},
+		includes:       f.includes,
+		excludes:       f.excludes,
+	}, nil
+}
+
+// loadIgnoreFiles loads ignore files in given directory (if they exist, and are not loaded yet).
+func (f *fileFilter) loadIgnoreFiles(dir string) error {
+	if _, loaded := f.ignorePatterns[dir]; loaded {
+		return nil
+	}
+
+	patterns := []*ignorePattern{}
+	for _, name := range _ignoreFilenames {
+		fpath := filepath.Join(dir, name)
+
+		file, err := os.Open(fpath)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return fmt.Errorf("failed to open ignore file '%s': %w", fpath, err)
+		}
+
+		read, err := readIgnorePatterns(file, fpath)
+		_ = file.Close()
+		if err != nil {
+			return err
+		}
+		patterns = append(patterns, read...)
+	}
+	f.ignorePatterns[dir] = patterns
+
+	return nil
+}
+
+// addIgnoreFile adds patterns of an ignore file (which is not on the disk, eg. in an archive) in given directory.
+//
+// (ignore files should be added in the order of `_ignoreFilenames`)
+func (f *fileFilter) addIgnoreFile(dir string, r io.Reader, source string) error {
+	patterns, err := readIgnorePatterns(r, source)
+	if err != nil {
+		return err
+	}
+	f.ignorePatterns[dir] = append(f.ignorePatterns[dir], patterns...)
+
+	return nil
+}
+
+// readIgnorePatterns reads patterns from an ignore file.
+func readIgnorePatterns(r io.Reader, source string) (patterns []*ignorePattern, err error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if pattern, ok := compileIgnorePattern(scanner.Text(), source); ok {
+			patterns = append(patterns, pattern)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ignore file '%s': %w", source, err)
+	}
+
+	return patterns, nil
+}
+
+// ignored checks if given path should be ignored, and returns the reason.
+//
+// (ignore files of directories should be loaded before checking paths in them)
+func (f *fileFilter) ignored(path string, isDir bool) (ignored bool, reason string) {
+	abs, err := filepath.Abs(path)
+	if err != nil || abs == f.root {
+		return false, ""
+	}
+
+	// exclude globs
+	if rel, err := filepath.Rel(f.root, abs); err == nil {
+		rel = filepath.ToSlash(rel)
+		for _, pattern := range f.excludes {
+			if pattern.matches(rel, isDir) {
+				return true, pattern.source
+			}
+		}
+	}
+
+	// ignore files (patterns in deeper directories, and latter lines take precedence)
+	dirs := []string{}
+	for dir := filepath.Dir(abs); ; dir = filepath.Dir(dir) {
+		dirs = append([]string{dir}, dirs...)
+		if dir == f.top || filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	for _, dir := range dirs {
+		rel, err := filepath.Rel(dir, abs)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+
+		for _, pattern := range f.ignorePatterns[dir] {
+			if pattern.matches(rel, isDir) {
+				ignored = !pattern.negate
+				reason = pattern.source
+			}
+		}
+	}
+	if ignored {
+		return true, reason
+	}
+
+	// include globs (only for files)
+	if !isDir && len(f.includes) > 0 {
+		if rel, err := filepath.Rel(f.root, abs); err == nil {
+			rel = filepath.ToSlash(rel)
+			for _, pattern := range f.includes {
+				if pattern.matches(rel, false) {
+					return false, ""
+				}
+			}
+		}
+		return true, "--include"
+	}
+
+	return false, ""
+}
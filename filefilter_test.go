@@ -0,0 +1,153 @@
+// filefilter_test.go
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// test `compileIgnorePattern` for matching paths in .gitignore format
+func TestCompileIgnorePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		matches bool
+	}{
+		{"*.log", "debug.log", false, true},
+		{"*.log", "logs/debug.log", false, true},
+		{"*.log", "debug.log.txt", false, false},
+		{"/build", "build", true, true},
+		{"/build", "src/build", true, false},
+		{"logs/", "logs", true, true},
+		{"logs/", "logs", false, false},
+		{"doc/*.txt", "doc/notes.txt", false, true},
+		{"doc/*.txt", "doc/server/arch.txt", false, false},
+		{"doc/**/*.txt", "doc/server/arch.txt", false, true},
+		{"doc/**/*.txt", "doc/notes.txt", false, true},
+		{"**/foo", "a/b/foo", false, true},
+		{"abc/**", "abc/x/y", false, true},
+		{"file?.go", "file1.go", false, true},
+		{"file[0-9].go", "filea.go", false, false},
+		{"file[!0-9].go", "filea.go", false, true},
+		{`\#hash`, "#hash", false, true},
+	}
+	for _, test := range tests {
+		pattern, ok := compileIgnorePattern(test.pattern, "test")
+		if !ok {
+			t.Errorf("failed to compile pattern '%s'", test.pattern)
+			continue
+		}
+		if matches := pattern.matches(test.path, test.isDir); matches != test.matches {
+			t.Errorf("expected '%s' matching '%s' (dir: %t) to be %t, got %t", test.pattern, test.path, test.isDir, test.matches, matches)
+		}
+	}
+
+	// comments and empty lines
+	for _, line := range []string{"", "   ", "# comment", "/"} {
+		if _, ok := compileIgnorePattern(line, "test"); ok {
+			t.Errorf("expected '%s' not to be compiled", line)
+		}
+	}
+
+	// negation
+	if pattern, ok := compileIgnorePattern("!important.log", "test"); !ok || !pattern.negate {
+		t.Errorf("expected negated pattern")
+	}
+}
+
+// test `fileFilter` with nested ignore files, negations, and include/exclude globs
+func TestFileFilter(t *testing.T) {
+	root := t.TempDir()
+	for path, content := range map[string]string{
+		".git/HEAD":         "ref: refs/heads/main\n",
+		".gitignore":        "*.log\n!keep.log\nsecrets/\n",
+		".ollignore":        "docs/drafts/\n",
+		"sub/.gitignore":    "*.tmp\n!*.log\n",
+		"main.go":           "package main\n",
+		"main_test.go":      "package main\n",
+		"debug.log":         "log\n",
+		"keep.log":          "log\n",
+		"secrets/key":       "key\n",
+		"docs/README.md":    "readme\n",
+		"docs/drafts/a.md":  "draft\n",
+		"sub/a.tmp":         "tmp\n",
+		"sub/b.log":         "log\n",
+		"sub/c.go":          "package sub\n",
+		"sub/deep/d.tmp":    "tmp\n",
+		"other/skipped.tmp": "tmp\n",
+	} {
+		fpath := filepath.Join(root, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(fpath), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fpath, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filter, err := newFileFilter(root, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create filter: %s", err)
+	}
+	for _, dir := range []string{"sub", "sub/deep", "docs"} {
+		if err := filter.loadIgnoreFiles(filepath.Join(root, filepath.FromSlash(dir))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for path, expected := range map[string]bool{
+		"main.go":           false,
+		"debug.log":         true,
+		"keep.log":          false,
+		"secrets":           true,
+		"docs/drafts":       true,
+		"docs/README.md":    false,
+		"sub/a.tmp":         true,
+		"sub/b.log":         false,
+		"sub/c.go":          false,
+		"sub/deep/d.tmp":    true,
+		"other/skipped.tmp": false,
+	} {
+		fpath := filepath.Join(root, filepath.FromSlash(path))
+		stat, err := os.Stat(fpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ignored, _ := filter.ignored(fpath, stat.IsDir()); ignored != expected {
+			t.Errorf("expected '%s' to be ignored: %t, got %t", path, expected, ignored)
+		}
+	}
+
+	// ignore files in the ancestor directories are also applied
+	subFilter, err := newFileFilter(filepath.Join(root, "sub"), nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create filter: %s", err)
+	}
+	if ignored, _ := subFilter.ignored(filepath.Join(root, "sub", "a.tmp"), false); !ignored {
+		t.Errorf("expected 'sub/a.tmp' to be ignored")
+	}
+
+	// include/exclude globs
+	globFilter, err := newFileFilter(root, []string{"*.go"}, []string{"*_test.go", "sub/"})
+	if err != nil {
+		t.Fatalf("failed to create filter: %s", err)
+	}
+	for path, expected := range map[string]bool{
+		"main.go":        false,
+		"main_test.go":   true,
+		"docs/README.md": true,
+		"docs":           false,
+		"sub":            true,
+	} {
+		fpath := filepath.Join(root, filepath.FromSlash(path))
+		stat, err := os.Stat(fpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ignored, _ := globFilter.ignored(fpath, stat.IsDir()); ignored != expected {
+			t.Errorf("expected '%s' to be ignored with globs: %t, got %t", path, expected, ignored)
+		}
+	}
+}
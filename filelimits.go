@@ -0,0 +1,406 @@
+// filelimits.go
+//
+// things for limiting sizes of attached files, and detecting binary-looking or minified files
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dustin/go-humanize"
+	"github.com/fatih/color"
+)
+
+// policies for files which exceed limits
+const (
+	fileLimitPolicySkip     = `skip`
+	fileLimitPolicyTruncate = `truncate`
+	fileLimitPolicyFail     = `fail`
+)
+
+// statuses of attached files
+const (
+	attachedFileStatusAttached  = `attached`
+	attachedFileStatusTruncated = `truncated`
+	attachedFileStatusMedia     = `media`
+	attachedFileStatusSkipped   = `skipped`
+)
+
+const (
+	// number of bytes to check for detecting binary-looking files
+	binaryDetectionSampleBytes = 8 * 1024
+
+	// (files with lines longer than this on average will be treated as minified)
+	minifiedAverageLineLength = 1000
+	minifiedMinimumBytes      = 4 * 1024
+)
+
+// options for attached files
+type fileOptions struct {
+	// limits of attached text files
+	MaxFileBytes  int64 // 0 = unlimited
+	MaxTotalBytes int64 // 0 = unlimited
+	Policy        string
+
+	// render pages of PDF documents to images (for vision models)
+	RenderPDFPages bool
+	renderedPages  *pdfPagesCache // (shared between copies of options, so pages are rendered only once)
+
+	// only report files which would be attached (without rendering pages of PDF documents)
+	DryRun bool
+}
+
+// an attached file and its status (for reporting)
+type attachedFile struct {
+	Location string
+	MimeType string
+
+	Size     int64 // original size
+	Attached int64 // size of attached bytes
+
+	Status string
+	Reason string // reason why it was skipped or truncated
+}
+
+// parseByteSize parses given size string (eg. '512KB', '1MiB', '1048576') to bytes.
+func parseByteSize(size string) (int64, error) {
+	parsed, err := humanize.ParseBytes(strings.TrimSpace(size))
+	if err != nil {
+		return 0, fmt.Errorf("invalid size: '%s' (should be like '512KB', '1MiB', or a number of bytes)", size)
+	}
+	return int64(parsed), nil
+}
+
+// fileOptionsFrom returns options for attached files from params and config.
+//
+// (params take precedence over config)
+func fileOptionsFrom(conf config, p params) (opts fileOptions, err error) {
+	opts.Policy = fileLimitPolicySkip
+	opts.RenderPDFPages = conf.RenderPDFPages || p.Generation.Files.RenderPDFPages
+	if opts.RenderPDFPages {
+		opts.renderedPages = newPDFPagesCache()
+	}
+
+	maxFileSize, maxTotalSize, policy := conf.MaxFileSize, conf.MaxTotalFileSize, conf.FileLimitPolicy
+	if p.Generation.Files.MaxFileSize != nil {
+		maxFileSize = p.Generation.Files.MaxFileSize
+	}
+	if p.Generation.Files.MaxTotalFileSize != nil {
+		maxTotalSize = p.Generation.Files.MaxTotalFileSize
+	}
+	if p.Generation.Files.FileLimitPolicy != nil {
+		policy = p.Generation.Files.FileLimitPolicy
+	}
+
+	if maxFileSize != nil {
+		if opts.MaxFileBytes, err = parseByteSize(*maxFileSize); err != nil {
+			return opts, fmt.Errorf("failed to parse max file size: %w", err)
+		}
+	}
+	if maxTotalSize != nil {
+		if opts.MaxTotalBytes, err = parseByteSize(*maxTotalSize); err != nil {
+			return opts, fmt.Errorf("failed to parse max total file size: %w", err)
+		}
+	}
+	if policy != nil {
+		switch *policy {
+		case fileLimitPolicySkip, fileLimitPolicyTruncate, fileLimitPolicyFail:
+			opts.Policy = *policy
+		default:
+			return opts, fmt.Errorf("invalid file limit policy: '%s' (should be one of: %s, %s, %s)", *policy, fileLimitPolicySkip, fileLimitPolicyTruncate, fileLimitPolicyFail)
+		}
+	}
+
+	return opts, nil
+}
+
+// readLimit returns the number of bytes to read from a text file (0 = unlimited),
+// when `total` bytes of text files are already attached.
+//
+// (at least `binaryDetectionSampleBytes` bytes are read, for detecting binary-looking files)
+func (o fileOptions) readLimit(total int64) int64 {
+	if o.MaxFileBytes <= 0 && o.MaxTotalBytes <= 0 {
+		return 0
+	}
+
+	limit := o.MaxFileBytes
+	if o.MaxTotalBytes > 0 {
+		if remaining := max(o.MaxTotalBytes-total, 0); limit <= 0 || remaining < limit {
+			limit = remaining
+		}
+	}
+	return max(limit, binaryDetectionSampleBytes)
+}
+
+// readFileUpTo reads given file (or an entry in an archive) up to `limit` bytes (0 = unlimited), and returns its original size.
+func readFileUpTo(path string, limit int64) (data []byte, size int64, err error) {
+	f, size, err := openFile(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open file for prompt: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var r io.Reader = f
+	if limit > 0 && size > limit {
+		r = io.LimitReader(f, limit)
+	}
+	if data, err = io.ReadAll(r); err != nil {
+		return nil, 0, fmt.Errorf("failed to read file for prompt: %w", err)
+	}
+
+	return data, size, nil
+}
+
+// looksBinary checks if given data looks like a binary (has NUL bytes, or too many control/invalid characters).
+func looksBinary(data []byte) bool {
+	sample := data[:min(len(data), binaryDetectionSampleBytes)]
+	if bytes.IndexByte(sample, 0) >= 0 {
+		return true
+	}
+
+	runes, suspicious := 0, 0
+	for len(sample) > 0 {
+		r, size := utf8.DecodeRune(sample)
+		if r == utf8.RuneError && size <= 1 {
+			if len(sample) < utf8.UTFMax && !utf8.FullRune(sample) { // (cut in the middle of a rune)
+				break
+			}
+			suspicious++
+		} else if r < 0x20 && r != '\t' && r != '\n' && r != '\r' && r != '\f' && r != '\v' && r != 0x1b {
+			suspicious++
+		}
+		runes++
+		sample = sample[size:]
+	}
+
+	return runes > 0 && suspicious*10 > runes // more than 10%
+}
+
+// looksMinified checks if given file looks minified (by its name, or by its average line length).
+func looksMinified(location string, data []byte) bool {
+	if strings.Contains(strings.ToLower(location), ".min.") {
+		return true
+	}
+	if len(data) < minifiedMinimumBytes {
+		return false
+	}
+
+	lines := bytes.Count(data, []byte("\n")) + 1
+	return len(data)/lines > minifiedAverageLineLength
+}
+
+// truncateWithMarker truncates given data (at a valid UTF-8 boundary), and appends a marker which tells it was truncated.
+//
+// The result (including the marker) fits in `limit` bytes, or it will be nil if even the marker does not fit.
+func truncateWithMarker(data []byte, limit, size int64) []byte {
+	for keep := limit; keep >= 0; {
+		truncated := data[:min(int64(len(data)), keep)]
+		for i := 0; i < utf8.UTFMax && len(truncated) > 0; i++ {
+			if r, s := utf8.DecodeLastRune(truncated); r != utf8.RuneError || s > 1 {
+				break
+			}
+			truncated = truncated[:len(truncated)-1]
+		}
+
+		marker := fmt.Sprintf(
+			"\n... (truncated: %s of %s)",
+			humanize.Bytes(uint64(len(truncated))),
+			humanize.Bytes(uint64(size)),
+		)
+		if int64(len(truncated)+len(marker)) <= limit {
+			return append(append([]byte{}, truncated...), []byte(marker)...)
+		}
+
+		// NOTE: length of the marker changes with the truncated size, so retry with the remaining bytes
+		keep = min(int64(len(truncated))-1, limit-int64(len(marker)))
+	}
+	return nil
+}
+
+// apply applies limits to given (text) file data, and adds the attached size to `total`.
+//
+// Returned data will be nil if the file should be skipped.
+func (o fileOptions) apply(
+	location string,
+	data []byte,
+	size int64,
+	total *int64,
+) (limited []byte, file attachedFile, err error) {
+	file = attachedFile{
+		Location: location,
+		Size:     size,
+	}
+
+	// binary-looking or minified files
+	if looksBinary(data) {
+		file.Reason = "binary"
+	} else if looksMinified(location, data) {
+		file.Reason = "minified"
+	}
+	if len(file.Reason) > 0 {
+		if o.Policy == fileLimitPolicyFail {
+			return nil, file, fmt.Errorf("file '%s' looks %s", location, file.Reason)
+		}
+		file.Status = attachedFileStatusSkipped
+		return nil, file, nil
+	}
+
+	// size limits
+	limit := size
+	if o.MaxFileBytes > 0 && limit > o.MaxFileBytes {
+		limit = o.MaxFileBytes
+		file.Reason = "file size limit"
+	}
+	if o.MaxTotalBytes > 0 && *total+limit > o.MaxTotalBytes {
+		limit = max(o.MaxTotalBytes-*total, 0)
+		file.Reason = "total size limit"
+	}
+	if len(file.Reason) > 0 {
+		switch o.Policy {
+		case fileLimitPolicyFail:
+			return nil, file, fmt.Errorf(
+				"file '%s' (%s) exceeds the %s",
+				location,
+				humanize.Bytes(uint64(size)),
+				file.Reason,
+			)
+		case fileLimitPolicyTruncate:
+			// NOTE: the appended marker is also counted
+			if limited = truncateWithMarker(data, limit, size); limited != nil {
+				file.Status = attachedFileStatusTruncated
+				file.Attached = int64(len(limited))
+				*total += file.Attached
+				return limited, file, nil
+			}
+		}
+		file.Status = attachedFileStatusSkipped
+		return nil, file, nil
+	}
+
+	file.Status = attachedFileStatusAttached
+	file.Attached = size
+	*total += size
+
+	return data, file, nil
+}
+
+// attachedFilesTable returns lines of a table (with a header and a footer) of given attached files.
+func attachedFilesTable(files []attachedFile) (lines []string) {
+	rows := [][]string{{"file", "type", "size", "attached", "status"}}
+	var totalSize, totalAttached int64
+	for _, file := range files {
+		status := file.Status
+		if len(file.Reason) > 0 {
+			status += " (" + file.Reason + ")"
+		}
+		rows = append(rows, []string{
+			file.Location,
+			file.MimeType,
+			humanize.Bytes(uint64(file.Size)),
+			humanize.Bytes(uint64(file.Attached)),
+			status,
+		})
+		totalSize += file.Size
+		totalAttached += file.Attached
+	}
+	rows = append(rows, []string{
+		fmt.Sprintf("(%d file(s))", len(files)),
+		"",
+		humanize.Bytes(uint64(totalSize)),
+		humanize.Bytes(uint64(totalAttached)),
+		"",
+	})
+
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], displayWidth(cell))
+		}
+	}
+	for _, row := range rows {
+		cells := []string{}
+		for i, cell := range row {
+			if i == 2 || i == 3 {
+				cells = append(cells, padCell(cell, widths[i], "-:"))
+			} else {
+				cells = append(cells, padCell(cell, widths[i], ""))
+			}
+		}
+		lines = append(lines, strings.TrimRight(strings.Join(cells, "  "), " "))
+	}
+
+	return lines
+}
+
+// reportAttachedFiles warns about skipped or truncated files,
+// and prints a table of attached files in verbose output.
+func reportAttachedFiles(
+	output *outputWriter,
+	files []attachedFile,
+	vbs []bool,
+) {
+	for _, file := range files {
+		switch file.Status {
+		case attachedFileStatusSkipped:
+			output.warn("skipped file '%s' (%s): %s", file.Location, humanize.Bytes(uint64(file.Size)), file.Reason)
+		case attachedFileStatusTruncated:
+			output.warn("truncated file '%s' (%s) to %s: %s", file.Location, humanize.Bytes(uint64(file.Size)), humanize.Bytes(uint64(file.Attached)), file.Reason)
+		}
+	}
+
+	if len(files) > 0 && verboseLevel(vbs) >= verboseMinimum {
+		output.verbose(
+			verboseMinimum,
+			vbs,
+			"attached files:",
+		)
+		for _, line := range attachedFilesTable(files) {
+			output.verbose(
+				verboseMinimum,
+				vbs,
+				"%s",
+				line,
+			)
+		}
+	}
+}
+
+// doDryRunFiles prints files which would be attached (with limits applied), and their total size.
+func doDryRunFiles(
+	output *outputWriter,
+	filepaths []*string,
+	fileOpts fileOptions,
+) (exit int, e error) {
+	if len(filepaths) <= 0 {
+		output.printColored(
+			color.FgHiRed,
+			"no files would be attached.\n",
+		)
+		return 0, nil
+	}
+
+	fileOpts.DryRun = true
+
+	_, _, files, err := readPromptFiles(nil, filepaths, fileOpts)
+	if err != nil {
+		return 1, err
+	}
+
+	for i, line := range attachedFilesTable(files) {
+		c := color.FgHiWhite
+		if i == 0 || i == len(files)+1 {
+			c = color.FgGreen
+		}
+		output.printColored(
+			c,
+			"%s\n",
+			line,
+		)
+	}
+
+	return 0, nil
+}
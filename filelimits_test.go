@@ -0,0 +1,140 @@
+// filelimits_test.go
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// test `looksBinary` and `looksMinified` for detecting files which should not be attached
+func TestLooksBinaryOrMinified(t *testing.T) {
+	if looksBinary([]byte("package main\n\nfunc main() {\n\tprintln(\"hello, 世界\")\n}\n")) {
+		t.Errorf("expected source code not to look binary")
+	}
+	if !looksBinary([]byte("PK\x03\x04\x00\x00binary")) {
+		t.Errorf("expected data with NUL bytes to look binary")
+	}
+	if !looksBinary([]byte("\x01\x02\x03\x04\x05\x06abc")) {
+		t.Errorf("expected data with many control characters to look binary")
+	}
+	if looksBinary([]byte("한글" + string([]byte("\xed\x95")))) { // (cut in the middle of a rune)
+		t.Errorf("expected text cut in the middle of a rune not to look binary")
+	}
+
+	if !looksMinified("dist/app.min.js", []byte("var a=1;")) {
+		t.Errorf("expected '.min.js' file to look minified")
+	}
+	if !looksMinified("app.js", []byte(strings.Repeat("var a=1;", 1000))) {
+		t.Errorf("expected a long single line to look minified")
+	}
+	if looksMinified("README.md", []byte(strings.Repeat("some line of text\n", 1000))) {
+		t.Errorf("expected normal text not to look minified")
+	}
+}
+
+// test `fileOptions.apply` with policies
+func TestFileLimitsApply(t *testing.T) {
+	data := []byte(strings.Repeat("line\n", 20)) // 100 bytes
+
+	// no limits
+	var total int64
+	limited, file, err := fileOptions{Policy: fileLimitPolicySkip}.apply("a.txt", data, 100, &total)
+	if err != nil || string(limited) != string(data) || file.Status != attachedFileStatusAttached || total != 100 {
+		t.Errorf("expected file to be attached as is, got status: %s, total: %d, err: %v", file.Status, total, err)
+	}
+
+	// skip
+	total = 0
+	limited, file, err = fileOptions{MaxFileBytes: 50, Policy: fileLimitPolicySkip}.apply("a.txt", data, 100, &total)
+	if err != nil || limited != nil || file.Status != attachedFileStatusSkipped || file.Reason != "file size limit" || total != 0 {
+		t.Errorf("expected file to be skipped, got status: %s (%s), total: %d, err: %v", file.Status, file.Reason, total, err)
+	}
+
+	// truncate
+	total = 0
+	limited, file, err = fileOptions{MaxFileBytes: 50, Policy: fileLimitPolicyTruncate}.apply("a.txt", data, 100, &total)
+	if kept, _, found := strings.Cut(string(limited), "\n... (truncated: "); err != nil || !found || len(kept) <= 0 || !strings.HasPrefix(string(data), kept) {
+		t.Errorf("expected file to be truncated, got '%s', err: %v", string(limited), err)
+	}
+	if file.Attached != int64(len(limited)) || len(limited) > 50 || total != file.Attached { // (marker is also counted)
+		t.Errorf("expected at most 50 bytes with the marker to be attached, got %d (total: %d)", len(limited), total)
+	}
+
+	// fail
+	total = 0
+	if _, _, err = (fileOptions{MaxFileBytes: 50, Policy: fileLimitPolicyFail}).apply("a.txt", data, 100, &total); err == nil {
+		t.Errorf("expected an error with fail policy")
+	}
+
+	// total limit (truncated to the remaining size)
+	total = 150
+	limited, file, err = fileOptions{MaxTotalBytes: 200, Policy: fileLimitPolicyTruncate}.apply("b.txt", data, 100, &total)
+	if err != nil || file.Status != attachedFileStatusTruncated || file.Reason != "total size limit" || file.Attached != int64(len(limited)) || total > 200 {
+		t.Errorf("expected file to be truncated by total limit, got status: %s (%s), total: %d, err: %v", file.Status, file.Reason, total, err)
+	}
+	limited, file, _ = fileOptions{MaxTotalBytes: 200, Policy: fileLimitPolicyTruncate}.apply("c.txt", data, 100, &total)
+	if limited != nil || file.Status != attachedFileStatusSkipped {
+		t.Errorf("expected file to be skipped when total limit is reached, got status: %s", file.Status)
+	}
+
+	// binary-looking files are skipped regardless of size limits
+	total = 0
+	_, file, _ = fileOptions{Policy: fileLimitPolicyTruncate}.apply("a.bin", []byte("\x00\x01\x02"), 3, &total)
+	if file.Status != attachedFileStatusSkipped || file.Reason != "binary" {
+		t.Errorf("expected binary file to be skipped, got status: %s (%s)", file.Status, file.Reason)
+	}
+}
+
+// test `truncateWithMarker` for not breaking UTF-8 characters
+func TestTruncateWithMarker(t *testing.T) {
+	data := []byte(strings.Repeat("가", 20)) // (each character is 3 bytes)
+
+	truncated := truncateWithMarker(data, 62, 60)
+	if !strings.HasPrefix(string(truncated), strings.Repeat("가", 10)+"\n... (truncated: ") || !utf8.Valid(truncated) || len(truncated) > 62 {
+		t.Errorf("expected truncated at the rune boundary within the limit, got '%s'", string(truncated))
+	}
+
+	// too small for the marker
+	if truncated := truncateWithMarker(data, 10, 60); truncated != nil {
+		t.Errorf("expected nil when the marker does not fit, got '%s'", string(truncated))
+	}
+}
+
+// test `fileOptions.readLimit`
+func TestFileOptionsReadLimit(t *testing.T) {
+	for _, tc := range []struct {
+		opts     fileOptions
+		total    int64
+		expected int64
+	}{
+		{opts: fileOptions{}, total: 100, expected: 0},
+		{opts: fileOptions{MaxFileBytes: 1024 * 1024}, total: 100, expected: 1024 * 1024},
+		{opts: fileOptions{MaxTotalBytes: 1024 * 1024}, total: 1024, expected: 1024*1024 - 1024},
+		{opts: fileOptions{MaxFileBytes: 1024 * 1024, MaxTotalBytes: 2 * 1024 * 1024}, total: 1024 * 1024 * 3 / 2, expected: 1024 * 1024 / 2},
+		{opts: fileOptions{MaxFileBytes: 1024 * 1024, MaxTotalBytes: 2 * 1024 * 1024}, total: 0, expected: 1024 * 1024},
+		{opts: fileOptions{MaxTotalBytes: 1024 * 1024}, total: 1024 * 1024, expected: binaryDetectionSampleBytes},
+		{opts: fileOptions{MaxFileBytes: 10}, total: 0, expected: binaryDetectionSampleBytes},
+	} {
+		if limit := tc.opts.readLimit(tc.total); limit != tc.expected {
+			t.Errorf("expected %d for %+v with total %d, got %d", tc.expected, tc.opts, tc.total, limit)
+		}
+	}
+}
+
+// test `parseByteSize`
+func TestParseByteSize(t *testing.T) {
+	for given, expected := range map[string]int64{
+		"1024":  1024,
+		"512KB": 512 * 1000,
+		"1MiB":  1024 * 1024,
+	} {
+		if parsed, err := parseByteSize(given); err != nil || parsed != expected {
+			t.Errorf("expected %d for '%s', got %d (err: %v)", expected, given, parsed, err)
+		}
+	}
+	if _, err := parseByteSize("lots"); err == nil {
+		t.Errorf("expected an error for invalid size")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"maps"
 	"math/rand/v2"
 	"os"
 	"path/filepath"
@@ -18,7 +19,6 @@ import (
 	"text/template"
 	"time"
 
-	"github.com/dustin/go-humanize"
 	"github.com/fatih/color"
 	"github.com/gabriel-vasile/mimetype"
 	"github.com/ollama/ollama/api"
@@ -96,25 +96,29 @@ func doGeneration(
 	conf config,
 	model string,
 	systemInstruction string,
-	temperature *float32,
-	topP *float32,
-	topK *int32,
 	stop []*string,
+	options map[string]any,
+	keepAlive *api.Duration,
 	outputJSONScheme *string,
 	withThinking, hideReasoning bool,
 	contextWindowSize *int,
+	contextOverflow *string,
 	prompt string,
 	filepaths []*string,
+	fileOpts fileOptions,
+	history []api.Message,
 	showCallbackResults, recurseOnCallbackResults bool, forceCallDestructiveTools bool,
+	toolCallWorkers int,
 	localTools []api.Tool,
 	localToolCallbacks map[string]string,
 	localToolCallbacksConfirm map[string]bool,
 	mcpConnsAndTools mcpConnectionsAndTools,
+	loop *agentLoop,
 	pastGenerations []api.Message,
 	userAgent *string,
 	replaceHTTPURLsInPrompt bool,
 	vbs []bool,
-) (exit int, e error) {
+) (exit int, conversation []api.Message, e error) {
 	output.verbose(
 		verboseMedium,
 		vbs,
@@ -127,10 +131,20 @@ func doGeneration(
 	)
 	defer cancel()
 
+	// limits of agent loop
+	if loop == nil {
+		loop = newAgentLoop(agentLoopLimits{})
+	}
+	roundCtx, cancelRound := ctx, context.CancelFunc(func() {})
+	if loop.limits.RoundTimeout > 0 {
+		roundCtx, cancelRound = context.WithTimeout(ctx, loop.limits.RoundTimeout)
+	}
+	defer cancelRound()
+
 	// ollama api client
 	client, err := newOllamaClient()
 	if err != nil {
-		return 1, fmt.Errorf("failed to initialize Ollama API client: %w", err)
+		return 1, nil, fmt.Errorf("failed to initialize Ollama API client: %w", err)
 	}
 
 	// get model info and check values
@@ -139,7 +153,7 @@ func doGeneration(
 		Model: model,
 	})
 	if err != nil {
-		return 1, fmt.Errorf("failed to get model(%s) info: %w", model, err)
+		return 1, nil, fmt.Errorf("failed to get model(%s) info: %w", model, err)
 	}
 	// (thinking)
 	var thinkVal any
@@ -152,13 +166,14 @@ func doGeneration(
 		thinkVal = false
 	}
 
+	userPrompt := prompt // NOTE: keep the original prompt for recursion
 	filesInPrompt := map[string][]byte{}
 	if replaceHTTPURLsInPrompt {
-		prompt, filesInPrompt = replaceURLsInPrompt(
+		userPrompt, filesInPrompt = replaceURLsInPrompt(
 			output,
 			conf,
 			userAgent,
-			prompt,
+			userPrompt,
 			vbs,
 		)
 
@@ -166,66 +181,33 @@ func doGeneration(
 			verboseMedium,
 			vbs,
 			"prompt with urls replaced: '%s'",
-			prompt,
+			userPrompt,
 		)
 	}
 
-	// convert prompt with/without files
-	prompt, mediaFiles, err := convertPromptAndFiles(
-		prompt,
+	// read files for prompt
+	promptFiles, media, attached, err := readPromptFiles(
 		filesInPrompt,
 		filepaths,
+		fileOpts,
 	)
 	if err != nil {
-		return 1, fmt.Errorf("failed to convert prompt and files: %w", err)
+		return 1, nil, fmt.Errorf("failed to convert prompt and files: %w", err)
 	}
-	var media []api.ImageData = nil
-	for _, mf := range mediaFiles {
-		media = append(media, api.ImageData(mf))
+	if len(pastGenerations) <= 0 { // NOTE: report only once (not on recursive generations)
+		reportAttachedFiles(output, attached, vbs)
 	}
 
-	// FIXME: TODO: return error when the context length is exceeded
-
-	output.verbose(
-		verboseMaximum,
-		vbs,
-		"with converted prompt: '%s' and media files: %v",
-		strings.TrimSpace(prompt),
-		mediaFiles,
-	)
-
 	// generation options
 	req := &api.ChatRequest{
 		Model: model,
-		Messages: []api.Message{
-			{
-				Role:    "system",
-				Content: systemInstruction,
-			},
-			{
-				Role:    "user",
-				Content: prompt,
-				Images:  media,
-			},
-		},
-	}
-	generationTemperature := defaultGenerationTemperature
-	if temperature != nil {
-		generationTemperature = *temperature
-	}
-	generationTopP := defaultGenerationTopP
-	if topP != nil {
-		generationTopP = *topP
-	}
-	generationTopK := defaultGenerationTopK
-	if topK != nil {
-		generationTopK = *topK
 	}
 	req.Options = map[string]any{
-		"temperature": generationTemperature,
-		"top_p":       generationTopP,
-		"top_k":       generationTopK,
+		"temperature": defaultGenerationTemperature,
+		"top_p":       defaultGenerationTopP,
+		"top_k":       defaultGenerationTopK,
 	}
+	maps.Copy(req.Options, options)
 	if contextWindowSize != nil {
 		req.Options["num_ctx"] = *contextWindowSize
 	}
@@ -240,7 +222,7 @@ func doGeneration(
 		if json.Valid([]byte(*outputJSONScheme)) {
 			req.Format = json.RawMessage(*outputJSONScheme)
 		} else {
-			return 1, fmt.Errorf("invalid output JSON scheme: `%s`", *outputJSONScheme)
+			return 1, nil, fmt.Errorf("invalid output JSON scheme: `%s`", *outputJSONScheme)
 		}
 	}
 	// (tools - local)
@@ -255,7 +237,7 @@ func doGeneration(
 				ollamaTools = append(ollamaTools, *c)
 			}
 		} else {
-			return 1, fmt.Errorf("failed to convert MCP tools: %w", err)
+			return 1, nil, fmt.Errorf("failed to convert MCP tools: %w", err)
 		}
 	}
 	if len(ollamaTools) > 0 {
@@ -265,8 +247,58 @@ func doGeneration(
 	req.Think = &api.ThinkValue{
 		Value: thinkVal,
 	}
+	// (keep alive)
+	req.KeepAlive = keepAlive
+
+	// check if the prompt fits in the context window, and handle the overflow
+	history, promptFiles, err = fitToContextWindow(
+		ctx,
+		client,
+		output,
+		model,
+		contextLengthOf(shown, contextWindowSize, req.Options),
+		contextOverflow,
+		systemInstruction,
+		history,
+		userPrompt,
+		promptFiles,
+		len(media),
+		pastGenerations,
+		req.Tools,
+		vbs,
+	)
+	if err != nil {
+		return 1, nil, err
+	}
+
+	// build up prompt with files
+	convertedPrompt := buildPromptWithFiles(userPrompt, promptFiles)
+
+	output.verbose(
+		verboseMaximum,
+		vbs,
+		"with converted prompt: '%s' and %d media file(s)",
+		strings.TrimSpace(convertedPrompt),
+		len(media),
+	)
+
+	// (messages)
+	req.Messages = []api.Message{
+		{
+			Role:    "system",
+			Content: systemInstruction,
+		},
+	}
+	// (previous turns of conversation)
+	req.Messages = append(req.Messages, history...)
+	req.Messages = append(req.Messages, api.Message{
+		Role:    "user",
+		Content: convertedPrompt,
+		Images:  media,
+	})
 
 	// (history)
+	messagesBeforeGenerations := slices.Clone(req.Messages)
 	req.Messages = append(req.Messages, pastGenerations...)
 
 	output.verbose(
@@ -282,12 +314,16 @@ func doGeneration(
 		err  error
 	}
 	ch := make(chan result, 1)
+	finished := make(chan struct{})
+	toolCallsHandled := false // (whether any generated tool call was handled, for recursing on its result)
 	go func() {
+		defer close(finished)
+
 		reasoningStarted := false
 		firstContentAfterReasoning := false
 
 		if err = client.Chat(
-			ctx,
+			roundCtx,
 			req,
 			func(resp api.ChatResponse) error {
 				if resp.Message.Role == "assistant" {
@@ -296,14 +332,10 @@ func doGeneration(
 						if !reasoningStarted {
 							if !hideReasoning {
 								// print generated content
-								output.printColored(
+								output.printGenerated(
 									color.FgHiGreen,
 									thinkingTagBegin+"\n",
 								)
-								pastGenerations = appendModelResponseToPastGenerations(
-									pastGenerations,
-									thinkingTagBegin+"\n",
-								)
 							}
 
 							reasoningStarted = true
@@ -314,14 +346,10 @@ func doGeneration(
 								output.makeSureToEndWithNewLine()
 
 								// print generated content
-								output.printColored(
+								output.printGenerated(
 									color.FgHiGreen,
 									thinkingTagEnd+"\n",
 								)
-								pastGenerations = appendModelResponseToPastGenerations(
-									pastGenerations,
-									thinkingTagEnd+"\n",
-								)
 							}
 
 							reasoningStarted = false
@@ -330,14 +358,20 @@ func doGeneration(
 					}
 
 					// show thinking
-					if !hideReasoning && len(resp.Message.Thinking) > 0 {
-						// print generated content
-						output.printColored(
-							color.FgHiWhite,
-							"%s",
-							resp.Message.Thinking,
-						)
-						pastGenerations = appendModelResponseToPastGenerations(
+					if len(resp.Message.Thinking) > 0 {
+						if !hideReasoning {
+							// print generated content
+							output.printGenerated(
+								color.FgHiWhite,
+								"%s",
+								resp.Message.Thinking,
+							)
+						}
+						output.emit(outputEvent{
+							Type:  eventThinking,
+							Delta: resp.Message.Thinking,
+						})
+						pastGenerations = appendModelThinkingToPastGenerations(
 							pastGenerations,
 							resp.Message.Thinking,
 						)
@@ -356,11 +390,11 @@ func doGeneration(
 							}
 
 							// print generated content
-							output.printColored(
-								color.FgHiWhite,
-								"%s",
-								content,
-							)
+							output.printContent(content)
+							output.emit(outputEvent{
+								Type:  eventContent,
+								Delta: content,
+							})
 							pastGenerations = appendModelResponseToPastGenerations(
 								pastGenerations,
 								content,
@@ -380,194 +414,36 @@ func doGeneration(
 							string(marshalled),
 						)
 
-						// call functions
-						for _, call := range resp.Message.ToolCalls {
-							output.verbose(
-								verboseMedium,
-								vbs,
-								"calling callback for tool call: %s",
-								call.Function.Name,
-							)
+						// NOTE: check repeated tool calls before appending the current ones
+						previousGenerations := slices.Clone(pastGenerations)
 
-							fn := fmt.Sprintf(
-								"%s(%s)",
-								call.Function.Name,
-								prettify(call.Function.Arguments, true),
-							)
-
-							if callbackPath, exists := localToolCallbacks[call.Function.Name]; exists {
-								// with local tools,
-								fnCallback, okToRun := checkCallbackPath(
-									conf,
-									output,
-									callbackPath,
-									localToolCallbacksConfirm,
-									forceCallDestructiveTools,
-									call.Function,
-									vbs,
-								)
+						// append tool calls (for pairing them with the results of tool calls)
+						pastGenerations = appendToolCallsToPastGenerations(
+							pastGenerations,
+							resp.Message.ToolCalls,
+						)
 
-								if okToRun {
-									output.verbose(
-										verboseMedium,
-										vbs,
-										"executing callback...",
-									)
-
-									if res, err := fnCallback(); err != nil {
-										return fmt.Errorf(
-											"tool callback failed: %s",
-											err,
-										)
-									} else {
-										// warn that there are ignored tool callbacks
-										if len(localToolCallbacks) > 0 &&
-											!recurseOnCallbackResults {
-											output.warn(
-												"Not recursing, ignoring the result of '%s'.",
-												fn,
-											)
-										}
-
-										// print the result of execution
-										if showCallbackResults ||
-											verboseLevel(vbs) >= verboseMinimum {
-											output.printColored(
-												color.FgHiCyan,
-												"%s\n",
-												res,
-											)
-										}
-
-										// append function call result
-										pastGenerations = append(pastGenerations, api.Message{
-											Role: "user",
-											Content: fmt.Sprintf(
-												`Result of function '%s':
-
-%s`,
-												fn,
-												res,
-											),
-										})
-									}
-								} else {
-									skipped := fmt.Sprintf(
-										"Skipped execution of callback '%s' for function '%s'.\n",
-										callbackPath,
-										fn,
-									)
-
-									// print generated content
-									output.printColored(
-										color.FgHiWhite,
-										"%s",
-										skipped,
-									)
-									pastGenerations = appendUserMessageToPastGenerations(
-										pastGenerations,
-										skipped,
-									)
-
-									// append function call result (not called)
-									pastGenerations = append(pastGenerations, api.Message{
-										Role: "user",
-										Content: fmt.Sprintf(
-											`User chose not to call function '%s'.`,
-											fn,
-										),
-									})
-								}
-							} else if serverKey, serverType, mc, tool, exists := mcpToolFrom(
-								mcpConnsAndTools,
-								call.Function.Name,
-							); exists {
-								// NOTE: avoid infinite loops
-								if slices.ContainsFunc(pastGenerations, func(message api.Message) bool {
-									return strings.Contains(message.Content, fn)
-								}) {
-									return fmt.Errorf("possible infinite loop detected: '%s'", fn)
-								}
-
-								okToRun := false
-
-								// check if matched MCP tool requires confirmation
-								if tool.Annotations != nil &&
-									tool.Annotations.DestructiveHint != nil &&
-									*tool.Annotations.DestructiveHint &&
-									!forceCallDestructiveTools {
-									okToRun = confirm(fmt.Sprintf(
-										"May I call tool '%s' from '%s' for function '%s'?",
-										call.Function.Name,
-										stripServerInfo(serverType, serverKey),
-										fn,
-									))
-								} else {
-									okToRun = true
-								}
-
-								if okToRun {
-									if res, err := fetchToolCallResult(
-										ctx,
-										mc,
-										call.Function.Name,
-										call.Function.Arguments,
-									); err == nil {
-										fnResult := fmt.Sprintf(
-											"Tool call result of '%s':\n%s",
-											fn,
-											prettify(res.Content),
-										)
-
-										// print the result of execution
-										if showCallbackResults ||
-											verboseLevel(vbs) >= verboseMinimum {
-											output.printColored(
-												color.FgHiCyan,
-												"%s\n",
-												fnResult,
-											)
-										}
-
-										// print generated content
-										pastGenerations = appendUserMessageToPastGenerations(
-											pastGenerations,
-											fnResult,
-										)
-									} else {
-										return fmt.Errorf("failed to call MCP tool: %w", err)
-									}
-								} else {
-									output.printColored(
-										color.FgHiYellow,
-										"Skipped execution of MCP tool '%s' from '%s' for function '%s'.\n",
-										call.Function.Name,
-										stripServerInfo(serverType, serverKey),
-										fn,
-									)
-
-									// append function call result (not called)
-									pastGenerations = appendUserMessageToPastGenerations(
-										pastGenerations,
-										fmt.Sprintf(
-											`User chose not to call function '%s'.`,
-											fn,
-										),
-									)
-								}
-							} else {
-								// print generated content
-								fnUnhandled := fmt.Sprintf("Generated tool call: %s", fn)
-								output.printColored(
-									color.FgHiWhite,
-									"%s\n",
-									fnUnhandled,
-								)
-								pastGenerations = appendUserMessageToPastGenerations(
-									pastGenerations,
-									fnUnhandled,
-								)
-							}
+						// call functions
+						results, handled, err := executeToolCalls(
+							roundCtx,
+							conf,
+							output,
+							resp.Message.ToolCalls,
+							previousGenerations,
+							showCallbackResults,
+							recurseOnCallbackResults,
+							forceCallDestructiveTools,
+							toolCallWorkers,
+							localToolCallbacks,
+							localToolCallbacksConfirm,
+							mcpConnsAndTools,
+							loop,
+							vbs,
+						)
+						pastGenerations = append(pastGenerations, results...)
+						toolCallsHandled = toolCallsHandled || handled
+						if err != nil {
+							return err
 						}
 					} else if len(resp.Message.Images) > 0 {
 						output.verbose(
@@ -592,6 +468,7 @@ func doGeneration(
 					}
 				}
 				if resp.Done {
+					output.finishMarkdown()
 					output.makeSureToEndWithNewLine()
 
 					// print the number of tokens
@@ -620,6 +497,12 @@ func doGeneration(
 							resp.TotalDuration,
 						)
 					}
+					output.emit(outputEvent{
+						Type:       eventDone,
+						Model:      model,
+						DoneReason: resp.DoneReason,
+						Metrics:    &resp.Metrics,
+					})
 
 					// success
 					ch <- result{
@@ -641,14 +524,42 @@ func doGeneration(
 
 	// wait for the generation to finish
 	select {
-	case <-ctx.Done():
-		return 1, fmt.Errorf("generation timed out: %w", ctx.Err())
+	case <-roundCtx.Done():
+		if ctx.Err() == nil { // only this round has timed out
+			// NOTE: wait for the canceled generation to return (but not after the whole generation times out),
+			// for keeping the conversation collected so far
+			select {
+			case <-finished:
+				loop.stop(fmt.Sprintf("round %d timed out after %s", loop.rounds, loop.limits.RoundTimeout))
+				loop.printSummary(output)
+
+				return 1, append(messagesBeforeGenerations, pastGenerations...), loop.err()
+			case <-ctx.Done():
+			}
+		}
+		return 1, nil, fmt.Errorf("generation timed out: %w", ctx.Err())
 	case res := <-ch:
+		// check if any limit of agent loop was reached
+		if res.exit == 0 &&
+			res.err == nil &&
+			loop.stopped() {
+			loop.printSummary(output)
+
+			return 1, append(messagesBeforeGenerations, pastGenerations...), loop.err()
+		}
+
 		// check if recursion is needed
 		if res.exit == 0 &&
 			res.err == nil &&
 			recurseOnCallbackResults &&
-			historyEndsWithUsers(pastGenerations) {
+			toolCallsHandled &&
+			historyEndsWithToolResults(pastGenerations) {
+			if !loop.allowRound() {
+				loop.printSummary(output)
+
+				return 1, append(messagesBeforeGenerations, pastGenerations...), loop.err()
+			}
+
 			output.verbose(
 				verboseMedium,
 				vbs,
@@ -663,23 +574,27 @@ func doGeneration(
 				conf,
 				model,
 				systemInstruction,
-				temperature,
-				topP,
-				topK,
 				stop,
+				options,
+				keepAlive,
 				outputJSONScheme,
 				withThinking,
 				hideReasoning,
 				contextWindowSize,
+				contextOverflow,
 				prompt,
 				filepaths,
+				fileOpts,
+				history,
 				showCallbackResults,
 				recurseOnCallbackResults,
 				forceCallDestructiveTools,
+				toolCallWorkers,
 				localTools,
 				localToolCallbacks,
 				localToolCallbacksConfirm,
 				mcpConnsAndTools,
+				loop,
 				pastGenerations,
 				userAgent,
 				replaceHTTPURLsInPrompt,
@@ -687,7 +602,7 @@ func doGeneration(
 			)
 		}
 
-		return res.exit, res.err
+		return res.exit, append(messagesBeforeGenerations, pastGenerations...), res.err
 	}
 }
 
@@ -700,9 +615,11 @@ func doImageGeneration(
 	conf config,
 	model string,
 	prompt string, negativePrompt *string, filepaths []*string,
+	fileOpts fileOptions,
 	width, height *int,
 	seed *int,
 	configuredImagesDir *string, displayInTerminal bool,
+	keepAlive *api.Duration,
 	vbs []bool,
 ) (exit int, e error) {
 	output.verbose(
@@ -764,9 +681,12 @@ func doImageGeneration(
 
 	// convert prompt with/without files
 	prompt, mediaFiles, err := convertPromptAndFiles(
+		output,
 		prompt,
 		nil,
 		filepaths,
+		fileOpts,
+		vbs,
 	)
 	if err != nil {
 		return 1, fmt.Errorf("failed to convert prompt and files: %w", err)
@@ -776,17 +696,22 @@ func doImageGeneration(
 		media = append(media, mediaFiles...)
 	}
 
+	// NOTE: keep the model loaded while generating images, if keep-alive is not given
+	if keepAlive == nil {
+		keepAlive = &api.Duration{
+			Duration: time.Duration(conf.ImageGenerationTimeoutSeconds) * time.Second,
+		}
+	}
+
 	// Build request with image gen options encoded in Options fields
 	req := &api.GenerateRequest{
-		Model:  model,
-		Prompt: prompt,
-		Images: media,
-		KeepAlive: &api.Duration{
-			Duration: time.Duration(conf.ImageGenerationTimeoutSeconds) * time.Second,
-		},
-		Width:  int32(opts.Width),
-		Height: int32(opts.Height),
-		Steps:  int32(opts.Steps),
+		Model:     model,
+		Prompt:    prompt,
+		Images:    media,
+		KeepAlive: keepAlive,
+		Width:     int32(opts.Width),
+		Height:    int32(opts.Height),
+		Steps:     int32(opts.Steps),
 
 		// options
 		Options: map[string]any{
@@ -852,7 +777,7 @@ func doImageGeneration(
 		}
 
 		// display in terminal,
-		if displayInTerminal {
+		if displayInTerminal && !output.machineReadable() {
 			if err := displayImageInTerminal(imageData, mimetype.Detect(imageData).String()); err != nil {
 				output.printColored(color.FgRed, "Failed to display image in terminal: %s\n", err.Error())
 			} else {
@@ -871,6 +796,12 @@ func doImageGeneration(
 		}
 
 		output.printColored(color.FgGreen, "Image saved to: %s\n", filepath)
+
+		output.result.Model = model
+		output.result.Images = append(output.result.Images, outputResultImage{
+			Path: filepath,
+			Seed: opts.Seed,
+		})
 	} else {
 		output.printColored(color.FgRed, "Failed to generate image; no image data received.\n")
 	}
@@ -907,38 +838,29 @@ func doListModels(
 		return 1, fmt.Errorf("failed to initialize Ollama API client: %w", err)
 	}
 
-	// list models
-	models, err := client.List(ctx)
+	// list models (with their capabilities)
+	models, err := listModels(ctx, client)
 	if err != nil {
-		return 1, fmt.Errorf("failed to list models: %w", err)
+		return 1, err
 	}
-	if len(models.Models) > 0 {
-		// print headers
-		output.printColored(
-			color.FgWhite,
-			"%24s\t%s\n----\n",
-			"name",
-			"size",
-		)
 
-		for _, model := range models.Models {
-			if len(vbs) > 0 {
-				output.printColored(
-					color.FgHiWhite,
-					"%24s\t%s\t%s\n",
-					model.Name,
-					humanize.Bytes(uint64(model.Size)),
-					prettify(model.Details),
-				)
-			} else {
-				output.printColored(
-					color.FgHiWhite,
-					"%24s\t%s\n",
-					model.Name,
-					humanize.Bytes(uint64(model.Size)),
-				)
-			}
-		}
+	// filter and sort models
+	models = filterModelsByCapabilities(models, p.ListModelsOptions.Capabilities)
+	sortBy := sortModelsByModified
+	if p.ListModelsOptions.SortBy != nil {
+		sortBy = *p.ListModelsOptions.SortBy
+	}
+	sortModels(models, sortBy, p.ListModelsOptions.Reverse)
+
+	// (in JSON format, models will be printed with the final result)
+	if output.format == outputFormatJSON {
+		output.result.Models = models
+
+		return 0, nil
+	}
+
+	if len(models) > 0 {
+		printModels(output, models)
 	} else {
 		output.printColored(
 			color.FgHiRed,
@@ -1016,6 +938,11 @@ func doEmbeddingsGeneration(
 		options["num_ctx"] = *p.ContextWindowSize
 	}
 
+	keepAlive, err := resolveKeepAlive(conf, p)
+	if err != nil {
+		return 1, err
+	}
+
 	// iterate chunks and generate embeddings
 	type embedding struct {
 		Text    string    `json:"text"`
@@ -1031,9 +958,10 @@ func doEmbeddingsGeneration(
 	}
 	for i, text := range chunks.Chunks {
 		embeddings, err := client.Embeddings(ctx, &api.EmbeddingRequest{
-			Model:   model,
-			Prompt:  text,
-			Options: options,
+			Model:     model,
+			Prompt:    text,
+			Options:   options,
+			KeepAlive: keepAlive,
 		})
 		if err != nil {
 			return 1, fmt.Errorf("embeddings failed for chunk[%d]: %w", i, err)
@@ -1045,6 +973,14 @@ func doEmbeddingsGeneration(
 		}
 	}
 
+	// (in JSON format, embeddings will be printed with the final result)
+	if output.format == outputFormatJSON {
+		output.result.Model = model
+		output.result.Embeddings = embeds
+
+		return 0, nil
+	}
+
 	// print floats
 	floats, err := json.Marshal(embeds)
 	if err != nil {
@@ -1075,16 +1011,15 @@ func checkCallbackPath(
 	confirmToolCallbacks map[string]bool,
 	forceCallDestructiveTools bool,
 	fnCall api.ToolCallFunction,
-	vbs []bool,
 ) (
-	fnCallback func() (string, error),
+	fnCallback func(ctx context.Context) (string, error),
 	okToRun bool,
 ) {
 	// check if `callbackPath` is a predefined callback
 	if callbackPath == fnCallbackStdin { // @stdin
 		okToRun = true
 
-		fnCallback = func() (string, error) {
+		fnCallback = func(_ context.Context) (string, error) {
 			prompt := fmt.Sprintf(
 				"Type your answer for function '%s(%s)'",
 				fnCall.Name,
@@ -1096,7 +1031,7 @@ func checkCallbackPath(
 	} else if strings.HasPrefix(callbackPath, fnCallbackFormatter) { // @format
 		okToRun = true
 
-		fnCallback = func() (string, error) {
+		fnCallback = func(_ context.Context) (string, error) {
 			if tpl, exists := strings.CutPrefix(callbackPath, fnCallbackFormatter+"="); exists {
 				if t, err := template.New("fnFormatter").Parse(tpl); err == nil {
 					buf := new(bytes.Buffer)
@@ -1120,9 +1055,9 @@ func checkCallbackPath(
 		okToRun = true
 
 		// search from web with https://ollama.com/blog/web-search
-		fnCallback = func() (string, error) {
-			ollamaAPIKey := ollamaAPIKey(conf, output)
-
+		// (NOTE: resolve the API key here, as callbacks can be run concurrently and should not print anything)
+		ollamaAPIKey := ollamaAPIKey(conf, output)
+		fnCallback = func(ctx context.Context) (string, error) {
 			searchParamQuery := defaultSearchParamQuery
 			if title, exists := strings.CutPrefix(callbackPath, fnCallbackWebSearch+"="); exists {
 				searchParamQuery = title
@@ -1133,7 +1068,7 @@ func checkCallbackPath(
 
 				if query, exists := args[searchParamQuery]; exists {
 					if query, ok := query.(string); ok {
-						if searched, err := webSearch(ollamaAPIKey, query); err == nil {
+						if searched, err := webSearch(ctx, ollamaAPIKey, query); err == nil {
 							return prettify(searched, false), nil
 						} else {
 							return "", fmt.Errorf("failed to search from web: %w", err)
@@ -1162,17 +1097,8 @@ func checkCallbackPath(
 		}
 
 		// run executable
-		fnCallback = func() (string, error) {
-			output.verbose(
-				verboseMinimum,
-				vbs,
-				"executing callback '%s' for function '%s(%s)'...",
-				callbackPath,
-				fnCall.Name,
-				prettify(fnCall.Arguments, true),
-			)
-
-			return runExecutable(callbackPath, fnCall.Arguments)
+		fnCallback = func(ctx context.Context) (string, error) {
+			return runExecutable(ctx, callbackPath, fnCall.Arguments)
 		}
 	}
 
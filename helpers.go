@@ -7,11 +7,13 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"image"
 	"io"
 	"log"
+	"maps"
 	"net/http"
 	"os"
 	"os/exec"
@@ -48,6 +50,7 @@ var _namesToIgnore = []string{
 	".env",
 	".env.local",
 	".git/",
+	".ollignore",
 	".ssh/",
 	".svn/",
 	".Trash/",
@@ -132,20 +135,58 @@ func ignoredFile(
 }
 
 // filesInDir returns all files' paths in the given directory.
+//
+// Files and directories which are ignored by given filter will be skipped,
+// and archives in it will be expanded as virtual directories.
 func filesInDir(
 	output *outputWriter,
+	archives archiveIndexes,
 	dir string,
+	filter *fileFilter,
+	maxTotalBytes int64,
 	vbs []bool,
 ) ([]*string, error) {
 	var files []*string
 
 	// traverse directory
 	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
 		if d.IsDir() {
 			if ignoredDirectory(output, path) {
 				return filepath.SkipDir
 			}
+			if ignored, reason := filter.ignored(path, true); ignored {
+				output.verbose(
+					verboseMedium,
+					vbs,
+					"ignoring directory '%s' (by %s)",
+					path,
+					reason,
+				)
+				return filepath.SkipDir
+			}
+
+			// load ignore files in this directory
+			if abs, err := filepath.Abs(path); err == nil {
+				if err := filter.loadIgnoreFiles(abs); err != nil {
+					return err
+				}
+			}
 		} else {
+			if ignored, reason := filter.ignored(path, false); ignored {
+				output.verbose(
+					verboseMedium,
+					vbs,
+					"ignoring file '%s' (by %s)",
+					path,
+					reason,
+				)
+				return nil
+			}
+
 			stat, err := os.Stat(path)
 			if err != nil {
 				return err
@@ -155,6 +196,16 @@ func filesInDir(
 				return nil
 			}
 
+			// expand archives as virtual directories
+			if isArchivePath(path) {
+				archived, err := filesInArchive(output, archives, path, filter, maxTotalBytes, vbs)
+				if err != nil {
+					return err
+				}
+				files = append(files, archived...)
+				return nil
+			}
+
 			output.verbose(
 				verboseMedium,
 				vbs,
@@ -171,16 +222,22 @@ func filesInDir(
 	return files, err
 }
 
-// expandFilepaths expands given filepaths (expands directories with their sub files).
+// expandFilepaths expands given filepaths (expands directories with their sub files, and archives with their entries).
+//
+// Total uncompressed size of entries in each archive is limited by `fileOpts.MaxTotalBytes`.
 func expandFilepaths(
 	output *outputWriter,
 	p params,
+	fileOpts fileOptions,
 ) (expanded []*string, err error) {
 	filepaths := p.Generation.Filepaths
 	if filepaths == nil {
 		return nil, nil
 	}
 
+	// (listed archives, only for this expansion)
+	archives := archiveIndexes{}
+
 	// expand directories with their sub files
 	expanded = []*string{}
 	for _, fp := range filepaths {
@@ -191,9 +248,20 @@ func expandFilepaths(
 		// expand given filepath
 		fp = ptr(expandPath(*fp))
 
+		// an entry in an archive (eg. 'logs.zip!/app/error.log')
+		if _, _, ok := splitArchivePath(*fp); ok {
+			expanded = append(expanded, fp)
+			continue
+		}
+
 		if stat, err := os.Stat(*fp); err == nil {
 			if stat.IsDir() {
-				if files, err := filesInDir(output, *fp, p.Verbose); err == nil {
+				filter, err := newFileFilter(*fp, p.Generation.Files.Include, p.Generation.Files.Exclude)
+				if err != nil {
+					return nil, fmt.Errorf("failed to filter files in '%s': %w", *fp, err)
+				}
+
+				if files, err := filesInDir(output, archives, *fp, filter, fileOpts.MaxTotalBytes, p.Verbose); err == nil {
 					expanded = append(expanded, files...)
 				} else {
 					return nil, fmt.Errorf("failed to list files in '%s': %w", *fp, err)
@@ -202,6 +270,22 @@ func expandFilepaths(
 				if ignoredFile(output, *fp, stat) {
 					continue
 				}
+
+				// expand archives as virtual directories
+				if isArchivePath(*fp) {
+					filter, err := newGlobFileFilter(filepath.Dir(*fp), p.Generation.Files.Include, p.Generation.Files.Exclude)
+					if err != nil {
+						return nil, fmt.Errorf("failed to filter files in '%s': %w", *fp, err)
+					}
+
+					if files, err := filesInArchive(output, archives, *fp, filter, fileOpts.MaxTotalBytes, p.Verbose); err == nil {
+						expanded = append(expanded, files...)
+					} else {
+						return nil, fmt.Errorf("failed to list files in '%s': %w", *fp, err)
+					}
+					continue
+				}
+
 				expanded = append(expanded, fp)
 			}
 		} else {
@@ -209,6 +293,12 @@ func expandFilepaths(
 		}
 	}
 
+	// (heads of entries in tar archives are read at once for detecting their mime types)
+	sniffed, err := readTarEntries(expanded, binaryDetectionSampleBytes)
+	if err != nil {
+		return nil, err
+	}
+
 	// filter filepaths by supported mime types
 	filtered := []*string{}
 	for _, fp := range expanded {
@@ -216,7 +306,14 @@ func expandFilepaths(
 			continue
 		}
 
-		if matched, supported, err := supportedMimeTypePath(*fp); err == nil {
+		var matched string
+		var supported bool
+		if data, exists := sniffed[*fp]; exists {
+			matched, supported, err = supportedMimeType(data)
+		} else {
+			matched, supported, err = supportedMimeTypePath(*fp)
+		}
+		if err == nil {
 			if supported {
 				filtered = append(filtered, fp)
 			} else {
@@ -462,6 +559,19 @@ func ptr[T any](v T) *T {
 	return &val
 }
 
+// uniq gets unique elements of given slice.
+func uniq[T comparable](slice []T) []T {
+	keys := map[T]bool{}
+	list := []T{}
+	for _, entry := range slice {
+		if _, value := keys[entry]; !value {
+			keys[entry] = true
+			list = append(list, entry)
+		}
+	}
+	return list
+}
+
 // uniqPtrs gets unique elements of given slice of pointers.
 func uniqPtrs[T comparable](slice []*T) []*T {
 	keys := map[T]bool{}
@@ -475,69 +585,255 @@ func uniqPtrs[T comparable](slice []*T) []*T {
 	return list
 }
 
+// a text file which will be embedded in the prompt
+type promptFile struct {
+	location string
+	mimeType string
+	data     []byte
+}
+
 // convertPromptAndFiles converts given prompt & files for generation.
 //
 // Media files (images and audio) are returned as binary data for the API's Images field.
-// Text files are embedded directly into the prompt.
 func convertPromptAndFiles(
+	output *outputWriter,
 	prompt string,
 	filesInPrompt map[string][]byte,
 	filepaths []*string,
+	fileOpts fileOptions,
+	vbs []bool,
 ) (convertedPrompt string, mediaData []api.ImageData, err error) {
+	var files []promptFile
+	var attached []attachedFile
+	if files, mediaData, attached, err = readPromptFiles(filesInPrompt, filepaths, fileOpts); err != nil {
+		return "", nil, err
+	}
+	reportAttachedFiles(output, attached, vbs)
+
+	return buildPromptWithFiles(prompt, files), mediaData, nil
+}
+
+// readPromptFiles reads given files (and files fetched from the prompt) for generation.
+//
+// Media files (images and audio) are returned as binary data for the API's Images field,
+// and text files are returned as `files` for embedding them into the prompt.
+//
+// Texts of PDF documents are extracted with page markers (and their pages are rendered to images if requested),
+// and office documents or e-books are converted to texts.
+//
+// Limits are applied to text files only, and statuses of all files are returned as `attached`.
+func readPromptFiles(
+	filesInPrompt map[string][]byte,
+	filepaths []*string,
+	fileOpts fileOptions,
+) (files []promptFile, mediaData []api.ImageData, attached []attachedFile, err error) {
 	mediaData = []api.ImageData{}
 
-	type f struct {
-		data     []byte
-		mimeType string
+	// NOTE: files with the same location will be overwritten
+	appendFile := func(file promptFile) {
+		if idx := slices.IndexFunc(files, func(f promptFile) bool {
+			return f.location == file.location
+		}); idx >= 0 {
+			files[idx] = file
+		} else {
+			files = append(files, file)
+		}
+	}
+
+	// (total size of attached text files)
+	var total int64
+
+	// appendTextFile applies limits to given text file, and appends it if it should be attached
+	appendTextFile := func(location, reported string, data []byte, size int64, mimeType string) error {
+		limited, file, err := fileOpts.apply(reported, data, size, &total)
+		if file.MimeType = mimeType; len(mimeType) <= 0 {
+			file.MimeType = mimetype.Detect(data).String()
+		}
+		attached = append(attached, file)
+		if err != nil {
+			return err
+		}
+
+		if limited != nil {
+			appendFile(promptFile{
+				location: location,
+				mimeType: file.MimeType,
+				data:     limited,
+			})
+		}
+		return nil
 	}
-	files := map[string]f{}
 
-	for url, file := range filesInPrompt {
-		if isImage, _ := supportedImage(file); isImage {
-			mediaData = append(mediaData, api.ImageData(file))
-		} else if isAudio, _ := supportedAudio(file); isAudio {
-			mediaData = append(mediaData, api.ImageData(file))
-		} else {
-			files[url] = f{
-				mimeType: mimetype.Detect(file).String(),
-				data:     file,
+	// skipUnreadableFile marks given file as skipped (or returns an error with fail policy) when its texts couldn't be extracted
+	skipUnreadableFile := func(reported, mimeType string, data []byte, err error) error {
+		attached = append(attached, attachedFile{
+			Location: reported,
+			MimeType: mimeType,
+			Size:     int64(len(data)),
+			Status:   attachedFileStatusSkipped,
+			Reason:   err.Error(),
+		})
+		if fileOpts.Policy == fileLimitPolicyFail {
+			return fmt.Errorf("failed to extract texts from '%s': %w", reported, err)
+		}
+		return nil
+	}
+
+	// appendPDFFile extracts texts of pages (and renders them to images if needed) from given PDF document, and appends them
+	appendPDFFile := func(location, reported string, data []byte) error {
+		pages, err := pdfToText(data)
+		if err != nil {
+			return skipUnreadableFile(reported, pdfMimeType, data, err)
+		}
+
+		if fileOpts.RenderPDFPages && fileOpts.DryRun {
+			attached = append(attached, attachedFile{
+				Location: reported,
+				MimeType: "image/png",
+				Status:   attachedFileStatusMedia,
+				Reason:   fmt.Sprintf("%d of %d page(s) would be rendered", min(len(pages), maxRenderedPDFPages), len(pages)),
+			})
+		} else if fileOpts.RenderPDFPages {
+			images, err := fileOpts.renderedPages.render(data, maxRenderedPDFPages)
+			if err != nil {
+				return fmt.Errorf("failed to render pages of PDF '%s': %w", reported, err)
+			}
+
+			rendered := attachedFile{
+				Location: reported,
+				MimeType: "image/png",
+				Status:   attachedFileStatusMedia,
+				Reason:   fmt.Sprintf("%d of %d page(s) rendered", len(images), len(pages)),
 			}
+			for _, image := range images {
+				mediaData = append(mediaData, api.ImageData(image))
+				rendered.Size += int64(len(image))
+				rendered.Attached += int64(len(image))
+			}
+			attached = append(attached, rendered)
 		}
+
+		text := []byte(formatPDFPages(pages))
+		return appendTextFile(location, reported, text, int64(len(text)), pdfMimeType)
+	}
+
+	// appendDocumentFile converts given office document or e-book to text, and appends it
+	appendDocumentFile := func(location, reported, mimeType string, data []byte) error {
+		text, err := documentToText(mimeType, data)
+		if err != nil {
+			return skipUnreadableFile(reported, mimeType, data, err)
+		}
+
+		return appendTextFile(location, reported, []byte(text), int64(len(text)), mimeType)
+	}
+
+	// appendFileData appends given file data by its type
+	appendFileData := func(location, reported string, data []byte) error {
+		if isImage, _ := supportedImage(data); isImage {
+			mediaData = append(mediaData, api.ImageData(data))
+			attached = append(attached, mediaAttachedFile(reported, data))
+		} else if isAudio, _ := supportedAudio(data); isAudio {
+			mediaData = append(mediaData, api.ImageData(data))
+			attached = append(attached, mediaAttachedFile(reported, data))
+		} else if mimeType := mimetype.Detect(data); mimeType.Is(pdfMimeType) {
+			return appendPDFFile(location, reported, data)
+		} else if matched, isDocument := documentMimeType(mimeType); isDocument {
+			return appendDocumentFile(location, reported, matched, data)
+		} else {
+			return appendTextFile(location, reported, data, int64(len(data)), "")
+		}
+		return nil
+	}
+
+	urls := slices.Sorted(maps.Keys(filesInPrompt))
+	for _, url := range urls {
+		if err := appendFileData(url, url, filesInPrompt[url]); err != nil {
+			return nil, nil, attached, err
+		}
+	}
+
+	// (entries in tar archives are read at once, as they can't be opened randomly)
+	entries, err := readTarEntries(filepaths, 0)
+	if err != nil {
+		return nil, nil, attached, fmt.Errorf("failed to read files for prompt: %w", err)
 	}
+
 	for _, fp := range filepaths {
-		if opened, err := os.Open(*fp); err == nil {
-			defer func() { _ = opened.Close() }()
-
-			fbase := filepath.Base(*fp)
-			if bytes, err := io.ReadAll(opened); err == nil {
-				if isImage, _ := supportedImagePath(*fp); isImage {
-					mediaData = append(mediaData, api.ImageData(bytes))
-				} else if isAudio, _ := supportedAudioPath(*fp); isAudio {
-					mediaData = append(mediaData, api.ImageData(bytes))
+		if data, exists := entries[*fp]; exists {
+			if err := appendFileData(fileNameForPrompt(*fp), *fp, data); err != nil {
+				return nil, nil, attached, err
+			}
+			continue
+		}
+
+		isImage, _ := supportedImagePath(*fp)
+		isAudio, _ := supportedAudioPath(*fp)
+		if isImage || isAudio {
+			bytes, err := readFile(*fp)
+			if err != nil {
+				return nil, nil, attached, fmt.Errorf("failed to read file for prompt: %w", err)
+			}
+			mediaData = append(mediaData, api.ImageData(bytes))
+			attached = append(attached, mediaAttachedFile(*fp, bytes))
+			continue
+		}
+		if mimeType, err := detectMimeTypePath(*fp); err == nil {
+			if matched, isDocument := documentMimeType(mimeType); isDocument || mimeType.Is(pdfMimeType) {
+				bytes, err := readFile(*fp)
+				if err != nil {
+					return nil, nil, attached, fmt.Errorf("failed to read file for prompt: %w", err)
+				}
+				if isDocument {
+					err = appendDocumentFile(fileNameForPrompt(*fp), *fp, matched, bytes)
 				} else {
-					files[fbase] = f{
-						mimeType: mimetype.Detect(bytes).String(),
-						data:     bytes,
-					}
+					err = appendPDFFile(fileNameForPrompt(*fp), *fp, bytes)
 				}
-			} else {
-				return "", nil, fmt.Errorf("failed to read file for prompt: %w", err)
+				if err != nil {
+					return nil, nil, attached, err
+				}
+				continue
 			}
-		} else {
-			return "", nil, fmt.Errorf("failed to open file for prompt: %w", err)
+		}
+
+		// NOTE: read only up to the limit (will be truncated or skipped anyway)
+		bytes, size, err := readFileUpTo(*fp, fileOpts.readLimit(total))
+		if err != nil {
+			return nil, nil, attached, err
+		}
+		if err := appendTextFile(fileNameForPrompt(*fp), *fp, bytes, size, ""); err != nil {
+			return nil, nil, attached, err
 		}
 	}
 
+	return files, mediaData, attached, nil
+}
+
+// mediaAttachedFile returns the status of an attached media file.
+func mediaAttachedFile(location string, data []byte) attachedFile {
+	return attachedFile{
+		Location: location,
+		MimeType: mimetype.Detect(data).String(),
+		Size:     int64(len(data)),
+		Attached: int64(len(data)),
+		Status:   attachedFileStatusMedia,
+	}
+}
+
+// buildPromptWithFiles builds up a prompt with given text files embedded.
+func buildPromptWithFiles(
+	prompt string,
+	files []promptFile,
+) string {
 	// build up prompt with contexts
 	contexts := []string{}
 	// (files)
 	if len(files) > 0 {
 		contexts = append(contexts, filesTagBegin)
 
-		for location, file := range files {
+		for _, file := range files {
 			contexts = append(contexts, fmt.Sprintf(
 				"<file name=\"%[1]s\" type=\"%[2]s\">\n%[3]s\n</file>",
-				location,
+				file.location,
 				file.mimeType,
 				string(file.data),
 			))
@@ -546,7 +842,7 @@ func convertPromptAndFiles(
 		contexts = append(contexts, filesTagEnd+"\n\n")
 	}
 
-	return fmt.Sprintf("%s%s", strings.Join(contexts, "\n"), prompt), mediaData, nil
+	return fmt.Sprintf("%s%s", strings.Join(contexts, "\n"), prompt)
 }
 
 // supportedImage checks if given image data is supported or not.
@@ -563,8 +859,8 @@ func supportedImage(data []byte) (supported bool, err error) {
 
 // supportedImagePath detects and returns whether given path is an image or not.
 func supportedImagePath(filepath string) (supported bool, err error) {
-	var f *os.File
-	if f, err = os.Open(filepath); err == nil {
+	var f io.ReadCloser
+	if f, _, err = openFile(filepath); err == nil {
 		defer func() { _ = f.Close() }()
 
 		var mimeType *mimetype.MIME
@@ -592,8 +888,8 @@ func supportedAudio(data []byte) (supported bool, err error) {
 
 // supportedAudioPath detects and returns whether given path is an audio or not.
 func supportedAudioPath(filepath string) (supported bool, err error) {
-	var f *os.File
-	if f, err = os.Open(filepath); err == nil {
+	var f io.ReadCloser
+	if f, _, err = openFile(filepath); err == nil {
 		defer func() { _ = f.Close() }()
 
 		var mimeType *mimetype.MIME
@@ -619,10 +915,22 @@ func supportedMimeType(data []byte) (matchedMimeType string, supported bool, err
 	return http.DetectContentType(data), false, err
 }
 
+// detectMimeTypePath detects the mime type of given path (or an entry in an archive).
+func detectMimeTypePath(filepath string) (mimeType *mimetype.MIME, err error) {
+	var f io.ReadCloser
+	if f, _, err = openFile(filepath); err == nil {
+		defer func() { _ = f.Close() }()
+
+		return mimetype.DetectReader(f)
+	}
+
+	return nil, err
+}
+
 // supportedMimeTypePath detects the matched mime type of given path, and returns whether it's supported or not.
 func supportedMimeTypePath(filepath string) (matchedMimeType string, supported bool, err error) {
-	var f *os.File
-	if f, err = os.Open(filepath); err == nil {
+	var f io.ReadCloser
+	if f, _, err = openFile(filepath); err == nil {
 		defer func() { _ = f.Close() }()
 
 		var mimeType *mimetype.MIME
@@ -679,7 +987,9 @@ func checkMimeType(mimeType *mimetype.MIME) (matched string, supported bool) {
 			// document formats
 			//
 			// https://ai.google.dev/gemini-api/docs/document-processing?lang=go#technical-details
-			//"application/pdf",
+			"application/pdf", // (texts of pages are extracted)
+			// (office documents and e-books are converted to texts)
+			docxMimeType, xlsxMimeType, pptxMimeType, odtMimeType, epubMimeType,
 			"application/x-javascript", "text/javascript",
 			"application/x-python", "text/x-python",
 			"text/plain",
@@ -779,7 +1089,10 @@ func ChunkText(
 }
 
 // runExecutable runs executable with given args and return its result.
+//
+// (the executable is killed when `ctx` is done)
 func runExecutable(
+	ctx context.Context,
 	execPath string,
 	args api.ToolCallFunctionArguments,
 ) (result string, err error) {
@@ -798,7 +1111,8 @@ func runExecutable(
 
 	// and run
 	cmdArgs := string(paramArgs)
-	cmd := exec.Command(execPath, cmdArgs)
+	cmd := exec.CommandContext(ctx, execPath, cmdArgs)
+	cmd.WaitDelay = time.Second // NOTE: don't wait for child processes which still hold the output after being killed
 	var output []byte
 	output, err = cmd.Output()
 	if err != nil {
@@ -817,7 +1131,7 @@ func runExecutable(
 func confirm(prompt string) bool {
 	reader := bufio.NewReader(os.Stdin)
 	for {
-		fmt.Printf("%s (y/N): ", prompt)
+		fmt.Fprintf(os.Stderr, "%s (y/N): ", prompt)
 
 		response, err := reader.ReadString('\n')
 		if err != nil {
@@ -839,7 +1153,7 @@ func confirm(prompt string) bool {
 
 // readFromStdin reads user input from stdin.
 func readFromStdin(prompt string) (string, error) {
-	fmt.Printf("%s: ", prompt)
+	fmt.Fprintf(os.Stderr, "%s: ", prompt)
 	reader := bufio.NewReader(os.Stdin)
 	return reader.ReadString('\n')
 }
@@ -859,35 +1173,76 @@ func duplicated[V comparable](arrs ...[]V) (value V, duplicated bool) {
 	return zero, false
 }
 
-// historyEndsWithUsers checks if the past generations end with users's message.
-func historyEndsWithUsers(history []api.Message) bool {
+// historyEndsWithToolResults checks if the past generations end with results of tool calls.
+func historyEndsWithToolResults(history []api.Message) bool {
 	if len(history) > 0 {
 		last := history[len(history)-1]
 
-		return last.Role == "user"
+		return last.Role == "tool"
 	}
 	return false
 }
 
-// appendUserMessageToPastGenerations appends a user message to the past generations.
-func appendUserMessageToPastGenerations(
+// appendToolCallsToPastGenerations appends tool calls of a model response to the past generations.
+func appendToolCallsToPastGenerations(
 	history []api.Message,
-	message string,
+	calls []api.ToolCall,
+) []api.Message {
+	if len(history) > 0 {
+		if last := &history[len(history)-1]; last.Role == "assistant" {
+			last.ToolCalls = append(last.ToolCalls, calls...)
+			return history
+		}
+	}
+	return append(history, api.Message{
+		Role:      "assistant",
+		ToolCalls: calls,
+	})
+}
+
+// appendToolResultToPastGenerations appends a result of given tool call to the past generations.
+func appendToolResultToPastGenerations(
+	history []api.Message,
+	call api.ToolCall,
+	result string,
 ) []api.Message {
 	return append(history, api.Message{
-		Role:    "user",
-		Content: message,
+		Role:       "tool",
+		ToolName:   call.Function.Name,
+		ToolCallID: call.ID,
+		Content:    result,
 	})
 }
 
+// toolCallRepeated checks if the same tool call (with the same arguments) exists in the history.
+//
+// NOTE: arguments are compared as JSON objects, so the order of their keys doesn't matter.
+func toolCallRepeated(
+	history []api.Message,
+	call api.ToolCall,
+) bool {
+	args, _ := json.Marshal(call.Function.Arguments.ToMap()) // (keys of maps are marshalled in sorted order)
+
+	for _, message := range history {
+		for _, past := range message.ToolCalls {
+			if past.Function.Name != call.Function.Name {
+				continue
+			}
+			if pastArgs, _ := json.Marshal(past.Function.Arguments.ToMap()); bytes.Equal(args, pastArgs) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // appendModelResponseToPastGenerations appends a model response to the past generations.
 func appendModelResponseToPastGenerations(
 	history []api.Message,
 	generated string,
 ) []api.Message {
 	if len(history) > 0 {
-		last := history[len(history)-1]
-		if last.Role == "assistant" {
+		if last := &history[len(history)-1]; last.Role == "assistant" {
 			last.Content += generated
 		} else {
 			history = append(history, api.Message{
@@ -906,6 +1261,23 @@ func appendModelResponseToPastGenerations(
 	return history
 }
 
+// appendModelThinkingToPastGenerations appends a model's thinking to the past generations.
+func appendModelThinkingToPastGenerations(
+	history []api.Message,
+	thinking string,
+) []api.Message {
+	if len(history) > 0 {
+		if last := &history[len(history)-1]; last.Role == "assistant" {
+			last.Thinking += thinking
+			return history
+		}
+	}
+	return append(history, api.Message{
+		Role:     "assistant",
+		Thinking: thinking,
+	})
+}
+
 // parseCommandline parses given commandline.
 func parseCommandline(cmdline string) (command string, args []string, err error) {
 	parser := syntax.NewParser()
@@ -973,7 +1345,7 @@ func ollamaAPIKey(conf config, output *outputWriter) (ollamaAPIKey string) {
 // webSearch searches for `query` on the web using the specified Ollama web search API.
 //
 // https://ollama.com/blog/web-search
-func webSearch(ollamaAPIKey string, query string) (results []SearchResultItem, err error) {
+func webSearch(ctx context.Context, ollamaAPIKey string, query string) (results []SearchResultItem, err error) {
 	httpClient := &http.Client{
 		Timeout: defaultFetchURLTimeoutSeconds * time.Second,
 	}
@@ -986,7 +1358,7 @@ func webSearch(ollamaAPIKey string, query string) (results []SearchResultItem, e
 	}
 
 	// request body and header
-	req, err := http.NewRequest("POST", "https://ollama.com/api/web_search", bytes.NewBuffer(jsonBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://ollama.com/api/web_search", bytes.NewBuffer(jsonBody))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create new request: %w", err)
 	}
@@ -3,9 +3,13 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
 	"slices"
 	"testing"
+
+	"github.com/ollama/ollama/api"
 )
 
 // test `expandPath` with various paths
@@ -81,3 +85,108 @@ func TestCommandlineParsing(t *testing.T) {
 		}
 	}
 }
+
+// testToolCall returns a tool call with given name and arguments (in JSON).
+func testToolCall(name, args string) api.ToolCall {
+	call := api.ToolCall{Function: api.ToolCallFunction{Name: name}}
+	_ = json.Unmarshal([]byte(args), &call.Function.Arguments)
+	return call
+}
+
+// test `appendToolCallsToPastGenerations`, `appendToolResultToPastGenerations`, and `historyEndsWithToolResults`
+// for pairing tool calls with their results
+func TestToolCallsAndResultsPairing(t *testing.T) {
+	type test struct {
+		name     string
+		history  []api.Message
+		calls    []api.ToolCall
+		results  []string
+		expected []string // roles (and numbers of tool calls) of messages
+		endsWith bool
+	}
+
+	tests := []test{
+		{
+			name:     "empty history",
+			calls:    []api.ToolCall{testToolCall("a", `{}`)},
+			results:  []string{"result a"},
+			expected: []string{"assistant(1)", "tool"},
+			endsWith: true,
+		},
+		{
+			name:     "appended to the last response",
+			history:  []api.Message{{Role: "user", Content: "hi"}, {Role: "assistant", Content: "let me see"}},
+			calls:    []api.ToolCall{testToolCall("a", `{}`), testToolCall("b", `{}`)},
+			results:  []string{"result a", "call skipped: b"},
+			expected: []string{"user", "assistant(2)", "tool", "tool"},
+			endsWith: true,
+		},
+		{
+			name:     "after results of previous tool calls",
+			history:  []api.Message{{Role: "assistant", ToolCalls: []api.ToolCall{testToolCall("a", `{}`)}}, {Role: "tool", Content: "result a"}},
+			calls:    []api.ToolCall{testToolCall("b", `{}`)},
+			results:  []string{"result b"},
+			expected: []string{"assistant(1)", "tool", "assistant(1)", "tool"},
+			endsWith: true,
+		},
+		{
+			name:     "without results",
+			history:  []api.Message{{Role: "user", Content: "hi"}},
+			calls:    []api.ToolCall{testToolCall("a", `{}`)},
+			expected: []string{"user", "assistant(1)"},
+			endsWith: false,
+		},
+	}
+
+	for _, test := range tests {
+		history := appendToolCallsToPastGenerations(slices.Clone(test.history), test.calls)
+		for i, result := range test.results {
+			history = appendToolResultToPastGenerations(history, test.calls[i], result)
+		}
+
+		roles := []string{}
+		for _, message := range history {
+			if len(message.ToolCalls) > 0 {
+				roles = append(roles, fmt.Sprintf("%s(%d)", message.Role, len(message.ToolCalls)))
+			} else {
+				roles = append(roles, message.Role)
+			}
+		}
+		if !slices.Equal(roles, test.expected) {
+			t.Errorf("[%s] expected %v, got %v", test.name, test.expected, roles)
+		}
+		if endsWith := historyEndsWithToolResults(history); endsWith != test.endsWith {
+			t.Errorf("[%s] expected %v for ending with tool results, got %v", test.name, test.endsWith, endsWith)
+		}
+	}
+}
+
+// test `toolCallRepeated` for comparing arguments of tool calls as JSON objects
+func TestToolCallRepeated(t *testing.T) {
+	history := []api.Message{
+		{Role: "user", Content: "hi"},
+		{Role: "assistant", ToolCalls: []api.ToolCall{
+			testToolCall("search", `{"query": "ollama", "options": {"limit": 10, "safe": true}}`),
+		}},
+		{Role: "tool", Content: "result"},
+	}
+
+	type test struct {
+		call     api.ToolCall
+		repeated bool
+	}
+
+	tests := []test{
+		{call: testToolCall("search", `{"query": "ollama", "options": {"limit": 10, "safe": true}}`), repeated: true},
+		{call: testToolCall("search", `{"options": {"safe": true, "limit": 10}, "query": "ollama"}`), repeated: true}, // (in different orders)
+		{call: testToolCall("search", `{"query": "ollama", "options": {"limit": 20, "safe": true}}`), repeated: false},
+		{call: testToolCall("search", `{"query": "ollama"}`), repeated: false},
+		{call: testToolCall("fetch", `{"query": "ollama", "options": {"limit": 10, "safe": true}}`), repeated: false},
+	}
+
+	for _, test := range tests {
+		if repeated := toolCallRepeated(history, test.call); repeated != test.repeated {
+			t.Errorf("expected %v for %s(%s), got %v", test.repeated, test.call.Function.Name, test.call.Function.Arguments.String(), repeated)
+		}
+	}
+}
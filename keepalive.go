@@ -0,0 +1,169 @@
+// keepalive.go
+//
+// things for keeping models loaded in memory, and preloading/unloading them
+//
+// https://github.com/ollama/ollama/blob/main/docs/faq.md#how-do-i-keep-a-model-loaded-in-memory-or-make-it-unload-immediately
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/ollama/ollama/api"
+	mdl "github.com/ollama/ollama/types/model"
+)
+
+// parseKeepAlive parses given keep-alive value.
+//
+// It can be a duration string (eg. '10m', '1h30m'), or a number of seconds (eg. '300'),
+// and a negative value (eg. '-1') means keeping the model loaded forever.
+func parseKeepAlive(value string) (*api.Duration, error) {
+	value = strings.TrimSpace(value)
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return &api.Duration{Duration: -1}, nil
+		}
+		return &api.Duration{Duration: time.Duration(seconds) * time.Second}, nil
+	}
+	if duration, err := time.ParseDuration(value); err == nil {
+		if duration < 0 {
+			return &api.Duration{Duration: -1}, nil
+		}
+		return &api.Duration{Duration: duration}, nil
+	}
+
+	return nil, fmt.Errorf("invalid keep-alive value: '%s' (should be a duration like '10m', or a number of seconds)", value)
+}
+
+// resolveKeepAlive resolves the keep-alive value from params and config.
+//
+// Returns nil if it is not given (the server's default will be used).
+func resolveKeepAlive(conf config, p params) (*api.Duration, error) {
+	if p.KeepAlive != nil {
+		return parseKeepAlive(*p.KeepAlive)
+	}
+	if conf.KeepAlive != nil {
+		return parseKeepAlive(*conf.KeepAlive)
+	}
+	return nil, nil
+}
+
+// doPreloadModel loads a model into memory with an empty request.
+func doPreloadModel(
+	ctx context.Context,
+	output *outputWriter,
+	conf config,
+	p params,
+) (exit int, e error) {
+	model := *p.PreloadModel
+
+	keepAlive, err := resolveKeepAlive(conf, p)
+	if err != nil {
+		return 1, err
+	}
+
+	output.verbose(
+		verboseMedium,
+		p.Verbose,
+		"preloading model '%s'...",
+		model,
+	)
+
+	if err := sendEmptyRequest(ctx, conf, model, keepAlive); err != nil {
+		return 1, fmt.Errorf("failed to preload model '%s': %w", model, err)
+	}
+
+	output.printColored(
+		color.FgGreen,
+		"Preloaded model '%s'.\n",
+		model,
+	)
+
+	return 0, nil
+}
+
+// doUnloadModel unloads a model from memory with an empty request.
+func doUnloadModel(
+	ctx context.Context,
+	output *outputWriter,
+	conf config,
+	p params,
+) (exit int, e error) {
+	model := *p.UnloadModel
+
+	output.verbose(
+		verboseMedium,
+		p.Verbose,
+		"unloading model '%s'...",
+		model,
+	)
+
+	if err := sendEmptyRequest(ctx, conf, model, &api.Duration{Duration: 0}); err != nil {
+		return 1, fmt.Errorf("failed to unload model '%s': %w", model, err)
+	}
+
+	output.printColored(
+		color.FgGreen,
+		"Unloaded model '%s'.\n",
+		model,
+	)
+
+	return 0, nil
+}
+
+// sendEmptyRequest sends an empty request to the model with given keep-alive value,
+// for loading it into (or unloading it from) memory.
+func sendEmptyRequest(
+	ctx context.Context,
+	conf config,
+	model string,
+	keepAlive *api.Duration,
+) error {
+	ctx, cancel := context.WithTimeout(
+		ctx,
+		time.Duration(conf.TimeoutSeconds)*time.Second,
+	)
+	defer cancel()
+
+	// ollama api client
+	client, err := newOllamaClient()
+	if err != nil {
+		return fmt.Errorf("failed to initialize Ollama API client: %w", err)
+	}
+
+	// NOTE: embedding models do not support generation, so send an empty embedding request instead
+	shown, err := client.Show(ctx, &api.ShowRequest{
+		Model: model,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get model(%s) info: %w", model, err)
+	}
+	if slices.Contains(shown.Capabilities, mdl.CapabilityEmbedding) &&
+		!slices.Contains(shown.Capabilities, mdl.CapabilityCompletion) {
+		_, err = client.Embed(ctx, &api.EmbedRequest{
+			Model:     model,
+			KeepAlive: keepAlive,
+		})
+		return err
+	}
+
+	stream := false
+	return client.Generate(
+		ctx,
+		&api.GenerateRequest{
+			Model:     model,
+			Stream:    &stream,
+			KeepAlive: keepAlive,
+		},
+		func(_ api.GenerateResponse) error {
+			return nil
+		},
+	)
+}
@@ -0,0 +1,38 @@
+// keepalive_test.go
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// test `parseKeepAlive` for durations and seconds
+func TestParseKeepAlive(t *testing.T) {
+	type test struct {
+		value    string
+		expected time.Duration
+	}
+
+	tests := []test{
+		{value: "10m", expected: 10 * time.Minute},
+		{value: "1h30m", expected: 90 * time.Minute},
+		{value: "300", expected: 300 * time.Second},
+		{value: "0", expected: 0},
+		{value: "-1", expected: -1},
+		{value: "-5m", expected: -1},
+	}
+
+	for _, test := range tests {
+		parsed, err := parseKeepAlive(test.value)
+		if err != nil {
+			t.Errorf("failed to parse keep-alive '%s': %s", test.value, err)
+		} else if parsed.Duration != test.expected {
+			t.Errorf("expected %v for '%s', got %v", test.expected, test.value, parsed.Duration)
+		}
+	}
+
+	if _, err := parseKeepAlive("forever"); err == nil {
+		t.Errorf("expected error for invalid keep-alive value")
+	}
+}
@@ -43,18 +43,28 @@ func verboseLevel(
 // output writer for managing printings to stdout/stderr
 type outputWriter struct {
 	endsWithNewLine bool
+
+	markdown *markdownRenderer // NOTE: nil if markdown rendering is not enabled
+
+	format outputFormat
+	result outputResult // NOTE: accumulated in JSON format
 }
 
 // newOutputWriter generates a new output writer.
 func newOutputWriter() *outputWriter {
 	return &outputWriter{
 		endsWithNewLine: true,
+		format:          outputFormatText,
 	}
 }
 
 // println force-adds a new line.
 func (w *outputWriter) println() {
-	fmt.Println()
+	if w.machineReadable() {
+		fmt.Fprintln(os.Stderr)
+	} else {
+		fmt.Println()
+	}
 	w.endsWithNewLine = true
 }
 
@@ -66,11 +76,20 @@ func (w *outputWriter) makeSureToEndWithNewLine() {
 }
 
 // printColored prints given string to stdout with color (if possible).
+//
+// (printed to stderr instead, if the output is in a machine-readable format)
 func (w *outputWriter) printColored(
 	c color.Attribute,
 	format string,
 	a ...any,
 ) {
+	if w.machineReadable() {
+		w.errorColored(c, format, a...)
+		return
+	}
+
+	w.flushMarkdown()
+
 	formatted := fmt.Sprintf(format, a...)
 
 	if supportscolor.Stdout().SupportsColor { // if color is supported,
@@ -83,12 +102,29 @@ func (w *outputWriter) printColored(
 	w.endsWithNewLine = strings.HasSuffix(formatted, "\n")
 }
 
+// printGenerated prints given generated content to stdout with color (if possible).
+//
+// (not printed if the output is in a machine-readable format, as it will be emitted in other ways)
+func (w *outputWriter) printGenerated(
+	c color.Attribute,
+	format string,
+	a ...any,
+) {
+	if w.machineReadable() {
+		return
+	}
+
+	w.printColored(c, format, a...)
+}
+
 // errorColored prints given string to stderr with color (if possible).
 func (w *outputWriter) errorColored(
 	c color.Attribute,
 	format string,
 	a ...any,
 ) {
+	w.flushMarkdown()
+
 	formatted := fmt.Sprintf(format, a...)
 
 	if supportscolor.Stderr().SupportsColor { // if color is supported,
@@ -198,7 +234,7 @@ func (w *outputWriter) printErrorBeforeExit(
 	a ...any,
 ) (exit int) {
 	if code > 0 {
-		w.error(format, a...)
+		w.emitError(format, a...)
 	}
 
 	return code
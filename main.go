@@ -23,6 +23,11 @@ func main() {
 	var p params
 	parser := flags.NewParser(&p, flags.HelpFlag|flags.PassDoubleDash)
 	if remaining, err := parser.Parse(); err == nil {
+		// set output format
+		if p.OutputFormat != nil {
+			output.format = outputFormat(*p.OutputFormat)
+		}
+
 		// check if multiple tasks were requested at a time
 		if p.multipleTaskRequested() {
 			output.error("Input error: multiple tasks were requested at a time.")
@@ -46,9 +51,10 @@ func main() {
 		}
 
 		// read from standard input, if any
+		// (not in chat mode, where standard input is read line by line)
 		var stdin []byte
 		stat, _ := os.Stdin.Stat()
-		if (stat.Mode() & os.ModeCharDevice) == 0 {
+		if !p.Chat && (stat.Mode()&os.ModeCharDevice) == 0 {
 			stdin, _ = io.ReadAll(os.Stdin)
 		}
 		if len(stdin) > 0 {
@@ -70,6 +76,7 @@ func main() {
 
 		// run with params
 		exit, err := run(output, parser, p)
+		output.printResult(exit, err)
 
 		if err != nil {
 			os.Exit(output.printErrorBeforeExit(exit, "Error: %s", err))
@@ -0,0 +1,630 @@
+// markdown.go
+//
+// things for rendering generated markdown contents in terminal
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/fatih/color"
+	"github.com/jwalton/go-supportscolor"
+)
+
+// markdown renderer which renders streamed contents line by line
+//
+// (complete lines are rendered as soon as they are streamed in,
+// but rows of a table are kept until the table ends, for aligning their columns)
+type markdownRenderer struct {
+	pending string // incomplete line which is not rendered yet
+
+	inCodeBlock  bool
+	codeFence    string
+	codeLanguage string
+
+	tableRows []string
+}
+
+var (
+	markdownHeadingRegexp       = regexp.MustCompile(`^ {0,3}(#{1,6})\s+(.*?)\s*#*\s*$`)
+	markdownUnorderedListRegexp = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	markdownOrderedListRegexp   = regexp.MustCompile(`^(\s*)(\d+[.)])\s+(.*)$`)
+	markdownTaskRegexp          = regexp.MustCompile(`^\[([ xX])\]\s+(.*)$`)
+	markdownBlockquoteRegexp    = regexp.MustCompile(`^ {0,3}>\s?(.*)$`)
+	markdownRuleRegexp          = regexp.MustCompile(`^ {0,3}(?:(?:-\s*){3,}|(?:\*\s*){3,}|(?:_\s*){3,})$`)
+	markdownTableSepRegexp      = regexp.MustCompile(`^\s*:?-+:?\s*$`)
+	markdownLinkRegexp          = regexp.MustCompile(`^\[([^\]]+)\]\(([^)\s]+)\)`)
+	ansiEscapeRegexp            = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+)
+
+// styles for rendering markdown
+var (
+	mdStyleHeading    = color.New(color.FgHiCyan, color.Bold)
+	mdStyleBold       = color.New(color.Bold)
+	mdStyleItalic     = color.New(color.Italic)
+	mdStyleStrike     = color.New(color.CrossedOut)
+	mdStyleInlineCode = color.New(color.FgHiYellow)
+	mdStyleLink       = color.New(color.FgHiBlue, color.Underline)
+	mdStyleURL        = color.New(color.FgHiBlack)
+	mdStyleBullet     = color.New(color.FgHiCyan)
+	mdStyleQuote      = color.New(color.FgHiBlack, color.Italic)
+	mdStyleRule       = color.New(color.FgHiBlack)
+	mdStyleFence      = color.New(color.FgHiBlack)
+	mdStyleTableLine  = color.New(color.FgHiBlack)
+
+	mdStyleKeyword = color.New(color.FgHiMagenta)
+	mdStyleString  = color.New(color.FgGreen)
+	mdStyleNumber  = color.New(color.FgYellow)
+	mdStyleComment = color.New(color.FgHiBlack, color.Italic)
+)
+
+// keywords of languages for syntax highlighting
+var codeKeywords = map[string][]string{
+	"go": {
+		"break", "case", "chan", "const", "continue", "default", "defer", "else", "fallthrough", "for", "func",
+		"go", "goto", "if", "import", "interface", "map", "package", "range", "return", "select", "struct",
+		"switch", "type", "var", "nil", "true", "false",
+	},
+	"python": {
+		"and", "as", "assert", "async", "await", "break", "class", "continue", "def", "del", "elif", "else",
+		"except", "finally", "for", "from", "global", "if", "import", "in", "is", "lambda", "nonlocal", "not",
+		"or", "pass", "raise", "return", "try", "while", "with", "yield", "None", "True", "False",
+	},
+	"javascript": {
+		"async", "await", "break", "case", "catch", "class", "const", "continue", "default", "delete", "do",
+		"else", "export", "extends", "finally", "for", "function", "if", "import", "in", "instanceof", "let",
+		"new", "return", "switch", "this", "throw", "try", "typeof", "var", "void", "while", "yield", "null",
+		"undefined", "true", "false", "interface", "type", "enum", "implements",
+	},
+	"rust": {
+		"as", "async", "await", "break", "const", "continue", "crate", "else", "enum", "extern", "fn", "for",
+		"if", "impl", "in", "let", "loop", "match", "mod", "move", "mut", "pub", "ref", "return", "self",
+		"Self", "static", "struct", "super", "trait", "type", "unsafe", "use", "where", "while", "true", "false",
+	},
+	"c": {
+		"auto", "break", "case", "char", "class", "const", "continue", "default", "do", "double", "else",
+		"enum", "extern", "final", "float", "for", "if", "import", "int", "long", "namespace", "new", "null",
+		"nullptr", "package", "private", "protected", "public", "return", "short", "static", "struct",
+		"switch", "template", "this", "throw", "try", "catch", "typedef", "union", "unsigned", "void",
+		"while", "true", "false", "bool", "boolean", "var", "val", "fun", "func", "let",
+	},
+	"shell": {
+		"if", "then", "else", "elif", "fi", "for", "in", "do", "done", "while", "until", "case", "esac",
+		"function", "return", "local", "export", "echo", "exit",
+	},
+	"sql": {
+		"select", "from", "where", "insert", "into", "values", "update", "set", "delete", "create", "table",
+		"drop", "alter", "join", "left", "right", "inner", "outer", "on", "group", "by", "order", "having",
+		"limit", "and", "or", "not", "null", "as", "distinct", "index", "primary", "key",
+	},
+}
+
+// aliases of languages for syntax highlighting
+var codeLanguageAliases = map[string]string{
+	"golang":     "go",
+	"py":         "python",
+	"js":         "javascript",
+	"jsx":        "javascript",
+	"ts":         "javascript",
+	"tsx":        "javascript",
+	"typescript": "javascript",
+	"rs":         "rust",
+	"cpp":        "c",
+	"c++":        "c",
+	"csharp":     "c",
+	"java":       "c",
+	"kotlin":     "c",
+	"swift":      "c",
+	"dart":       "c",
+	"scala":      "c",
+	"sh":         "shell",
+	"bash":       "shell",
+	"zsh":        "shell",
+}
+
+// markdownRenderingAvailable checks if markdown can be rendered to stdout
+// (stdout is a terminal which supports colors).
+func markdownRenderingAvailable() bool {
+	if stat, err := os.Stdout.Stat(); err != nil || (stat.Mode()&os.ModeCharDevice) == 0 {
+		return false
+	}
+	return supportscolor.Stdout().SupportsColor
+}
+
+// enableMarkdownRendering enables rendering of generated markdown contents,
+// and returns whether it was enabled.
+//
+// (falls back to plain texts if stdout is not a terminal, colors are not supported,
+// or the output is in a machine-readable format)
+func (w *outputWriter) enableMarkdownRendering() bool {
+	if w.machineReadable() || !markdownRenderingAvailable() {
+		return false
+	}
+
+	w.markdown = &markdownRenderer{}
+
+	return true
+}
+
+// printContent prints given generated content to stdout,
+// rendering it as markdown if enabled.
+func (w *outputWriter) printContent(content string) {
+	if w.markdown == nil {
+		w.printGenerated(color.FgHiWhite, "%s", content)
+		return
+	}
+	if w.machineReadable() {
+		return
+	}
+
+	w.printRendered(w.markdown.write(content))
+}
+
+// flushMarkdown renders and prints the pending content of markdown renderer, if any.
+//
+// (called before printing other things, so that they don't get mixed up)
+func (w *outputWriter) flushMarkdown() {
+	if w.markdown == nil {
+		return
+	}
+
+	w.printRendered(w.markdown.flush())
+}
+
+// finishMarkdown flushes the markdown renderer and resets its states (eg. at the end of a generation).
+func (w *outputWriter) finishMarkdown() {
+	if w.markdown == nil {
+		return
+	}
+
+	w.flushMarkdown()
+	w.markdown = &markdownRenderer{}
+}
+
+// printRendered prints given rendered string to stdout.
+func (w *outputWriter) printRendered(rendered string) {
+	if len(rendered) <= 0 {
+		return
+	}
+
+	fmt.Print(rendered)
+	w.endsWithNewLine = strings.HasSuffix(rendered, "\n")
+}
+
+// write appends given streamed content, and returns the rendered string of completed lines.
+func (r *markdownRenderer) write(content string) string {
+	r.pending += content
+
+	var sb strings.Builder
+	for {
+		idx := strings.IndexByte(r.pending, '\n')
+		if idx < 0 {
+			break
+		}
+		line := strings.TrimSuffix(r.pending[:idx], "\r")
+		r.pending = r.pending[idx+1:]
+
+		sb.WriteString(r.renderLine(line))
+	}
+	return sb.String()
+}
+
+// flush returns the rendered string of the pending line and table rows.
+//
+// (the pending line is rendered without a trailing newline)
+func (r *markdownRenderer) flush() string {
+	var sb strings.Builder
+
+	if len(r.pending) > 0 {
+		line := r.pending
+		r.pending = ""
+
+		if !r.inCodeBlock && isTableRow(line) {
+			// NOTE: an incomplete table row is printed as it is
+			sb.WriteString(r.renderTable())
+			sb.WriteString(renderInline(line))
+		} else {
+			sb.WriteString(strings.TrimSuffix(r.renderLine(line), "\n"))
+		}
+	} else {
+		sb.WriteString(r.renderTable())
+	}
+
+	return sb.String()
+}
+
+// renderLine renders a complete line (with a trailing newline).
+func (r *markdownRenderer) renderLine(line string) string {
+	// code blocks
+	if r.inCodeBlock {
+		if closesCodeFence(line, r.codeFence) {
+			r.inCodeBlock = false
+			return mdStyleFence.Sprint(line) + "\n"
+		}
+		return highlightCode(line, r.codeLanguage) + "\n"
+	}
+	if matches := codeFenceOpenRegexp.FindStringSubmatch(line); matches != nil {
+		rendered := r.renderTable()
+
+		r.inCodeBlock = true
+		r.codeFence = matches[1]
+		r.codeLanguage, _ = parseInfoString(strings.TrimSpace(matches[2]))
+
+		return rendered + mdStyleFence.Sprint(line) + "\n"
+	}
+
+	// tables
+	if isTableRow(line) {
+		r.tableRows = append(r.tableRows, line)
+		return ""
+	}
+	rendered := r.renderTable()
+
+	return rendered + renderBlockLine(line) + "\n"
+}
+
+// renderTable renders kept table rows with aligned columns, and clears them.
+//
+// (rows without a valid separator row are rendered as plain lines)
+func (r *markdownRenderer) renderTable() string {
+	rows := r.tableRows
+	r.tableRows = nil
+	if len(rows) <= 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+
+	// without a separator row, it is not a table
+	if len(rows) < 2 || !isTableSeparator(rows[1]) {
+		for _, row := range rows {
+			sb.WriteString(renderInline(row) + "\n")
+		}
+		return sb.String()
+	}
+
+	// render cells, and calculate widths of columns
+	cells := [][]string{}
+	widths := []int{}
+	for i, row := range rows {
+		if i == 1 { // separator
+			continue
+		}
+		rendered := []string{}
+		for j, cell := range splitTableRow(row) {
+			if i == 0 {
+				cell = mdStyleBold.Sprint(stripInlineMarkers(cell))
+			} else {
+				cell = renderInline(cell)
+			}
+			rendered = append(rendered, cell)
+
+			if j >= len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[j] = max(widths[j], displayWidth(cell))
+		}
+		cells = append(cells, rendered)
+	}
+	aligns := splitTableRow(rows[1])
+
+	separator := mdStyleTableLine.Sprint(" │ ")
+	for i, row := range cells {
+		padded := []string{}
+		for j, width := range widths {
+			cell := ""
+			if j < len(row) {
+				cell = row[j]
+			}
+			align := ""
+			if j < len(aligns) {
+				align = aligns[j]
+			}
+			padded = append(padded, padCell(cell, width, align))
+		}
+		sb.WriteString(strings.TrimRight(strings.Join(padded, separator), " ") + "\n")
+
+		// line below the header
+		if i == 0 {
+			lines := []string{}
+			for _, width := range widths {
+				lines = append(lines, strings.Repeat("─", width))
+			}
+			sb.WriteString(mdStyleTableLine.Sprint(strings.Join(lines, "─┼─")) + "\n")
+		}
+	}
+
+	return sb.String()
+}
+
+// renderBlockLine renders a line which is not in a code block or table.
+func renderBlockLine(line string) string {
+	if matches := markdownHeadingRegexp.FindStringSubmatch(line); matches != nil {
+		return mdStyleHeading.Sprint(stripInlineMarkers(matches[2]))
+	}
+	if markdownRuleRegexp.MatchString(line) {
+		return mdStyleRule.Sprint(strings.Repeat("─", 40))
+	}
+	if matches := markdownBlockquoteRegexp.FindStringSubmatch(line); matches != nil {
+		return mdStyleQuote.Sprint("│ ") + mdStyleQuote.Sprint(stripInlineMarkers(matches[1]))
+	}
+	if matches := markdownUnorderedListRegexp.FindStringSubmatch(line); matches != nil {
+		bullet := "•"
+		item := matches[2]
+		if task := markdownTaskRegexp.FindStringSubmatch(item); task != nil {
+			if task[1] == " " {
+				bullet = "☐"
+			} else {
+				bullet = "☑"
+			}
+			item = task[2]
+		}
+		return matches[1] + mdStyleBullet.Sprint(bullet) + " " + renderInline(item)
+	}
+	if matches := markdownOrderedListRegexp.FindStringSubmatch(line); matches != nil {
+		return matches[1] + mdStyleBullet.Sprint(matches[2]) + " " + renderInline(matches[3])
+	}
+
+	return renderInline(line)
+}
+
+// renderInline renders inline elements (emphasis, code spans, links, ...) of given text.
+func renderInline(text string) string {
+	return renderInlineWith(text, func(c *color.Color, str string) string {
+		return c.Sprint(str)
+	})
+}
+
+// renderInlineWith renders inline elements of given text with `style` function.
+func renderInlineWith(
+	text string,
+	style func(c *color.Color, str string) string,
+) string {
+	var sb strings.Builder
+
+	for i := 0; i < len(text); {
+		rest := text[i:]
+
+		// code spans
+		if rest[0] == '`' {
+			if end := strings.IndexByte(rest[1:], '`'); end > 0 {
+				sb.WriteString(style(mdStyleInlineCode, rest[1:end+1]))
+				i += end + 2
+				continue
+			}
+		}
+
+		// links
+		if rest[0] == '[' {
+			if matches := markdownLinkRegexp.FindStringSubmatch(rest); matches != nil {
+				sb.WriteString(style(mdStyleLink, matches[1]))
+				sb.WriteString(style(mdStyleURL, " ("+matches[2]+")"))
+				i += len(matches[0])
+				continue
+			}
+		}
+
+		// emphasis
+		if inner, consumed, ok := matchDelimited(text, i, "**"); ok {
+			sb.WriteString(style(mdStyleBold, inner))
+			i += consumed
+			continue
+		}
+		if inner, consumed, ok := matchDelimited(text, i, "__"); ok {
+			sb.WriteString(style(mdStyleBold, inner))
+			i += consumed
+			continue
+		}
+		if inner, consumed, ok := matchDelimited(text, i, "~~"); ok {
+			sb.WriteString(style(mdStyleStrike, inner))
+			i += consumed
+			continue
+		}
+		if inner, consumed, ok := matchDelimited(text, i, "*"); ok {
+			sb.WriteString(style(mdStyleItalic, inner))
+			i += consumed
+			continue
+		}
+		if inner, consumed, ok := matchDelimited(text, i, "_"); ok {
+			sb.WriteString(style(mdStyleItalic, inner))
+			i += consumed
+			continue
+		}
+
+		sb.WriteByte(text[i])
+		i++
+	}
+
+	return sb.String()
+}
+
+// matchDelimited matches an inline element delimited with `delim` at index `i` of given text,
+// and returns its inner text and the number of consumed bytes.
+func matchDelimited(text string, i int, delim string) (inner string, consumed int, ok bool) {
+	if !strings.HasPrefix(text[i:], delim) {
+		return "", 0, false
+	}
+
+	// NOTE: '_' inside words (eg. snake_case) is not an emphasis
+	if delim[0] == '_' && i > 0 && isWordByte(text[i-1]) {
+		return "", 0, false
+	}
+
+	start := i + len(delim)
+	if start >= len(text) || text[start] == ' ' || strings.HasPrefix(text[start:], delim[:1]) {
+		return "", 0, false
+	}
+	end := strings.Index(text[start:], delim)
+	if end <= 0 || text[start+end-1] == ' ' {
+		return "", 0, false
+	}
+	if after := start + end + len(delim); delim[0] == '_' && after < len(text) && isWordByte(text[after]) {
+		return "", 0, false
+	}
+
+	return text[start : start+end], end + len(delim)*2, true
+}
+
+// isWordByte checks if given byte is a part of a word.
+func isWordByte(b byte) bool {
+	return b == '_' || b >= utf8.RuneSelf || unicode.IsLetter(rune(b)) || unicode.IsDigit(rune(b))
+}
+
+// stripInlineMarkers removes markers of inline elements from given text.
+func stripInlineMarkers(text string) string {
+	return renderInlineWith(text, func(_ *color.Color, str string) string {
+		return str
+	})
+}
+
+// isTableRow checks if given line looks like a row of a table.
+func isTableRow(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return len(trimmed) > 1 && strings.HasPrefix(trimmed, "|")
+}
+
+// isTableSeparator checks if given line is a separator row of a table (eg. "|---|:-:|").
+func isTableSeparator(line string) bool {
+	cells := splitTableRow(line)
+	if len(cells) <= 0 {
+		return false
+	}
+	for _, cell := range cells {
+		if !markdownTableSepRegexp.MatchString(cell) {
+			return false
+		}
+	}
+	return true
+}
+
+// splitTableRow splits given row of a table into trimmed cells.
+func splitTableRow(row string) (cells []string) {
+	row = strings.TrimSpace(row)
+	row = strings.TrimPrefix(row, "|")
+	row = strings.TrimSuffix(row, "|")
+
+	for cell := range strings.SplitSeq(row, "|") {
+		cells = append(cells, strings.TrimSpace(cell))
+	}
+	return cells
+}
+
+// padCell pads given (rendered) cell to the width, with the alignment from its separator (eg. ":-:").
+func padCell(cell string, width int, align string) string {
+	padding := max(0, width-displayWidth(cell))
+
+	switch {
+	case strings.HasPrefix(align, ":") && strings.HasSuffix(align, ":"):
+		left := padding / 2
+		return strings.Repeat(" ", left) + cell + strings.Repeat(" ", padding-left)
+	case strings.HasSuffix(align, ":"):
+		return strings.Repeat(" ", padding) + cell
+	default:
+		return cell + strings.Repeat(" ", padding)
+	}
+}
+
+// displayWidth returns the width of given (rendered) string in terminal.
+//
+// (ANSI escape sequences are ignored, and wide characters like CJK are counted as 2)
+func displayWidth(str string) (width int) {
+	for _, r := range ansiEscapeRegexp.ReplaceAllString(str, "") {
+		if unicode.Is(unicode.Han, r) ||
+			unicode.Is(unicode.Hangul, r) ||
+			unicode.Is(unicode.Hiragana, r) ||
+			unicode.Is(unicode.Katakana, r) ||
+			(r >= 0xFF01 && r <= 0xFF60) || // fullwidth forms
+			(r >= 0x1F300 && r <= 0x1FAFF) { // emojis
+			width += 2
+		} else if unicode.IsPrint(r) {
+			width++
+		}
+	}
+	return width
+}
+
+// highlightCode highlights a line of code in given language.
+//
+// (a simple highlighter for keywords, strings, numbers, and line comments)
+func highlightCode(line, language string) string {
+	if alias, exists := codeLanguageAliases[language]; exists {
+		language = alias
+	}
+	keywords, exists := codeKeywords[language]
+	if !exists {
+		return line
+	}
+
+	commentPrefix := "//"
+	switch language {
+	case "python", "shell":
+		commentPrefix = "#"
+	case "sql":
+		commentPrefix = "--"
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(line); {
+		rest := line[i:]
+
+		// comments
+		if strings.HasPrefix(rest, commentPrefix) {
+			sb.WriteString(mdStyleComment.Sprint(rest))
+			break
+		}
+
+		// strings
+		if c := rest[0]; c == '"' || c == '\'' || c == '`' {
+			end := 1
+			for end < len(rest) && rest[end] != c {
+				if rest[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end = min(end+1, len(rest))
+			sb.WriteString(mdStyleString.Sprint(rest[:end]))
+			i += end
+			continue
+		}
+
+		// words and numbers
+		if isWordByte(rest[0]) {
+			end := 1
+			for end < len(rest) && (isWordByte(rest[end]) || (rest[0] >= '0' && rest[0] <= '9' && rest[end] == '.')) {
+				end++
+			}
+			word := rest[:end]
+			switch {
+			case word[0] >= '0' && word[0] <= '9':
+				sb.WriteString(mdStyleNumber.Sprint(word))
+			case isKeyword(keywords, word, language == "sql"):
+				sb.WriteString(mdStyleKeyword.Sprint(word))
+			default:
+				sb.WriteString(word)
+			}
+			i += end
+			continue
+		}
+
+		sb.WriteByte(rest[0])
+		i++
+	}
+
+	return sb.String()
+}
+
+// isKeyword checks if given word is one of the keywords.
+func isKeyword(keywords []string, word string, caseInsensitive bool) bool {
+	for _, keyword := range keywords {
+		if keyword == word || (caseInsensitive && strings.EqualFold(keyword, word)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+// markdown_test.go
+
+package main
+
+import (
+	"testing"
+
+	"github.com/fatih/color"
+)
+
+// test `markdownRenderer` with streamed (and split) markdown contents
+func TestMarkdownRenderer(t *testing.T) {
+	color.NoColor = true
+
+	type test struct {
+		chunks   []string
+		expected string
+	}
+
+	tests := []test{
+		// headings, lists, and inline elements
+		{
+			chunks:   []string{"# Ti", "tle\n- **bo", "ld** and `code`\n1. [link](https://exa", "mple.com)\n- [x] done\n"},
+			expected: "Title\n• bold and code\n1. link (https://example.com)\n☑ done\n",
+		},
+		// snake_case should not be rendered as emphasis
+		{
+			chunks:   []string{"some_snake_case_name and _italic_\n"},
+			expected: "some_snake_case_name and italic\n",
+		},
+		// code blocks should be kept as they are
+		{
+			chunks:   []string{"```go\n# not a heading\n- not a list\n```\n"},
+			expected: "```go\n# not a heading\n- not a list\n```\n",
+		},
+		// tables should be aligned
+		{
+			chunks:   []string{"| a | bb |\n|---|---:|\n| ccc | d |\n", "after\n"},
+			expected: "a   │ bb\n────┼───\nccc │  d\nafter\n",
+		},
+		// pending line should be flushed without a trailing newline
+		{
+			chunks:   []string{"**unfinished**"},
+			expected: "unfinished",
+		},
+	}
+
+	for _, test := range tests {
+		r := &markdownRenderer{}
+		rendered := ""
+		for _, chunk := range test.chunks {
+			rendered += r.write(chunk)
+		}
+		rendered += r.flush()
+
+		if rendered != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, rendered)
+		}
+	}
+}
@@ -6,9 +6,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"maps"
 	"net"
 	"net/http"
+	"os"
 	"os/exec"
+	"slices"
 	"strings"
 	"time"
 
@@ -153,14 +156,53 @@ func fetchToolCallResult(
 	return res, err
 }
 
-// mcpConnect connects to MCP server, starts, initializes, and returns the client.
+// mcpToolResultToText converts the result of MCP tool call to a text,
+// for sending it back to the model.
+func mcpToolResultToText(res *mcp.CallToolResult) string {
+	if res == nil {
+		return ""
+	}
+
+	texts := []string{}
+	for _, content := range res.Content {
+		switch c := content.(type) {
+		case *mcp.TextContent:
+			texts = append(texts, c.Text)
+		default:
+			texts = append(texts, prettify(c))
+		}
+	}
+	if len(texts) <= 0 && res.StructuredContent != nil {
+		texts = append(texts, prettify(res.StructuredContent))
+	}
+	text := strings.Join(texts, "\n")
+
+	if res.IsError {
+		return "Error: " + text
+	}
+	return text
+}
+
+// mcpConnect connects to MCP server (with given HTTP headers), starts, initializes, and returns the client.
 func mcpConnect(
 	ctx context.Context,
 	url string,
+	headers map[string]string,
 ) (connection *mcp.ClientSession, err error) {
+	httpClient := mcpHTTPClient()
+	if len(headers) > 0 {
+		httpClient = &http.Client{
+			Timeout: httpClient.Timeout,
+			Transport: &headersTransport{
+				base:    httpClient.Transport,
+				headers: headers,
+			},
+		}
+	}
+
 	streamable := &mcp.StreamableClientTransport{
 		Endpoint:   url,
-		HTTPClient: mcpHTTPClient(),
+		HTTPClient: httpClient,
 		MaxRetries: mcpMaxRetries,
 	}
 
@@ -183,11 +225,12 @@ func mcpConnect(
 	return nil, err
 }
 
-// mcpRun launches MCP server with given `cmdline` and connects to it,
+// mcpRun launches MCP server with given `cmdline` (and environment variables) and connects to it,
 // then starts, initializes, and returns the client.
 func mcpRun(
 	ctx context.Context,
 	cmdline string,
+	env map[string]string,
 ) (connection *mcp.ClientSession, err error) {
 	cmdline = expandPath(cmdline)
 
@@ -200,6 +243,14 @@ func mcpRun(
 		)
 	}
 
+	cmd := exec.Command(command, args...)
+	if len(env) > 0 {
+		cmd.Env = os.Environ()
+		for _, key := range slices.Sorted(maps.Keys(env)) {
+			cmd.Env = append(cmd.Env, key+"="+env[key])
+		}
+	}
+
 	if connection, err = mcp.NewClient(
 		&mcp.Implementation{
 			Name:    mcpClientName,
@@ -209,7 +260,7 @@ func mcpRun(
 	).Connect(
 		ctx,
 		&mcp.CommandTransport{
-			Command: exec.Command(command, args...),
+			Command: cmd,
 		},
 		&mcp.ClientSessionOptions{},
 	); err == nil {
@@ -287,6 +338,21 @@ func mcpHTTPClient() *http.Client {
 	return _mcpHTTPClient
 }
 
+// http transport which adds headers to all requests
+type headersTransport struct {
+	base    http.RoundTripper
+	headers map[string]string
+}
+
+// RoundTrip implements `http.RoundTripper`.
+func (t *headersTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+	return t.base.RoundTrip(req)
+}
+
 // stripServerInfo strips sensitive information from given server info.
 func stripServerInfo(serverType mcpServerType, info string) string {
 	switch serverType {
@@ -0,0 +1,41 @@
+// mcp_test.go
+
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// test `headersTransport` for adding headers to requests
+func TestHeadersTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Header.Get("Authorization") + "," + r.Header.Get("X-Original")))
+	}))
+	defer server.Close()
+
+	client := &http.Client{
+		Transport: &headersTransport{
+			base:    http.DefaultTransport,
+			headers: map[string]string{"Authorization": "Bearer token"},
+		},
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	req.Header.Set("X-Original", "kept")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("failed to request: %s", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, _ := io.ReadAll(resp.Body)
+	if got := string(body); got != "Bearer token,kept" {
+		t.Errorf("expected 'Bearer token,kept', got '%s'", got)
+	}
+	if req.Header.Get("Authorization") != "" {
+		t.Errorf("expected the original request not to be modified")
+	}
+}
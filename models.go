@@ -0,0 +1,577 @@
+// models.go
+//
+// things for managing models (pull, delete, copy, show, and list running ones)
+//
+// https://github.com/ollama/ollama/blob/main/docs/api.md
+
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/fatih/color"
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/progress"
+)
+
+// sort keys of listed models
+const (
+	sortModelsByName       = `name`
+	sortModelsBySize       = `size`
+	sortModelsByModified   = `modified`
+	sortModelsByParameters = `parameters`
+)
+
+// a locally installed model with its details and capabilities
+type listedModel struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	Digest     string    `json:"digest"`
+	ModifiedAt time.Time `json:"modified_at"`
+
+	Family            string `json:"family,omitempty"`
+	ParameterSize     string `json:"parameter_size,omitempty"`
+	QuantizationLevel string `json:"quantization_level,omitempty"`
+
+	Capabilities []string `json:"capabilities,omitempty"`
+}
+
+// listModels lists locally installed models with their capabilities.
+func listModels(
+	ctx context.Context,
+	client *api.Client,
+) (models []listedModel, err error) {
+	listed, err := client.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list models: %w", err)
+	}
+
+	for _, model := range listed.Models {
+		shown, err := client.Show(ctx, &api.ShowRequest{
+			Model: model.Name,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get model(%s) info: %w", model.Name, err)
+		}
+
+		capabilities := []string{}
+		for _, capability := range shown.Capabilities {
+			capabilities = append(capabilities, string(capability))
+		}
+
+		models = append(models, listedModel{
+			Name:              model.Name,
+			Size:              model.Size,
+			Digest:            model.Digest,
+			ModifiedAt:        model.ModifiedAt,
+			Family:            model.Details.Family,
+			ParameterSize:     model.Details.ParameterSize,
+			QuantizationLevel: model.Details.QuantizationLevel,
+			Capabilities:      capabilities,
+		})
+	}
+
+	return models, nil
+}
+
+// filterModelsByCapabilities returns models which have all of given capabilities.
+func filterModelsByCapabilities(
+	models []listedModel,
+	capabilities []string,
+) (filtered []listedModel) {
+	filtered = []listedModel{}
+	for _, model := range models {
+		matched := true
+		for _, capability := range capabilities {
+			if !slices.Contains(model.Capabilities, strings.ToLower(strings.TrimSpace(capability))) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			filtered = append(filtered, model)
+		}
+	}
+	return filtered
+}
+
+// sortModels sorts given models by `sortBy`.
+//
+// (names are sorted in ascending order, and others in descending order, unless reversed)
+func sortModels(
+	models []listedModel,
+	sortBy string,
+	reverse bool,
+) {
+	slices.SortStableFunc(models, func(a, b listedModel) int {
+		var compared int
+		switch sortBy {
+		case sortModelsBySize:
+			compared = cmp.Compare(b.Size, a.Size)
+		case sortModelsByModified:
+			compared = b.ModifiedAt.Compare(a.ModifiedAt)
+		case sortModelsByParameters:
+			compared = cmp.Compare(parseParameterSize(b.ParameterSize), parseParameterSize(a.ParameterSize))
+		}
+		if compared == 0 {
+			compared = strings.Compare(a.Name, b.Name)
+		}
+		if reverse {
+			compared = -compared
+		}
+		return compared
+	})
+}
+
+// parseParameterSize parses given parameter size (eg. '8.0B', '270M') to a number.
+//
+// Returns 0 if it cannot be parsed.
+func parseParameterSize(size string) float64 {
+	size = strings.ToUpper(strings.TrimSpace(size))
+	if len(size) <= 0 {
+		return 0
+	}
+
+	multiplier := 1.0
+	switch size[len(size)-1] {
+	case 'K':
+		multiplier = 1e3
+	case 'M':
+		multiplier = 1e6
+	case 'B':
+		multiplier = 1e9
+	case 'T':
+		multiplier = 1e12
+	}
+	if multiplier > 1 {
+		size = size[:len(size)-1]
+	}
+
+	value, err := strconv.ParseFloat(size, 64)
+	if err != nil {
+		return 0
+	}
+	return value * multiplier
+}
+
+// printModels prints given models in aligned columns.
+func printModels(
+	output *outputWriter,
+	models []listedModel,
+) {
+	rows := [][]string{
+		{"name", "size", "family", "params", "quant", "modified", "capabilities"},
+	}
+	for _, model := range models {
+		rows = append(rows, []string{
+			model.Name,
+			humanize.Bytes(uint64(model.Size)),
+			model.Family,
+			model.ParameterSize,
+			model.QuantizationLevel,
+			humanize.Time(model.ModifiedAt),
+			strings.Join(model.Capabilities, ","),
+		})
+	}
+
+	printAlignedRows(output, rows, []string{"", "-:", "", "-:"}) // (size and params are right-aligned)
+}
+
+// printAlignedRows prints given rows in aligned columns (the first row is the header).
+func printAlignedRows(
+	output *outputWriter,
+	rows [][]string,
+	aligns []string,
+) {
+	for i, line := range alignRows(rows, aligns) {
+		c := color.FgHiWhite
+		if i == 0 {
+			c = color.FgWhite
+		}
+		output.printColored(
+			c,
+			"%s\n",
+			line,
+		)
+	}
+}
+
+// alignRows aligns cells of given rows in columns, and returns them as lines.
+//
+// `aligns` are alignments of columns like those of markdown tables (eg. '-:' for right-aligned, missing ones are left-aligned).
+func alignRows(rows [][]string, aligns []string) (lines []string) {
+	widths := []int{}
+	for _, row := range rows {
+		for i, cell := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = max(widths[i], displayWidth(cell))
+		}
+	}
+	for _, row := range rows {
+		cells := []string{}
+		for i, cell := range row {
+			align := ""
+			if i < len(aligns) {
+				align = aligns[i]
+			}
+			cells = append(cells, padCell(cell, widths[i], align))
+		}
+		lines = append(lines, strings.TrimRight(strings.Join(cells, "  "), " "))
+	}
+	return lines
+}
+
+// doPullModel pulls a model from the registry, with progress bars.
+//
+// https://github.com/ollama/ollama/blob/main/docs/api.md#pull-a-model
+func doPullModel(
+	ctx context.Context,
+	output *outputWriter,
+	p params,
+) (exit int, e error) {
+	model := *p.Models.Pull
+
+	output.verbose(
+		verboseMedium,
+		p.Verbose,
+		"pulling model '%s'...",
+		model,
+	)
+
+	// ollama api client
+	client, err := newOllamaClient()
+	if err != nil {
+		return 1, fmt.Errorf("failed to initialize Ollama API client: %w", err)
+	}
+
+	// NOTE: no timeout for pulling, as it may take long
+	pg := progress.NewProgress(os.Stderr)
+	bars := map[string]*progress.Bar{}
+	var status string
+	var spinner *progress.Spinner
+
+	err = client.Pull(
+		ctx,
+		&api.PullRequest{
+			Model: model,
+		},
+		func(resp api.ProgressResponse) error {
+			if len(resp.Digest) > 0 {
+				if resp.Completed <= 0 {
+					return nil
+				}
+				if spinner != nil {
+					spinner.Stop()
+				}
+
+				// progress bar for each layer
+				bar, exists := bars[resp.Digest]
+				if !exists {
+					name, isDigest := strings.CutPrefix(resp.Digest, "sha256:")
+					name = strings.TrimSpace(name)
+					if isDigest {
+						name = name[:min(12, len(name))]
+					}
+					bar = progress.NewBar(fmt.Sprintf("pulling %s:", name), resp.Total, resp.Completed)
+					bars[resp.Digest] = bar
+					pg.Add(resp.Digest, bar)
+				}
+				bar.Set(resp.Completed)
+			} else if status != resp.Status {
+				if spinner != nil {
+					spinner.Stop()
+				}
+
+				// spinner for other statuses
+				status = resp.Status
+				spinner = progress.NewSpinner(status)
+				pg.Add(status, spinner)
+			}
+			return nil
+		},
+	)
+
+	pg.Stop()
+	if err != nil {
+		return 1, fmt.Errorf("failed to pull model '%s': %w", model, err)
+	}
+
+	output.printColored(
+		color.FgGreen,
+		"Pulled model '%s'.\n",
+		model,
+	)
+
+	return 0, nil
+}
+
+// doDeleteModel deletes a locally installed model.
+//
+// https://github.com/ollama/ollama/blob/main/docs/api.md#delete-a-model
+func doDeleteModel(
+	ctx context.Context,
+	output *outputWriter,
+	conf config,
+	p params,
+) (exit int, e error) {
+	model := *p.Models.Delete
+
+	output.verbose(
+		verboseMedium,
+		p.Verbose,
+		"deleting model '%s'...",
+		model,
+	)
+
+	ctx, cancel := context.WithTimeout(
+		ctx,
+		time.Duration(conf.TimeoutSeconds)*time.Second,
+	)
+	defer cancel()
+
+	// ollama api client
+	client, err := newOllamaClient()
+	if err != nil {
+		return 1, fmt.Errorf("failed to initialize Ollama API client: %w", err)
+	}
+
+	if err := client.Delete(ctx, &api.DeleteRequest{
+		Model: model,
+	}); err != nil {
+		return 1, fmt.Errorf("failed to delete model '%s': %w", model, err)
+	}
+
+	output.printColored(
+		color.FgGreen,
+		"Deleted model '%s'.\n",
+		model,
+	)
+
+	return 0, nil
+}
+
+// doCopyModel copies a locally installed model to another name.
+//
+// https://github.com/ollama/ollama/blob/main/docs/api.md#copy-a-model
+func doCopyModel(
+	ctx context.Context,
+	output *outputWriter,
+	conf config,
+	p params,
+) (exit int, e error) {
+	if p.Models.CopyTo == nil {
+		return 1, fmt.Errorf("destination of copy is not given (use --copy-model-to)")
+	}
+	source, destination := *p.Models.Copy, *p.Models.CopyTo
+
+	output.verbose(
+		verboseMedium,
+		p.Verbose,
+		"copying model '%s' to '%s'...",
+		source,
+		destination,
+	)
+
+	ctx, cancel := context.WithTimeout(
+		ctx,
+		time.Duration(conf.TimeoutSeconds)*time.Second,
+	)
+	defer cancel()
+
+	// ollama api client
+	client, err := newOllamaClient()
+	if err != nil {
+		return 1, fmt.Errorf("failed to initialize Ollama API client: %w", err)
+	}
+
+	if err := client.Copy(ctx, &api.CopyRequest{
+		Source:      source,
+		Destination: destination,
+	}); err != nil {
+		return 1, fmt.Errorf("failed to copy model '%s' to '%s': %w", source, destination, err)
+	}
+
+	output.printColored(
+		color.FgGreen,
+		"Copied model '%s' to '%s'.\n",
+		source,
+		destination,
+	)
+
+	return 0, nil
+}
+
+// doShowModel shows the information of a model
+// (details, capabilities, parameters, template, system, license, and modelfile).
+//
+// https://github.com/ollama/ollama/blob/main/docs/api.md#show-model-information
+func doShowModel(
+	ctx context.Context,
+	output *outputWriter,
+	conf config,
+	p params,
+) (exit int, e error) {
+	model := *p.Models.Show
+
+	ctx, cancel := context.WithTimeout(
+		ctx,
+		time.Duration(conf.TimeoutSeconds)*time.Second,
+	)
+	defer cancel()
+
+	// ollama api client
+	client, err := newOllamaClient()
+	if err != nil {
+		return 1, fmt.Errorf("failed to initialize Ollama API client: %w", err)
+	}
+
+	shown, err := client.Show(ctx, &api.ShowRequest{
+		Model: model,
+	})
+	if err != nil {
+		return 1, fmt.Errorf("failed to get model(%s) info: %w", model, err)
+	}
+
+	output.printColored(color.FgHiCyan, "Model: %s\n", model)
+
+	// details
+	output.printColored(color.FgHiWhite, "\nDetails:\n")
+	details := [][2]string{
+		{"family", shown.Details.Family},
+		{"parameter size", shown.Details.ParameterSize},
+		{"quantization", shown.Details.QuantizationLevel},
+		{"format", shown.Details.Format},
+	}
+	if contextLength := modelContextLength(shown); contextLength > 0 {
+		details = append(details, [2]string{"context length", fmt.Sprintf("%d", contextLength)})
+	}
+	if !shown.ModifiedAt.IsZero() {
+		details = append(details, [2]string{"modified", humanize.Time(shown.ModifiedAt)})
+	}
+	for _, detail := range details {
+		if len(detail[1]) > 0 {
+			output.printColored(color.FgWhite, "  %-16s%s\n", detail[0], detail[1])
+		}
+	}
+
+	// capabilities
+	if len(shown.Capabilities) > 0 {
+		output.printColored(color.FgHiWhite, "\nCapabilities:\n")
+		for _, capability := range shown.Capabilities {
+			output.printColored(color.FgWhite, "  %s\n", capability)
+		}
+	}
+
+	// parameters, template, system, license, and modelfile
+	sections := [][2]string{
+		{"Parameters", shown.Parameters},
+		{"Template", shown.Template},
+		{"System", shown.System},
+		{"License", shown.License},
+		{"Modelfile", shown.Modelfile},
+	}
+	for _, section := range sections {
+		if text := strings.TrimSpace(section[1]); len(text) > 0 {
+			output.printColored(color.FgHiWhite, "\n%s:\n", section[0])
+			output.printColored(color.FgWhite, "%s\n", indent(text, "  "))
+		}
+	}
+
+	return 0, nil
+}
+
+// doListRunningModels lists models which are currently loaded in memory.
+//
+// https://github.com/ollama/ollama/blob/main/docs/api.md#list-running-models
+func doListRunningModels(
+	ctx context.Context,
+	output *outputWriter,
+	conf config,
+	p params,
+) (exit int, e error) {
+	ctx, cancel := context.WithTimeout(
+		ctx,
+		time.Duration(conf.TimeoutSeconds)*time.Second,
+	)
+	defer cancel()
+
+	// ollama api client
+	client, err := newOllamaClient()
+	if err != nil {
+		return 1, fmt.Errorf("failed to initialize Ollama API client: %w", err)
+	}
+
+	running, err := client.ListRunning(ctx)
+	if err != nil {
+		return 1, fmt.Errorf("failed to list running models: %w", err)
+	}
+
+	if len(running.Models) <= 0 {
+		output.printColored(
+			color.FgHiRed,
+			"no models are running.\n",
+		)
+		return 0, nil
+	}
+
+	rows := [][]string{
+		{"name", "size", "vram", "context", "until"},
+	}
+	for _, model := range running.Models {
+		rows = append(rows, []string{
+			model.Name,
+			humanize.Bytes(uint64(model.Size)),
+			vramUsage(model.Size, model.SizeVRAM),
+			strconv.Itoa(model.ContextLength),
+			expiryToString(model.ExpiresAt),
+		})
+	}
+	printAlignedRows(output, rows, []string{"", "-:", "-:", "-:"}) // (size, vram, and context are right-aligned)
+
+	return 0, nil
+}
+
+// vramUsage returns the usage of VRAM in string (eg. '4.2 GB (100% GPU)').
+func vramUsage(size, sizeVRAM int64) string {
+	if size <= 0 {
+		return "-"
+	}
+	switch {
+	case sizeVRAM <= 0:
+		return "100% CPU"
+	case sizeVRAM >= size:
+		return fmt.Sprintf("%s (100%% GPU)", humanize.Bytes(uint64(sizeVRAM)))
+	default:
+		return fmt.Sprintf("%s (%d%% GPU)", humanize.Bytes(uint64(sizeVRAM)), sizeVRAM*100/size)
+	}
+}
+
+// expiryToString converts given time of expiry to a string.
+func expiryToString(expiresAt time.Time) string {
+	if expiresAt.IsZero() {
+		return "-"
+	}
+	if expiresAt.Year() > time.Now().Year()+100 { // NOTE: kept loaded forever (keep-alive < 0)
+		return "forever"
+	}
+	return humanize.Time(expiresAt)
+}
+
+// indent indents each line of given text.
+func indent(text, prefix string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = prefix + line
+	}
+	return strings.Join(lines, "\n")
+}
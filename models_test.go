@@ -0,0 +1,96 @@
+// models_test.go
+
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// test `vramUsage` with various sizes
+func TestVRAMUsage(t *testing.T) {
+	type test struct {
+		size, sizeVRAM int64
+		expected       string
+	}
+
+	tests := []test{
+		{size: 0, sizeVRAM: 0, expected: "-"},
+		{size: 4_000_000_000, sizeVRAM: 0, expected: "100% CPU"},
+		{size: 4_000_000_000, sizeVRAM: 4_000_000_000, expected: "4.0 GB (100% GPU)"},
+		{size: 4_000_000_000, sizeVRAM: 3_000_000_000, expected: "3.0 GB (75% GPU)"},
+	}
+
+	for _, test := range tests {
+		if usage := vramUsage(test.size, test.sizeVRAM); usage != test.expected {
+			t.Errorf("expected '%s', got '%s'", test.expected, usage)
+		}
+	}
+}
+
+// test `expiryToString` for models kept loaded forever
+func TestExpiryToString(t *testing.T) {
+	if expiry := expiryToString(time.Time{}); expiry != "-" {
+		t.Errorf("expected '-', got '%s'", expiry)
+	}
+	if expiry := expiryToString(time.Now().AddDate(300, 0, 0)); expiry != "forever" {
+		t.Errorf("expected 'forever', got '%s'", expiry)
+	}
+}
+
+// test `filterModelsByCapabilities` and `sortModels`
+func TestFilterAndSortModels(t *testing.T) {
+	now := time.Now()
+	models := []listedModel{
+		{Name: "gemma3:4b", Size: 3_300_000_000, ParameterSize: "4.3B", ModifiedAt: now.Add(-time.Hour), Capabilities: []string{"completion", "vision"}},
+		{Name: "qwen3.5:9b", Size: 6_600_000_000, ParameterSize: "9.7B", ModifiedAt: now.Add(-2 * time.Hour), Capabilities: []string{"completion", "tools", "thinking"}},
+		{Name: "embeddinggemma:latest", Size: 620_000_000, ParameterSize: "307.58M", ModifiedAt: now, Capabilities: []string{"embedding"}},
+		{Name: "gpt-oss:20b", Size: 13_000_000_000, ParameterSize: "20.9B", ModifiedAt: now.Add(-3 * time.Hour), Capabilities: []string{"completion", "tools", "thinking"}},
+	}
+
+	names := func(models []listedModel) (names []string) {
+		for _, model := range models {
+			names = append(names, model.Name)
+		}
+		return names
+	}
+
+	filtered := filterModelsByCapabilities(models, []string{"tools", "Thinking"})
+	if got := names(filtered); !slices.Equal(got, []string{"qwen3.5:9b", "gpt-oss:20b"}) {
+		t.Errorf("unexpected filtered models: %v", got)
+	}
+
+	sortModels(models, sortModelsByParameters, false)
+	if got := names(models); !slices.Equal(got, []string{"gpt-oss:20b", "qwen3.5:9b", "gemma3:4b", "embeddinggemma:latest"}) {
+		t.Errorf("unexpected models sorted by parameters: %v", got)
+	}
+
+	sortModels(models, sortModelsByModified, false)
+	if got := names(models); !slices.Equal(got, []string{"embeddinggemma:latest", "gemma3:4b", "qwen3.5:9b", "gpt-oss:20b"}) {
+		t.Errorf("unexpected models sorted by modified: %v", got)
+	}
+
+	sortModels(models, sortModelsByName, true)
+	if got := names(models); !slices.Equal(got, []string{"qwen3.5:9b", "gpt-oss:20b", "gemma3:4b", "embeddinggemma:latest"}) {
+		t.Errorf("unexpected models sorted by name (reversed): %v", got)
+	}
+}
+
+// test `alignRows` for aligning cells (with wide characters) in columns
+func TestAlignRows(t *testing.T) {
+	lines := alignRows([][]string{
+		{"name", "size", "until"},
+		{"gemma3:4b", "3.3 GB", "4 minutes from now"},
+		{"모델:latest", "620 MB", "forever"},
+	}, []string{"", "-:"})
+
+	expected := []string{
+		"name           size  until",
+		"gemma3:4b    3.3 GB  4 minutes from now",
+		"모델:latest  620 MB  forever",
+	}
+	if !slices.Equal(lines, expected) {
+		t.Errorf("expected %q, got %q", expected, lines)
+	}
+}
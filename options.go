@@ -0,0 +1,237 @@
+// options.go
+//
+// things for Ollama's generation options
+//
+// https://github.com/ollama/ollama/blob/main/docs/modelfile.md#valid-parameters-and-values
+
+package main
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+)
+
+// ollamaOptionTypes returns the types of Ollama's options, keyed by their JSON names.
+//
+// (reflected from `api.Options`, including embedded structs like `api.Runner`)
+func ollamaOptionTypes() map[string]reflect.Type {
+	types := map[string]reflect.Type{}
+
+	var collect func(t reflect.Type)
+	collect = func(t reflect.Type) {
+		for i := range t.NumField() {
+			field := t.Field(i)
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				collect(field.Type)
+				continue
+			}
+			if !field.IsExported() {
+				continue
+			}
+
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if len(name) <= 0 || name == "-" {
+				continue
+			}
+			types[name] = field.Type
+		}
+	}
+	collect(reflect.TypeOf(api.Options{}))
+
+	return types
+}
+
+// convertOptionValue converts given value (a string from command line, or a value from JSON)
+// to the type of Ollama's option with given key.
+func convertOptionValue(
+	key string,
+	value any,
+) (converted any, err error) {
+	types := ollamaOptionTypes()
+
+	t, exists := types[key]
+	if !exists {
+		return nil, fmt.Errorf(
+			"unknown option: '%s' (available: %s)",
+			key,
+			strings.Join(slices.Sorted(maps.Keys(types)), ", "),
+		)
+	}
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		switch v := value.(type) {
+		case string:
+			if converted, err = strconv.Atoi(strings.TrimSpace(v)); err == nil {
+				return converted, nil
+			}
+		case float64:
+			if v == math.Trunc(v) {
+				return int(v), nil
+			}
+		case int:
+			return v, nil
+		}
+		return nil, fmt.Errorf("invalid value for option '%s' (should be an integer): %v", key, value)
+	case reflect.Float32, reflect.Float64:
+		switch v := value.(type) {
+		case string:
+			if converted, err = strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				return converted, nil
+			}
+		case float64:
+			return v, nil
+		case float32:
+			return float64(v), nil
+		case int:
+			return float64(v), nil
+		}
+		return nil, fmt.Errorf("invalid value for option '%s' (should be a number): %v", key, value)
+	case reflect.Bool:
+		switch v := value.(type) {
+		case string:
+			if converted, err = strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+				return converted, nil
+			}
+		case bool:
+			return v, nil
+		}
+		return nil, fmt.Errorf("invalid value for option '%s' (should be a boolean): %v", key, value)
+	case reflect.String:
+		if v, ok := value.(string); ok {
+			return v, nil
+		}
+		return nil, fmt.Errorf("invalid value for option '%s' (should be a string): %v", key, value)
+	case reflect.Slice:
+		switch v := value.(type) {
+		case string:
+			return []string{v}, nil
+		case []string:
+			return v, nil
+		case []any:
+			strs := []string{}
+			for _, e := range v {
+				if s, ok := e.(string); ok {
+					strs = append(strs, s)
+				} else {
+					return nil, fmt.Errorf("invalid value for option '%s' (should be an array of strings): %v", key, value)
+				}
+			}
+			return strs, nil
+		}
+		return nil, fmt.Errorf("invalid value for option '%s' (should be an array of strings): %v", key, value)
+	}
+
+	return nil, fmt.Errorf("unsupported type of option '%s': %s", key, t)
+}
+
+// convertOptions converts values of given options to the types of Ollama's options.
+func convertOptions(options map[string]any) (converted map[string]any, err error) {
+	converted = map[string]any{}
+	for key, value := range options {
+		if converted[key], err = convertOptionValue(key, value); err != nil {
+			return nil, err
+		}
+	}
+	return converted, nil
+}
+
+// parseOptions parses given options in `key=value` format.
+//
+// (values of array type, eg. 'stop', will be accumulated)
+func parseOptions(kvs []string) (options map[string]any, err error) {
+	options = map[string]any{}
+	for _, kv := range kvs {
+		key, value, exists := strings.Cut(kv, "=")
+		key = strings.TrimSpace(key)
+		if !exists || len(key) <= 0 {
+			return nil, fmt.Errorf("invalid option: '%s' (should be in 'key=value' format)", kv)
+		}
+
+		converted, err := convertOptionValue(key, value)
+		if err != nil {
+			return nil, err
+		}
+		if strs, isArray := converted.([]string); isArray {
+			if prev, exists := options[key].([]string); exists {
+				converted = append(prev, strs...)
+			}
+		}
+		options[key] = converted
+	}
+	return options, nil
+}
+
+// generationOptionsFor returns options for generation with given model.
+//
+// Options are merged in the order of precedence (later ones take precedence):
+// the options of the model in config, sampling parameters of the profile,
+// options given in `key=value` format (`--option`), and sampling parameters from flags (`--temperature`, `--top-p`, and `--top-k`).
+func generationOptionsFor(
+	conf config,
+	p params,
+	model string,
+) (options map[string]any, err error) {
+	options = map[string]any{}
+
+	// options of the model in config
+	if modelOptions, exists := conf.ModelOptions[model]; exists {
+		var converted map[string]any
+		if converted, err = convertOptions(modelOptions); err != nil {
+			return nil, fmt.Errorf("invalid options of model '%s' in config: %w", model, err)
+		}
+		maps.Copy(options, converted)
+	}
+
+	// sampling parameters of the profile
+	if p.Profile != nil {
+		if prof, exists := conf.Profiles[*p.Profile]; exists {
+			setSamplingOptions(options, prof.Temperature, prof.TopP, prof.TopK)
+		}
+	}
+
+	// given options
+	var parsed map[string]any
+	if parsed, err = parseOptions(p.Generation.DetailedOptions.Options); err != nil {
+		return nil, err
+	}
+	maps.Copy(options, parsed)
+
+	// sampling parameters from flags
+	setSamplingOptions(
+		options,
+		p.Generation.DetailedOptions.Temperature,
+		p.Generation.DetailedOptions.TopP,
+		p.Generation.DetailedOptions.TopK,
+	)
+
+	return options, nil
+}
+
+// setSamplingOptions sets given sampling parameters (if not nil) to options.
+func setSamplingOptions(
+	options map[string]any,
+	temperature, topP *float32,
+	topK *int32,
+) {
+	if temperature != nil {
+		options["temperature"] = *temperature
+	}
+	if topP != nil {
+		options["top_p"] = *topP
+	}
+	if topK != nil {
+		options["top_k"] = *topK
+	}
+}
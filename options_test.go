@@ -0,0 +1,135 @@
+// options_test.go
+
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// test `parseOptions` for converting values to the types of Ollama's options
+func TestParseOptions(t *testing.T) {
+	options, err := parseOptions([]string{
+		"seed=42",
+		"temperature=0.5",
+		"num_predict=256",
+		"stop=<|end|>",
+		"stop=\n\n",
+	})
+	if err != nil {
+		t.Fatalf("failed to parse options: %s", err)
+	}
+
+	if seed, ok := options["seed"].(int); !ok || seed != 42 {
+		t.Errorf("expected seed to be int 42, got %#v", options["seed"])
+	}
+	if temperature, ok := options["temperature"].(float64); !ok || temperature != 0.5 {
+		t.Errorf("expected temperature to be float64 0.5, got %#v", options["temperature"])
+	}
+	if numPredict, ok := options["num_predict"].(int); !ok || numPredict != 256 {
+		t.Errorf("expected num_predict to be int 256, got %#v", options["num_predict"])
+	}
+	if stop, ok := options["stop"].([]string); !ok || !slices.Equal(stop, []string{"<|end|>", "\n\n"}) {
+		t.Errorf("expected stop to be accumulated, got %#v", options["stop"])
+	}
+
+	// should fail with unknown keys, invalid values, or invalid formats
+	for _, invalid := range []string{
+		"no_such_option=1",
+		"seed=forty-two",
+		"seed",
+	} {
+		if _, err := parseOptions([]string{invalid}); err == nil {
+			t.Errorf("expected error for '%s'", invalid)
+		}
+	}
+}
+
+// test `convertOptions` for converting values from JSON
+func TestConvertOptions(t *testing.T) {
+	converted, err := convertOptions(map[string]any{
+		"seed":        float64(7),
+		"top_p":       float64(0.9),
+		"stop":        []any{"a", "b"},
+		"num_predict": "128",
+	})
+	if err != nil {
+		t.Fatalf("failed to convert options: %s", err)
+	}
+
+	if seed, ok := converted["seed"].(int); !ok || seed != 7 {
+		t.Errorf("expected seed to be int 7, got %#v", converted["seed"])
+	}
+	if stop, ok := converted["stop"].([]string); !ok || !slices.Equal(stop, []string{"a", "b"}) {
+		t.Errorf("expected stop to be []string, got %#v", converted["stop"])
+	}
+	if numPredict, ok := converted["num_predict"].(int); !ok || numPredict != 128 {
+		t.Errorf("expected num_predict to be int 128, got %#v", converted["num_predict"])
+	}
+
+	if _, err := convertOptions(map[string]any{"seed": 1.5}); err == nil {
+		t.Errorf("expected error for non-integer seed")
+	}
+}
+
+// test `generationOptionsFor` for the precedence of flags, options, profile, and config
+func TestGenerationOptionsFor(t *testing.T) {
+	conf := config{
+		ModelOptions: map[string]map[string]any{
+			"model-a": {
+				"temperature": float64(0.1),
+				"top_p":       float64(0.5),
+				"top_k":       float64(10),
+				"seed":        float64(1),
+			},
+		},
+		Profiles: map[string]profile{
+			"work": {
+				Temperature: ptr(float32(0.2)),
+				TopK:        ptr(int32(40)),
+			},
+		},
+	}
+
+	// options of the model in config
+	options, err := generationOptionsFor(conf, params{}, "model-a")
+	if err != nil {
+		t.Fatalf("failed to get options: %s", err)
+	}
+	if options["temperature"] != float64(0.1) || options["seed"] != 1 {
+		t.Errorf("expected options of the model in config, got %#v", options)
+	}
+
+	// profile over config
+	var p params
+	p.Profile = ptr("work")
+	if options, err = generationOptionsFor(conf, p, "model-a"); err != nil {
+		t.Fatalf("failed to get options: %s", err)
+	}
+	if options["temperature"] != float32(0.2) || options["top_k"] != int32(40) || options["top_p"] != float64(0.5) {
+		t.Errorf("expected the profile to take precedence over config, got %#v", options)
+	}
+
+	// given options over profile
+	p.Generation.DetailedOptions.Options = []string{"temperature=0.9", "top_k=50", "seed=2"}
+	if options, err = generationOptionsFor(conf, p, "model-a"); err != nil {
+		t.Fatalf("failed to get options: %s", err)
+	}
+	if options["temperature"] != float64(0.9) || options["top_k"] != 50 || options["seed"] != 2 {
+		t.Errorf("expected given options to take precedence over the profile, got %#v", options)
+	}
+
+	// flags over given options
+	p.Generation.DetailedOptions.TopK = ptr(int32(60))
+	if options, err = generationOptionsFor(conf, p, "model-a"); err != nil {
+		t.Fatalf("failed to get options: %s", err)
+	}
+	if options["top_k"] != int32(60) || options["temperature"] != float64(0.9) {
+		t.Errorf("expected flags to take precedence over given options, got %#v", options)
+	}
+
+	// other models
+	if options, err = generationOptionsFor(conf, params{}, "model-b"); err != nil || len(options) != 0 {
+		t.Errorf("expected no options for other models, got %#v (err: %v)", options, err)
+	}
+}
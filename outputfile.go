@@ -0,0 +1,92 @@
+// outputfile.go
+//
+// things for writing generated outputs to files
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+)
+
+// generatedMessages returns the messages generated after the last user message of given conversation.
+func generatedMessages(conversation []api.Message) []api.Message {
+	for i := len(conversation) - 1; i >= 0; i-- {
+		if conversation[i].Role == "user" {
+			return conversation[i+1:]
+		}
+	}
+	return nil
+}
+
+// finalContentOf returns the content of the last assistant message in given messages.
+func finalContentOf(messages []api.Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "assistant" && len(messages[i].Content) > 0 {
+			return messages[i].Content
+		}
+	}
+	return ""
+}
+
+// thinkingOf returns all thinking texts of assistant messages in given messages.
+func thinkingOf(messages []api.Message) string {
+	thinkings := []string{}
+	for _, message := range messages {
+		if message.Role == "assistant" && len(message.Thinking) > 0 {
+			thinkings = append(thinkings, strings.TrimSpace(message.Thinking))
+		}
+	}
+	return strings.Join(thinkings, "\n\n")
+}
+
+// writeOutputFiles writes the final content (and thinking) of given conversation to files.
+func writeOutputFiles(
+	output *outputWriter,
+	conversation []api.Message,
+	outputFilepath, thinkingFilepath *string,
+	vbs []bool,
+) error {
+	generated := generatedMessages(conversation)
+
+	if outputFilepath != nil {
+		fpath := expandPath(*outputFilepath)
+		if err := writeTextFile(fpath, finalContentOf(generated)); err != nil {
+			return fmt.Errorf("failed to write output to '%s': %w", fpath, err)
+		}
+
+		output.verbose(
+			verboseMedium,
+			vbs,
+			"wrote output to '%s'",
+			fpath,
+		)
+	}
+
+	if thinkingFilepath != nil {
+		fpath := expandPath(*thinkingFilepath)
+		if err := writeTextFile(fpath, thinkingOf(generated)); err != nil {
+			return fmt.Errorf("failed to write thinking to '%s': %w", fpath, err)
+		}
+
+		output.verbose(
+			verboseMedium,
+			vbs,
+			"wrote thinking to '%s'",
+			fpath,
+		)
+	}
+
+	return nil
+}
+
+// writeTextFile writes given text to a file (with a trailing newline).
+func writeTextFile(fpath, text string) error {
+	if len(text) > 0 && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	return os.WriteFile(fpath, []byte(text), 0o644)
+}
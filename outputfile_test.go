@@ -0,0 +1,33 @@
+// outputfile_test.go
+
+package main
+
+import (
+	"testing"
+
+	"github.com/ollama/ollama/api"
+)
+
+// test `finalContentOf` and `thinkingOf` for picking generated things
+func TestFinalContentAndThinking(t *testing.T) {
+	conversation := []api.Message{
+		{Role: "system", Content: "system instruction"},
+		{Role: "user", Content: "previous question"},
+		{Role: "assistant", Content: "previous answer", Thinking: "previous thinking"},
+		{Role: "user", Content: "question"},
+		{Role: "assistant", Content: "let me check", Thinking: "first thinking"},
+		{Role: "tool", Content: "tool result"},
+		{Role: "assistant", Content: "final answer", Thinking: "second thinking"},
+	}
+
+	generated := generatedMessages(conversation)
+	if len(generated) != 3 {
+		t.Fatalf("expected 3 generated messages, got %d", len(generated))
+	}
+	if content := finalContentOf(generated); content != "final answer" {
+		t.Errorf("expected 'final answer', got '%s'", content)
+	}
+	if thinking := thinkingOf(generated); thinking != "first thinking\n\nsecond thinking" {
+		t.Errorf("expected thinking of generated messages only, got '%s'", thinking)
+	}
+}
@@ -12,6 +12,9 @@ type params struct {
 	// config file's path
 	ConfigFilepath *string `short:"c" long:"config" description:"Config file's path (default: $XDG_CONFIG_HOME/oll/config.json)"`
 
+	// profile in config
+	Profile *string `long:"profile" description:"Name of profile in config (its values will be used for parameters which are not given)"`
+
 	// for ollama model
 	Model *string `short:"m" long:"model" description:"Model to use (can be omitted)"`
 
@@ -23,12 +26,30 @@ type params struct {
 		Prompt    *string   `short:"p" long:"prompt" description:"Prompt for generation (can also be read from stdin)"`
 		Filepaths []*string `short:"f" long:"filepath" description:"Path of a file or directory (can be used multiple times)"`
 
+		// files in directories
+		Files struct {
+			Include     []string `long:"include" description:"Attach only files in directories which match this glob (in .gitignore format, can be used multiple times, eg. '*.go', 'src/**/*.ts')"`
+			Exclude     []string `long:"exclude" description:"Do not attach files or directories in directories which match this glob (in .gitignore format, can be used multiple times, eg. '*_test.go', 'vendor/')"`
+			DryRunFiles bool     `long:"dry-run-files" description:"Print files (and their total size) which would be attached, without generation"`
+
+			// limits of attached text files
+			MaxFileSize      *string `long:"max-file-size" description:"Max size of each attached text file (eg. '512KB', '1MiB'; default: unlimited)"`
+			MaxTotalFileSize *string `long:"max-total-file-size" description:"Max total size of attached text files (eg. '4MB'; default: unlimited)"`
+			FileLimitPolicy  *string `long:"file-limit-policy" description:"What to do with files which exceed the limits, or look binary/minified (default: skip)" choice:"skip" choice:"truncate" choice:"fail"`
+
+			// PDF documents
+			RenderPDFPages bool `long:"render-pdf-pages" description:"Also attach pages of PDF documents as PNG images (for vision models, needs 'pdftoppm' from poppler)"`
+		} `group:"File Options"`
+
 		DetailedOptions struct {
 			SystemInstruction *string   `short:"s" long:"system" description:"System instruction (can be omitted)"`
 			Temperature       *float32  `long:"temperature" description:"'temperature' for generation (default: 1.0)"`
 			TopP              *float32  `long:"top-p" description:"'top_p' for generation (default: 0.95)"`
 			TopK              *int32    `long:"top-k" description:"'top_k' for generation (default: 20)"`
 			Stop              []*string `long:"stop" description:"'stop' sequence string for generation (can be used multiple times)"`
+			Options           []string  `long:"option" description:"Ollama option for generation in 'key=value' format (can be used multiple times, eg. 'seed=42', 'num_predict=256')"`
+
+			SystemInstructionIsDefault bool `no-flag:"true"` // true if `SystemInstruction` was generated with `defaultSystemInstruction`
 		} `group:"Detailed Generation Options"`
 
 		// thinking
@@ -58,6 +79,15 @@ type params struct {
 		RecurseOnCallbackResults bool `short:"r" long:"recurse-on-callback-results" description:"Whether to do recursive generations on callback results (default: false)"`
 
 		ForceCallDestructiveTools bool `long:"force-call-destructive-tools" description:"Whether to force calling destructive tools without asking"`
+
+		// limits of recursive generations on tool calls (agent loop)
+		MaxToolRounds           *int `long:"max-tool-rounds" description:"Maximum number of recursive generations on tool results (default: 10, 0 for unlimited)"`
+		MaxToolCalls            *int `long:"max-tool-calls" description:"Maximum number of total tool calls (default: unlimited)"`
+		MaxCallsPerTool         *int `long:"max-calls-per-tool" description:"Maximum number of calls for each tool (default: unlimited)"`
+		ToolRoundTimeoutSeconds *int `long:"tool-round-timeout" description:"Timeout in seconds for each round of generation and tool calls (default: unlimited)"`
+
+		// parallel execution of tool calls
+		ToolCallWorkers *int `long:"tool-call-workers" description:"Number of workers for executing multiple tool calls in parallel (default: 1, sequential)"`
 	} `group:"Tools"`
 
 	// tools (local)
@@ -65,6 +95,8 @@ type params struct {
 		Tools                *string           `short:"t" long:"tools" description:"Tools for function call (in JSON)"`
 		ToolCallbacks        map[string]string `long:"tool-callbacks" description:"Tool callbacks (can be used multiple times, eg. 'fn_name1:/path/to/script1.sh', 'fn_name2:/path/to/script2.sh')"`
 		ToolCallbacksConfirm map[string]bool   `long:"tool-callbacks-confirm" description:"Confirm before executing tool callbacks (can be used multiple times, eg. 'fn_name1:true', 'fn_name2:false')"`
+
+		ConfiguredTools []string `long:"local-tool" description:"Name of local tool (with its callback) declared in config (can be used multiple times)"`
 	} `group:"Tools (Local)"`
 
 	// tools (MCP)
@@ -72,14 +104,74 @@ type params struct {
 		StreamableURLs []string `long:"mcp-streamable-url" description:"Streamable URL of MCP server for function call (can be used multiple times)"`
 		StdioCommands  []string `long:"mcp-stdio-command" description:"Commands of local stdio MCP Tools (can be used multiple times)"`
 
+		ConfiguredServers []string `long:"mcp" description:"Name of MCP server declared in config (can be used multiple times)"`
+
+		// (from MCP servers declared in config)
+		Headers map[string]map[string]string `no-flag:"true"` // key: streamable URL
+		Envs    map[string]map[string]string `no-flag:"true"` // key: stdio command
+
 		WithSelfAsStdioCommand     bool `short:"S" long:"mcp-tool-self" description:"Will add itself as an internal MCP tool"`
 		RunAsStandaloneStdioServer bool `short:"M" long:"mcp-server-self" description:"Run as a standalone STDIO MCP server"`
 	} `group:"Tools (MCP)"`
 
+	// interactive chat
+	Chat bool `long:"chat" description:"Start an interactive chat which keeps the history of conversation (prompt, if given, will be the first message)"`
+
+	// sessions (history of conversation saved on disk)
+	Sessions struct {
+		Session       *string `long:"session" description:"Name of session for saving/resuming the history of conversation (saved in $XDG_STATE_HOME/oll/sessions/)"`
+		ListSessions  bool    `long:"list-sessions" description:"List saved sessions"`
+		ShowSession   *string `long:"show-session" description:"Show messages of the saved session with this name"`
+		ForkSession   *string `long:"fork-session" description:"Fork the session given with --session to a new session with this name"`
+		DeleteSession *string `long:"delete-session" description:"Delete the saved session with this name"`
+	} `group:"Sessions"`
+
+	// comparison of models
+	Compare struct {
+		Models       *string `long:"compare" description:"Generate with the prompt using these comma-separated models, and compare their results (eg. 'gemma3:4b,qwen3.5:9b')"`
+		Concurrently bool    `long:"compare-concurrently" description:"Generate with the models concurrently (default: sequentially)"`
+		Report       *string `long:"compare-report" description:"Format of comparison report (default: text)" choice:"text" choice:"markdown" choice:"json"`
+	} `group:"Comparison"`
+
+	// batch processing of prompts
+	Batch struct {
+		Filepath        *string `long:"batch" description:"Run prompts in this JSONL file (each line: {\"id\", \"prompt\", \"model\", \"system\", \"files\", \"options\", \"json_schema\"})"`
+		ResultsFilepath *string `long:"batch-results" description:"Write results of batch to this JSONL file (default: '<batch file name>.results.jsonl')"`
+		Concurrency     *int    `long:"batch-concurrency" description:"Number of concurrent requests in batch (default: 1)"`
+	} `group:"Batch"`
+
+	// benchmark of models
+	Benchmark struct {
+		Benchmark       bool    `long:"benchmark" description:"Benchmark models, and save the results to the history file"`
+		Models          *string `long:"benchmark-models" description:"Comma-separated models to benchmark (default: all locally installed models)"`
+		PromptsFilepath *string `long:"benchmark-prompts" description:"File of prompts (one per line) for benchmark (default: a standard prompt set)"`
+		Runs            *int    `long:"benchmark-runs" description:"Number of runs for each model (default: 3)"`
+		HistoryFilepath *string `long:"benchmark-history" description:"History file of benchmarks (default: $XDG_STATE_HOME/oll/benchmarks.jsonl)"`
+	} `group:"Benchmark"`
+
+	// model management
+	Models struct {
+		Pull        *string `long:"pull" description:"Pull a model from the registry"`
+		Delete      *string `long:"delete-model" description:"Delete a locally installed model"`
+		Copy        *string `long:"copy-model" description:"Copy a locally installed model (with --copy-model-to)"`
+		CopyTo      *string `long:"copy-model-to" description:"Destination name of the copied model"`
+		Show        *string `long:"show-model" description:"Show the information of a model (details, capabilities, parameters, template, license, and modelfile)"`
+		ListRunning bool    `long:"ps" description:"List running models (loaded in memory)"`
+	} `group:"Model Management"`
+
+	// preload/unload models
+	PreloadModel *string `long:"preload" description:"Preload the model into memory (with --keep-alive, if given)"`
+	UnloadModel  *string `long:"unload" description:"Unload the model from memory"`
+
 	// list models
 	//
 	// https://github.com/ollama/ollama/blob/main/docs/api.md#list-local-models
-	ListModels bool `short:"l" long:"list-models" description:"List available models (locally installed)"`
+	ListModels        bool `short:"l" long:"list-models" description:"List available models (locally installed)"`
+	ListModelsOptions struct {
+		Capabilities []string `long:"capability" description:"List only models with this capability (can be used multiple times, eg. 'tools', 'vision', 'thinking', 'embedding', 'completion', 'image')"`
+		SortBy       *string  `long:"sort" description:"Sort listed models by this key (default: modified)" choice:"name" choice:"size" choice:"modified" choice:"parameters"`
+		Reverse      bool     `long:"reverse" description:"Reverse the order of listed models"`
+	} `group:"List Models"`
 
 	// embedding
 	//
@@ -95,7 +187,25 @@ type params struct {
 	UserAgent               *string `long:"user-agent" description:"Override user-agent when fetching contents from URLs in the prompt"`
 
 	// https://github.com/ollama/ollama/blob/main/docs/faq.md#how-can-i-specify-the-context-window-size
-	ContextWindowSize *int `short:"w" long:"context-window-size" description:"Context window size of the prompt (default: 2048)"`
+	ContextWindowSize *int    `short:"w" long:"context-window-size" description:"Context window size of the prompt (default: num_ctx in options or Modelfile, or the model's context length)"`
+	ContextOverflow   *string `long:"context-overflow" description:"How to handle the prompt which exceeds the context window (default: error)" choice:"error" choice:"drop-oldest" choice:"truncate-files" choice:"summarize"`
+
+	// https://github.com/ollama/ollama/blob/main/docs/faq.md#how-do-i-keep-a-model-loaded-in-memory-or-make-it-unload-immediately
+	KeepAlive *string `long:"keep-alive" description:"How long the model will stay loaded in memory after the request (eg. '10m', '1h', '0' for unloading immediately, '-1' for forever)"`
+
+	// output files
+	OutputFile   *string `short:"o" long:"output-file" description:"Write only the final content of generation to this file (streaming to the terminal is not affected)"`
+	ThinkingFile *string `long:"thinking-file" description:"Write the thinking of generation to this file"`
+
+	// code blocks extraction
+	ExtractCodeToDir *string `long:"extract-code" description:"Extract fenced code blocks of the final content to files in this directory"`
+	OverwriteCode    bool    `long:"overwrite-code" description:"Overwrite existing files when extracting code blocks (default: false)"`
+
+	// output format
+	OutputFormat *string `long:"output" description:"Output format (default: text, 'ndjson' for printing events of generation as JSON lines, 'json' for printing the final result as a JSON object)" choice:"text" choice:"ndjson" choice:"json"`
+
+	// render generated markdown contents in terminal
+	RenderMarkdown bool `long:"render-markdown" description:"Render generated markdown contents in terminal (falls back to plain texts when stdout is not a terminal or colors are not supported)"`
 
 	// other options
 	Verbose []bool `short:"v" long:"verbose" description:"Show verbose logs (can be used multiple times)"`
@@ -106,11 +216,36 @@ func (p *params) hasPrompt() bool {
 	return p.Generation.Prompt != nil && len(*p.Generation.Prompt) > 0
 }
 
+// sessionTaskRequested checks if any task for saved sessions is requested.
+func (p *params) sessionTaskRequested() bool {
+	return p.Sessions.ListSessions ||
+		p.Sessions.ShowSession != nil ||
+		p.Sessions.ForkSession != nil ||
+		p.Sessions.DeleteSession != nil
+}
+
+// modelTaskRequested checks if any task for managing models is requested.
+func (p *params) modelTaskRequested() bool {
+	return p.Models.Pull != nil ||
+		p.Models.Delete != nil ||
+		p.Models.Copy != nil ||
+		p.Models.Show != nil ||
+		p.Models.ListRunning
+}
+
 // taskRequested checks if any task is requested.
 //
 // FIXME: TODO: need to be fixed whenever a new task is added
 func (p *params) taskRequested() bool {
 	return p.hasPrompt() ||
+		p.Chat ||
+		p.sessionTaskRequested() ||
+		p.Batch.Filepath != nil ||
+		p.Benchmark.Benchmark ||
+		p.Generation.Files.DryRunFiles ||
+		p.modelTaskRequested() ||
+		p.PreloadModel != nil ||
+		p.UnloadModel != nil ||
 		p.ListModels ||
 		p.Embeddings.GenerateEmbeddings ||
 		p.MCPTools.RunAsStandaloneStdioServer ||
@@ -125,6 +260,103 @@ func (p *params) multipleTaskRequested() bool {
 	promptCounted := false
 	num := 0
 
+	if p.Chat { // interactive chat
+		num++
+		if hasPrompt && !promptCounted {
+			promptCounted = true
+		}
+	}
+	if p.Sessions.ListSessions { // list saved sessions
+		num++
+		if hasPrompt && !promptCounted {
+			num++
+			promptCounted = true
+		}
+	}
+	if p.Sessions.ShowSession != nil { // show a saved session
+		num++
+		if hasPrompt && !promptCounted {
+			num++
+			promptCounted = true
+		}
+	}
+	if p.Sessions.ForkSession != nil { // fork a saved session
+		num++
+		if hasPrompt && !promptCounted {
+			num++
+			promptCounted = true
+		}
+	}
+	if p.Sessions.DeleteSession != nil { // delete a saved session
+		num++
+		if hasPrompt && !promptCounted {
+			num++
+			promptCounted = true
+		}
+	}
+	if p.Batch.Filepath != nil { // run prompts in batch
+		num++
+		if hasPrompt && !promptCounted {
+			num++
+			promptCounted = true
+		}
+	}
+	if p.Benchmark.Benchmark { // benchmark models
+		num++
+		if hasPrompt && !promptCounted {
+			num++
+			promptCounted = true
+		}
+	}
+	if p.Models.Pull != nil { // pull a model
+		num++
+		if hasPrompt && !promptCounted {
+			num++
+			promptCounted = true
+		}
+	}
+	if p.Models.Delete != nil { // delete a model
+		num++
+		if hasPrompt && !promptCounted {
+			num++
+			promptCounted = true
+		}
+	}
+	if p.Models.Copy != nil { // copy a model
+		num++
+		if hasPrompt && !promptCounted {
+			num++
+			promptCounted = true
+		}
+	}
+	if p.Models.Show != nil { // show a model
+		num++
+		if hasPrompt && !promptCounted {
+			num++
+			promptCounted = true
+		}
+	}
+	if p.Models.ListRunning { // list running models
+		num++
+		if hasPrompt && !promptCounted {
+			num++
+			promptCounted = true
+		}
+	}
+	if p.PreloadModel != nil { // preload a model
+		num++
+		if hasPrompt && !promptCounted {
+			num++
+			promptCounted = true
+		}
+	}
+	if p.UnloadModel != nil { // unload a model
+		num++
+		if hasPrompt && !promptCounted {
+			num++
+			promptCounted = true
+		}
+	}
 	if p.ListModels { // list locally installed models
 		num++
 		if hasPrompt && !promptCounted {
@@ -132,6 +364,12 @@ func (p *params) multipleTaskRequested() bool {
 			promptCounted = true
 		}
 	}
+	if p.Generation.Files.DryRunFiles { // print files to be attached
+		num++
+		if hasPrompt && !promptCounted {
+			promptCounted = true
+		}
+	}
 	if p.Embeddings.GenerateEmbeddings { // generate embeddings
 		num++
 		if hasPrompt && !promptCounted {
@@ -0,0 +1,1271 @@
+// pdf.go
+//
+// things for extracting texts from PDF documents, and rendering their pages to images
+//
+// https://opensource.adobe.com/dc-acrobat-sdk-docs/pdfstandards/PDF32000_2008.pdf
+
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"context"
+	"crypto/sha256"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	pdfMimeType = "application/pdf"
+
+	// command for rendering pages of PDF documents to PNG images (from poppler)
+	pdfRendererCommand = "pdftoppm"
+	pdfRenderDPI       = 100
+
+	// timeout of rendering pages of a PDF document
+	pdfRenderTimeoutSeconds = 60
+
+	// max size of a decoded stream of PDF documents (against decompression bombs)
+	maxPDFStreamBytes = 64 * 1024 * 1024
+
+	// max number of pages to be rendered to images
+	maxRenderedPDFPages = 20
+
+	// max depth of nested form XObjects and references
+	maxPDFDepth = 32
+
+	// max depth of nested arrays and dictionaries
+	maxPDFNestingDepth = 256
+)
+
+var errPDFEncrypted = errors.New("encrypted PDF documents are not supported")
+
+// PDF objects
+type (
+	pdfName    string
+	pdfKeyword string // keywords, operators, and delimiters ('[', ']', '<<', '>>')
+	pdfString  []byte
+	pdfDict    map[string]any
+	pdfRef     struct{ num, gen int }
+	pdfStream  struct {
+		dict pdfDict
+		raw  []byte
+	}
+)
+
+// a lexer (and parser) for PDF objects and content streams
+type pdfLexer struct {
+	data  []byte
+	pos   int
+	depth int // depth of nested arrays and dictionaries
+}
+
+// isPDFWhitespace checks if given byte is a whitespace in PDF.
+func isPDFWhitespace(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+// isPDFDelimiter checks if given byte is a delimiter in PDF.
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+// skipSpaces skips whitespaces and comments.
+func (l *pdfLexer) skipSpaces() {
+	for l.pos < len(l.data) {
+		if c := l.data[l.pos]; isPDFWhitespace(c) {
+			l.pos++
+		} else if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		} else {
+			break
+		}
+	}
+}
+
+// next returns the next token.
+func (l *pdfLexer) next() (any, error) {
+	// NOTE: positions out of range (eg. from broken offsets) are treated as the end of data
+	if l.pos < 0 || l.pos > len(l.data) {
+		l.pos = len(l.data)
+	}
+
+	l.skipSpaces()
+	if l.pos >= len(l.data) {
+		return nil, io.EOF
+	}
+
+	switch c := l.data[l.pos]; c {
+	case '[', ']', '{', '}':
+		l.pos++
+		return pdfKeyword(c), nil
+	case '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return pdfKeyword("<<"), nil
+		}
+		return l.hexString(), nil
+	case '>':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '>' {
+			l.pos += 2
+			return pdfKeyword(">>"), nil
+		}
+		l.pos++
+		return pdfKeyword(">"), nil
+	case '(':
+		return l.literalString(), nil
+	case '/':
+		return l.name(), nil
+	case ')':
+		l.pos++
+		return pdfKeyword(")"), nil
+	}
+
+	// numbers or keywords
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFWhitespace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	token := string(l.data[start:l.pos])
+	if strings.IndexFunc(token, func(r rune) bool {
+		return !strings.ContainsRune("+-.0123456789", r)
+	}) < 0 {
+		if num, err := strconv.ParseFloat(token, 64); err == nil {
+			return num, nil
+		}
+	}
+	return pdfKeyword(token), nil
+}
+
+// name reads a name (eg. '/Type').
+func (l *pdfLexer) name() pdfName {
+	l.pos++ // '/'
+
+	var sb strings.Builder
+	for l.pos < len(l.data) && !isPDFWhitespace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		if c := l.data[l.pos]; c == '#' && l.pos+2 < len(l.data) {
+			if decoded, err := hex.DecodeString(string(l.data[l.pos+1 : l.pos+3])); err == nil {
+				sb.Write(decoded)
+				l.pos += 3
+				continue
+			}
+		}
+		sb.WriteByte(l.data[l.pos])
+		l.pos++
+	}
+	return pdfName(sb.String())
+}
+
+// hexString reads a hexadecimal string (eg. '<48656C6C6F>').
+func (l *pdfLexer) hexString() pdfString {
+	l.pos++ // '<'
+
+	digits := []byte{}
+	for l.pos < len(l.data) && l.data[l.pos] != '>' {
+		if c := l.data[l.pos]; (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F') {
+			digits = append(digits, c)
+		}
+		l.pos++
+	}
+	if l.pos < len(l.data) {
+		l.pos++ // '>'
+	}
+
+	if len(digits)%2 != 0 {
+		digits = append(digits, '0')
+	}
+	decoded, _ := hex.DecodeString(string(digits))
+	return pdfString(decoded)
+}
+
+// literalString reads a literal string (eg. '(Hello \(world\))').
+func (l *pdfLexer) literalString() pdfString {
+	l.pos++ // '('
+
+	var buf []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return pdfString(buf)
+			}
+		case '\r': // (end of line is always '\n')
+			if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+				l.pos++
+			}
+			c = '\n'
+		case '\\':
+			if l.pos >= len(l.data) {
+				continue
+			}
+			escaped := l.data[l.pos]
+			l.pos++
+
+			switch escaped {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n': // (line continuation)
+				if escaped == '\r' && l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			default:
+				if escaped >= '0' && escaped <= '7' { // (octal)
+					code := int(escaped - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						code = code*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(code)
+				} else {
+					c = escaped
+				}
+			}
+		}
+		buf = append(buf, c)
+	}
+	return pdfString(buf)
+}
+
+// parseObject parses the next object (keywords and operators are returned as `pdfKeyword`).
+func (l *pdfLexer) parseObject() (any, error) {
+	token, err := l.next()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := token.(type) {
+	case pdfKeyword:
+		if t == "[" || t == "<<" {
+			if l.depth >= maxPDFNestingDepth {
+				return nil, fmt.Errorf("too deeply nested objects")
+			}
+			l.depth++
+			defer func() { l.depth-- }()
+		}
+
+		switch t {
+		case "[":
+			array := []any{}
+			for {
+				obj, err := l.parseObject()
+				if err != nil {
+					return array, err
+				}
+				if obj == pdfKeyword("]") {
+					return array, nil
+				}
+				array = append(array, obj)
+			}
+		case "<<":
+			dict := pdfDict{}
+			for {
+				key, err := l.parseObject()
+				if err != nil {
+					return dict, err
+				}
+				if key == pdfKeyword(">>") {
+					return dict, nil
+				}
+				name, ok := key.(pdfName)
+				if !ok {
+					continue
+				}
+				value, err := l.parseObject()
+				if err != nil {
+					return dict, err
+				}
+				dict[string(name)] = value
+			}
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return t, nil
+	case float64:
+		// (reference: 'NUM GEN R')
+		if t >= 0 && t == float64(int(t)) {
+			saved := l.pos
+			if gen, err := l.next(); err == nil {
+				if g, ok := gen.(float64); ok && g >= 0 && g == float64(int(g)) {
+					if r, err := l.next(); err == nil && r == pdfKeyword("R") {
+						return pdfRef{num: int(t), gen: int(g)}, nil
+					}
+				}
+			}
+			l.pos = saved
+		}
+		return t, nil
+	}
+
+	return token, nil
+}
+
+// a (loaded) PDF document
+type pdfDocument struct {
+	objects  map[int]any
+	trailers []pdfDict
+}
+
+var _pdfObjectRegexp = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// loadPDF loads objects of given PDF document.
+//
+// NOTE: objects are found by scanning the whole document (without cross-reference tables),
+// so it works with (slightly) broken documents too, and latter objects take precedence.
+func loadPDF(data []byte) (doc *pdfDocument, err error) {
+	if !bytes.Contains(data[:min(len(data), 1024)], []byte("%PDF-")) {
+		return nil, fmt.Errorf("not a PDF document")
+	}
+
+	doc = &pdfDocument{
+		objects: map[int]any{},
+	}
+
+	// objects
+	for pos := 0; pos < len(data); {
+		loc := _pdfObjectRegexp.FindSubmatchIndex(data[pos:])
+		if loc == nil {
+			break
+		}
+		num, _ := strconv.Atoi(string(data[pos+loc[2] : pos+loc[3]]))
+
+		l := &pdfLexer{data: data, pos: pos + loc[1]}
+		obj, err := l.parseObject()
+		if err != nil {
+			pos += loc[1]
+			continue
+		}
+
+		// (stream)
+		saved := l.pos
+		if token, _ := l.next(); token == pdfKeyword("stream") {
+			if dict, ok := obj.(pdfDict); ok {
+				stream, end := readPDFStream(data, l.pos, dict)
+				obj, l.pos = stream, end
+			}
+		} else {
+			l.pos = saved
+		}
+		doc.objects[num] = obj
+
+		if stream, ok := obj.(*pdfStream); ok {
+			switch stream.dict["Type"] {
+			case pdfName("ObjStm"): // (object stream)
+				doc.loadObjectStream(stream)
+			case pdfName("XRef"): // (cross-reference stream, which works as a trailer)
+				doc.trailers = append(doc.trailers, stream.dict)
+			}
+		}
+
+		pos = l.pos
+	}
+
+	// trailers
+	for pos := 0; ; {
+		idx := bytes.Index(data[pos:], []byte("trailer"))
+		if idx < 0 {
+			break
+		}
+		l := &pdfLexer{data: data, pos: pos + idx + len("trailer")}
+		if obj, err := l.parseObject(); err == nil {
+			if dict, ok := obj.(pdfDict); ok {
+				doc.trailers = append(doc.trailers, dict)
+			}
+		}
+		pos = l.pos
+	}
+	for _, trailer := range doc.trailers {
+		if _, exists := trailer["Encrypt"]; exists {
+			return nil, errPDFEncrypted
+		}
+	}
+
+	return doc, nil
+}
+
+// readPDFStream reads the data of a stream which starts at `start` (right after the 'stream' keyword).
+func readPDFStream(data []byte, start int, dict pdfDict) (stream *pdfStream, end int) {
+	// (EOL after the 'stream' keyword)
+	if start < len(data) && data[start] == '\r' {
+		start++
+	}
+	if start < len(data) && data[start] == '\n' {
+		start++
+	}
+
+	end = -1
+	// NOTE: check the range before converting to int, as it can overflow with a broken length
+	if length, ok := dict["Length"].(float64); ok && length >= 0 && length <= float64(len(data)-start) {
+		if bytes.HasPrefix(bytes.TrimLeft(data[start+int(length):], "\x00\t\n\f\r "), []byte("endstream")) {
+			end = start + int(length)
+		}
+	}
+	if end < 0 { // (no or wrong length)
+		if idx := bytes.Index(data[start:], []byte("endstream")); idx >= 0 {
+			end = start + idx
+			for end > start && (data[end-1] == '\n' || data[end-1] == '\r') {
+				end--
+			}
+		} else {
+			end = len(data)
+		}
+	}
+	stream = &pdfStream{dict: dict, raw: data[start:end]}
+
+	if idx := bytes.Index(data[end:], []byte("endstream")); idx >= 0 {
+		end += idx + len("endstream")
+	}
+	return stream, end
+}
+
+// loadObjectStream loads objects in given object stream.
+func (d *pdfDocument) loadObjectStream(stream *pdfStream) {
+	data, err := d.streamData(stream)
+	if err != nil {
+		return
+	}
+	n, _ := d.resolve(stream.dict["N"]).(float64)
+	first, _ := d.resolve(stream.dict["First"]).(float64)
+	if n < 0 || n > float64(len(data)) || first < 0 || first >= float64(len(data)) {
+		return
+	}
+
+	l := &pdfLexer{data: data}
+	for range int(n) {
+		num, err1 := l.next()
+		offset, err2 := l.next()
+		if err1 != nil || err2 != nil {
+			return
+		}
+		numF, ok1 := num.(float64)
+		offsetF, ok2 := offset.(float64)
+		if !ok1 || !ok2 || offsetF < 0 || first+offsetF >= float64(len(data)) {
+			continue
+		}
+
+		ol := &pdfLexer{data: data, pos: int(first + offsetF)}
+		if obj, err := ol.parseObject(); err == nil {
+			d.objects[int(numF)] = obj
+		}
+	}
+}
+
+// resolve resolves given object if it is a reference.
+func (d *pdfDocument) resolve(obj any) any {
+	for range maxPDFDepth {
+		ref, ok := obj.(pdfRef)
+		if !ok {
+			return obj
+		}
+		obj = d.objects[ref.num]
+	}
+	return nil
+}
+
+// dict resolves given object as a dictionary (or a dictionary of a stream).
+func (d *pdfDocument) dict(obj any) pdfDict {
+	switch o := d.resolve(obj).(type) {
+	case pdfDict:
+		return o
+	case *pdfStream:
+		return o.dict
+	}
+	return nil
+}
+
+// streamData decodes the data of given stream with its filters.
+func (d *pdfDocument) streamData(stream *pdfStream) (data []byte, err error) {
+	filters := []any{}
+	switch f := d.resolve(stream.dict["Filter"]).(type) {
+	case pdfName:
+		filters = append(filters, f)
+	case []any:
+		filters = f
+	}
+	params := []any{}
+	switch p := d.resolve(stream.dict["DecodeParms"]).(type) {
+	case pdfDict:
+		params = append(params, p)
+	case []any:
+		params = p
+	}
+
+	data = stream.raw
+	for i, filter := range filters {
+		var param pdfDict
+		if i < len(params) {
+			param = d.dict(params[i])
+		}
+
+		switch d.resolve(filter) {
+		case pdfName("FlateDecode"), pdfName("Fl"):
+			if data, err = inflatePDFData(data); err != nil {
+				return nil, err
+			}
+			if predictor, _ := d.resolve(param["Predictor"]).(float64); predictor >= 10 {
+				columns, _ := d.resolve(param["Columns"]).(float64)
+				if columns = max(columns, 1); columns > float64(len(data)) {
+					return nil, fmt.Errorf("invalid columns of PNG predicted data: %v", columns)
+				}
+				if data, err = unpredictPNG(data, int(columns)); err != nil {
+					return nil, err
+				}
+			}
+		case pdfName("ASCIIHexDecode"), pdfName("AHx"):
+			l := &pdfLexer{data: append([]byte{'<'}, data...)}
+			data = l.hexString()
+		case pdfName("ASCII85Decode"), pdfName("A85"):
+			trimmed := bytes.TrimSpace(data)
+			trimmed = bytes.TrimPrefix(trimmed, []byte("<~"))
+			trimmed = bytes.TrimSuffix(trimmed, []byte("~>"))
+			if data, err = io.ReadAll(io.LimitReader(ascii85.NewDecoder(bytes.NewReader(trimmed)), maxPDFStreamBytes+1)); err != nil {
+				return nil, fmt.Errorf("failed to decode ASCII85 data: %w", err)
+			}
+			if len(data) > maxPDFStreamBytes {
+				return nil, fmt.Errorf("decoded stream is too large (> %d bytes)", maxPDFStreamBytes)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported filter: %v", filter)
+		}
+	}
+
+	return data, nil
+}
+
+// inflatePDFData inflates given (zlib or raw deflate) data.
+//
+// NOTE: data inflated before an error (eg. broken checksum) is returned without the error,
+// and inflating data larger than `maxPDFStreamBytes` fails.
+func inflatePDFData(data []byte) ([]byte, error) {
+	var r io.ReadCloser
+	if zr, err := zlib.NewReader(bytes.NewReader(data)); err == nil {
+		r = zr
+	} else {
+		r = flate.NewReader(bytes.NewReader(data))
+	}
+	defer func() { _ = r.Close() }()
+
+	inflated, err := io.ReadAll(io.LimitReader(r, maxPDFStreamBytes+1))
+	if err != nil && len(inflated) <= 0 {
+		return nil, fmt.Errorf("failed to inflate data: %w", err)
+	}
+	if len(inflated) > maxPDFStreamBytes {
+		return nil, fmt.Errorf("inflated data is too large (> %d bytes)", maxPDFStreamBytes)
+	}
+	return inflated, nil
+}
+
+// unpredictPNG reverts PNG predictors of given data (with 1 byte per pixel).
+func unpredictPNG(data []byte, columns int) ([]byte, error) {
+	rowLen := columns + 1
+	if len(data)%rowLen != 0 {
+		return nil, fmt.Errorf("invalid length of PNG predicted data: %d", len(data))
+	}
+
+	result := make([]byte, 0, len(data)/rowLen*columns)
+	prev := make([]byte, columns)
+	for i := 0; i < len(data); i += rowLen {
+		filter, row := data[i], slices.Clone(data[i+1:i+rowLen])
+		for j := range row {
+			var left, upLeft byte
+			if j > 0 {
+				left, upLeft = row[j-1], prev[j-1]
+			}
+			up := prev[j]
+
+			switch filter {
+			case 1: // sub
+				row[j] += left
+			case 2: // up
+				row[j] += up
+			case 3: // average
+				row[j] += byte((int(left) + int(up)) / 2)
+			case 4: // paeth
+				p := int(left) + int(up) - int(upLeft)
+				pa, pb, pc := max(p-int(left), int(left)-p), max(p-int(up), int(up)-p), max(p-int(upLeft), int(upLeft)-p)
+				if pa <= pb && pa <= pc {
+					row[j] += left
+				} else if pb <= pc {
+					row[j] += up
+				} else {
+					row[j] += upLeft
+				}
+			}
+		}
+		result = append(result, row...)
+		prev = row
+	}
+	return result, nil
+}
+
+// a page of PDF document
+type pdfPage struct {
+	dict      pdfDict
+	resources pdfDict
+}
+
+// pages returns pages of the document in order.
+func (d *pdfDocument) pages() (pages []pdfPage) {
+	// find the catalog
+	var catalog pdfDict
+	for i := len(d.trailers) - 1; i >= 0 && catalog == nil; i-- {
+		catalog = d.dict(d.trailers[i]["Root"])
+	}
+	if catalog == nil {
+		for _, num := range slices.Sorted(maps.Keys(d.objects)) {
+			if dict := d.dict(d.objects[num]); dict["Type"] == pdfName("Catalog") {
+				catalog = dict
+			}
+		}
+	}
+
+	// traverse the page tree
+	visited := map[int]bool{}
+	var traverse func(node any, resources pdfDict, depth int)
+	traverse = func(node any, resources pdfDict, depth int) {
+		if ref, ok := node.(pdfRef); ok {
+			if visited[ref.num] {
+				return
+			}
+			visited[ref.num] = true
+		}
+		dict := d.dict(node)
+		if dict == nil || depth > maxPDFDepth {
+			return
+		}
+		if res := d.dict(dict["Resources"]); res != nil {
+			resources = res
+		}
+
+		if kids, ok := d.resolve(dict["Kids"]).([]any); ok {
+			for _, kid := range kids {
+				traverse(kid, resources, depth+1)
+			}
+		} else if dict["Type"] == pdfName("Page") || dict["Contents"] != nil {
+			pages = append(pages, pdfPage{dict: dict, resources: resources})
+		}
+	}
+	if catalog != nil {
+		traverse(catalog["Pages"], nil, 0)
+	}
+
+	// (fallback: all page objects in the order of object numbers)
+	if len(pages) <= 0 {
+		for _, num := range slices.Sorted(maps.Keys(d.objects)) {
+			if dict := d.dict(d.objects[num]); dict["Type"] == pdfName("Page") {
+				pages = append(pages, pdfPage{dict: dict, resources: d.dict(dict["Resources"])})
+			}
+		}
+	}
+
+	return pages
+}
+
+// contents returns the (decoded and concatenated) content streams of given page.
+func (d *pdfDocument) contents(page pdfPage) []byte {
+	streams := []any{}
+	switch c := d.resolve(page.dict["Contents"]).(type) {
+	case *pdfStream:
+		streams = append(streams, c)
+	case []any:
+		streams = c
+	}
+
+	var buf bytes.Buffer
+	for _, s := range streams {
+		if stream, ok := d.resolve(s).(*pdfStream); ok {
+			if data, err := d.streamData(stream); err == nil {
+				buf.Write(data)
+				buf.WriteByte('\n')
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+// a font for decoding texts in content streams
+type pdfFont struct {
+	twoByte   bool            // 2-byte codes (eg. Type0 fonts with Identity-H encoding)
+	toUnicode map[int]string  // from ToUnicode CMap
+	encoding  map[byte]string // for simple fonts (overridden by Differences)
+}
+
+// loadFont loads a font from given font dictionary.
+func (d *pdfDocument) loadFont(obj any) *pdfFont {
+	font := &pdfFont{
+		encoding: map[byte]string{},
+	}
+	dict := d.dict(obj)
+	if dict == nil {
+		return font
+	}
+
+	if dict["Subtype"] == pdfName("Type0") {
+		font.twoByte = true
+	}
+
+	// (differences of encoding)
+	if enc := d.dict(dict["Encoding"]); enc != nil {
+		if differences, ok := d.resolve(enc["Differences"]).([]any); ok {
+			code := 0
+			for _, diff := range differences {
+				switch v := d.resolve(diff).(type) {
+				case float64:
+					code = int(v)
+				case pdfName:
+					if text, ok := glyphNameToText(string(v)); ok && code >= 0 && code < 256 {
+						font.encoding[byte(code)] = text
+					}
+					code++
+				}
+			}
+		}
+	}
+
+	// (ToUnicode CMap)
+	if stream, ok := d.resolve(dict["ToUnicode"]).(*pdfStream); ok {
+		if data, err := d.streamData(stream); err == nil {
+			var codeLength int
+			font.toUnicode, codeLength = parseToUnicodeCMap(data)
+			if codeLength >= 2 {
+				font.twoByte = true
+			}
+		}
+	}
+
+	return font
+}
+
+// decode decodes given string (shown with this font) to text.
+func (f *pdfFont) decode(s pdfString) string {
+	var sb strings.Builder
+
+	if f.twoByte {
+		for i := 0; i+1 < len(s); i += 2 {
+			if text, ok := f.toUnicode[int(s[i])<<8|int(s[i+1])]; ok {
+				sb.WriteString(text)
+			}
+		}
+		return sb.String()
+	}
+
+	for _, c := range []byte(s) {
+		if text, ok := f.toUnicode[int(c)]; ok {
+			sb.WriteString(text)
+		} else if text, ok := f.encoding[c]; ok {
+			sb.WriteString(text)
+		} else {
+			sb.WriteRune(winAnsiToRune(c))
+		}
+	}
+	return sb.String()
+}
+
+// parseToUnicodeCMap parses given ToUnicode CMap, and returns its mappings and the length of codes.
+func parseToUnicodeCMap(data []byte) (mappings map[int]string, codeLength int) {
+	mappings = map[int]string{}
+	codeLength = 1
+
+	l := &pdfLexer{data: data}
+	operands := []any{}
+	for {
+		obj, err := l.parseObject()
+		if err != nil {
+			break
+		}
+		keyword, ok := obj.(pdfKeyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+
+		switch keyword {
+		case "endcodespacerange":
+			for _, operand := range operands {
+				if s, ok := operand.(pdfString); ok {
+					codeLength = max(codeLength, len(s))
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].(pdfString)
+				dst, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 {
+					mappings[bytesToCode(src)] = utf16BEToString(dst)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if !ok1 || !ok2 {
+					continue
+				}
+				from, to := bytesToCode(lo), bytesToCode(hi)
+				if to < from || to-from > 0xFFFF {
+					continue
+				}
+
+				switch dst := operands[i+2].(type) {
+				case pdfString: // (incremented from the destination)
+					units := utf16BEUnits(dst)
+					if len(units) <= 0 {
+						continue
+					}
+					for code := from; code <= to; code++ {
+						incremented := slices.Clone(units)
+						incremented[len(incremented)-1] += uint16(code - from)
+						mappings[code] = string(utf16.Decode(incremented))
+					}
+				case []any: // (array of destinations)
+					for j, d := range dst {
+						if s, ok := d.(pdfString); ok && from+j <= to {
+							mappings[from+j] = utf16BEToString(s)
+						}
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+
+	return mappings, codeLength
+}
+
+// bytesToCode converts given big-endian bytes to a code.
+func bytesToCode(b []byte) (code int) {
+	for _, c := range b {
+		code = code<<8 | int(c)
+	}
+	return code
+}
+
+// utf16BEUnits converts given UTF-16BE bytes to code units.
+func utf16BEUnits(b []byte) (units []uint16) {
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return units
+}
+
+// utf16BEToString converts given UTF-16BE bytes to a string.
+func utf16BEToString(b []byte) string {
+	return string(utf16.Decode(utf16BEUnits(b)))
+}
+
+// characters of WinAnsiEncoding (in 0x80 ~ 0x9F) which are different from Latin-1
+var _winAnsiSpecials = map[byte]rune{
+	0x80: '€', 0x82: '‚', 0x83: 'ƒ', 0x84: '„', 0x85: '…', 0x86: '†', 0x87: '‡',
+	0x88: 'ˆ', 0x89: '‰', 0x8A: 'Š', 0x8B: '‹', 0x8C: 'Œ', 0x8E: 'Ž',
+	0x91: '‘', 0x92: '’', 0x93: '“', 0x94: '”', 0x95: '•', 0x96: '–', 0x97: '—',
+	0x98: '˜', 0x99: '™', 0x9A: 'š', 0x9B: '›', 0x9C: 'œ', 0x9E: 'ž', 0x9F: 'Ÿ',
+}
+
+// winAnsiToRune converts given code in WinAnsiEncoding to a rune.
+//
+// NOTE: other standard encodings (eg. MacRomanEncoding) are also treated as WinAnsiEncoding.
+func winAnsiToRune(c byte) rune {
+	if r, exists := _winAnsiSpecials[c]; exists {
+		return r
+	}
+	if c < 0x20 {
+		return ' '
+	}
+	return rune(c)
+}
+
+// texts of frequently used glyph names (which are not a single character)
+var _glyphNames = map[string]string{
+	"space": " ", "exclam": "!", "quotedbl": "\"", "numbersign": "#", "dollar": "$", "percent": "%",
+	"ampersand": "&", "quotesingle": "'", "parenleft": "(", "parenright": ")", "asterisk": "*",
+	"plus": "+", "comma": ",", "hyphen": "-", "period": ".", "slash": "/",
+	"zero": "0", "one": "1", "two": "2", "three": "3", "four": "4",
+	"five": "5", "six": "6", "seven": "7", "eight": "8", "nine": "9",
+	"colon": ":", "semicolon": ";", "less": "<", "equal": "=", "greater": ">", "question": "?", "at": "@",
+	"bracketleft": "[", "backslash": "\\", "bracketright": "]", "asciicircum": "^", "underscore": "_",
+	"grave": "`", "braceleft": "{", "bar": "|", "braceright": "}", "asciitilde": "~",
+	"quoteleft": "‘", "quoteright": "’", "quotedblleft": "“", "quotedblright": "”",
+	"quotesinglbase": "‚", "quotedblbase": "„", "guillemotleft": "«", "guillemotright": "»",
+	"endash": "–", "emdash": "—", "bullet": "•", "ellipsis": "…", "minus": "−",
+	"dagger": "†", "daggerdbl": "‡", "section": "§", "paragraph": "¶", "periodcentered": "·",
+	"degree": "°", "copyright": "©", "registered": "®", "trademark": "™",
+	"fi": "fi", "fl": "fl", "ff": "ff", "ffi": "ffi", "ffl": "ffl",
+	"multiply": "×", "divide": "÷", "plusminus": "±", "nbspace": " ",
+}
+
+// glyphNameToText converts given glyph name to text.
+func glyphNameToText(name string) (string, bool) {
+	if text, exists := _glyphNames[name]; exists {
+		return text, true
+	}
+	if len(name) == 1 {
+		return name, true
+	}
+
+	// (eg. 'uni0041', 'u1F600')
+	for _, prefix := range []string{"uni", "u"} {
+		if hexDigits, found := strings.CutPrefix(name, prefix); found && len(hexDigits) >= 4 && len(hexDigits) <= 6 {
+			if code, err := strconv.ParseUint(hexDigits, 16, 32); err == nil {
+				return string(rune(code)), true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// extracts texts from content streams
+type pdfTextExtractor struct {
+	doc   *pdfDocument
+	sb    strings.Builder
+	fonts map[pdfRef]*pdfFont // (cache)
+
+	lastY float64
+}
+
+// newline appends a new line (if there isn't).
+func (e *pdfTextExtractor) newline() {
+	if s := e.sb.String(); len(s) > 0 && !strings.HasSuffix(s, "\n") {
+		e.sb.WriteString("\n")
+	}
+}
+
+// space appends a space (if there isn't).
+func (e *pdfTextExtractor) space() {
+	if s := e.sb.String(); len(s) > 0 && !strings.HasSuffix(s, " ") && !strings.HasSuffix(s, "\n") {
+		e.sb.WriteString(" ")
+	}
+}
+
+// font returns a font with given name in resources.
+func (e *pdfTextExtractor) font(fonts pdfDict, name pdfName) *pdfFont {
+	obj := fonts[string(name)]
+	if ref, ok := obj.(pdfRef); ok {
+		if font, exists := e.fonts[ref]; exists {
+			return font
+		}
+		font := e.doc.loadFont(ref)
+		e.fonts[ref] = font
+		return font
+	}
+	return e.doc.loadFont(obj)
+}
+
+// extract extracts texts from given content stream.
+func (e *pdfTextExtractor) extract(
+	content []byte,
+	resources pdfDict,
+	depth int,
+) {
+	if depth > maxPDFDepth {
+		return
+	}
+
+	fonts := e.doc.dict(resources["Font"])
+	xobjects := e.doc.dict(resources["XObject"])
+	font := &pdfFont{}
+
+	number := func(obj any) float64 {
+		n, _ := obj.(float64)
+		return n
+	}
+	show := func(obj any) {
+		if s, ok := obj.(pdfString); ok {
+			e.sb.WriteString(font.decode(s))
+		}
+	}
+
+	l := &pdfLexer{data: content}
+	operands := []any{}
+	for {
+		obj, err := l.parseObject()
+		if err != nil {
+			break
+		}
+		operator, ok := obj.(pdfKeyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+
+		switch operator {
+		case "Tf": // font
+			if len(operands) >= 2 {
+				if name, ok := operands[len(operands)-2].(pdfName); ok {
+					font = e.font(fonts, name)
+				}
+			}
+		case "Td", "TD": // move to the next line (or to the right)
+			if len(operands) >= 2 {
+				if ty := number(operands[1]); ty != 0 {
+					e.lastY += ty
+					e.newline()
+				} else {
+					e.space()
+				}
+			}
+		case "Tm": // text matrix
+			if len(operands) >= 6 {
+				if y := number(operands[5]); y != e.lastY {
+					e.lastY = y
+					e.newline()
+				} else {
+					e.space()
+				}
+			}
+		case "T*":
+			e.newline()
+		case "Tj":
+			if len(operands) >= 1 {
+				show(operands[len(operands)-1])
+			}
+		case "'":
+			e.newline()
+			if len(operands) >= 1 {
+				show(operands[len(operands)-1])
+			}
+		case "\"":
+			e.newline()
+			if len(operands) >= 3 {
+				show(operands[2])
+			}
+		case "TJ":
+			if len(operands) >= 1 {
+				if array, ok := operands[len(operands)-1].([]any); ok {
+					for _, element := range array {
+						if n, ok := element.(float64); ok {
+							if n < -200 { // (large enough gap for a space, in thousandths of text space)
+								e.space()
+							}
+						} else {
+							show(element)
+						}
+					}
+				}
+			}
+		case "ET":
+			e.space()
+		case "Do": // form XObjects
+			if len(operands) >= 1 {
+				if name, ok := operands[len(operands)-1].(pdfName); ok {
+					if stream, ok := e.doc.resolve(xobjects[string(name)]).(*pdfStream); ok && stream.dict["Subtype"] == pdfName("Form") {
+						if data, err := e.doc.streamData(stream); err == nil {
+							formResources := e.doc.dict(stream.dict["Resources"])
+							if formResources == nil {
+								formResources = resources
+							}
+							e.extract(data, formResources, depth+1)
+						}
+					}
+				}
+			}
+		case "ID": // inline image data (skip until 'EI')
+			l.pos++
+			for l.pos+2 <= len(l.data) {
+				if l.data[l.pos] == 'E' && l.data[l.pos+1] == 'I' &&
+					(l.pos == 0 || isPDFWhitespace(l.data[l.pos-1])) &&
+					(l.pos+2 == len(l.data) || isPDFWhitespace(l.data[l.pos+2])) {
+					l.pos += 2
+					break
+				}
+				l.pos++
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+// pdfToText extracts texts of each page from given PDF document.
+func pdfToText(data []byte) (pages []string, err error) {
+	doc, err := loadPDF(data)
+	if err != nil {
+		return nil, err
+	}
+
+	extractor := &pdfTextExtractor{
+		doc:   doc,
+		fonts: map[pdfRef]*pdfFont{},
+	}
+	for _, page := range doc.pages() {
+		extractor.sb.Reset()
+		extractor.lastY = 0
+		extractor.extract(doc.contents(page), page.resources, 0)
+
+		pages = append(pages, cleanUpExtractedText(extractor.sb.String()))
+	}
+	if len(pages) <= 0 {
+		return nil, fmt.Errorf("no pages found in PDF document")
+	}
+	if len(strings.Join(pages, "")) <= 0 {
+		return nil, fmt.Errorf("no texts found in PDF document (scanned images?)")
+	}
+
+	return pages, nil
+}
+
+var _consecutiveSpacesRegexp = regexp.MustCompile(`[ \t\p{Zs}]{2,}`)
+
+// cleanUpExtractedText removes redundant spaces and empty lines in given text.
+func cleanUpExtractedText(text string) string {
+	lines := []string{}
+	for line := range strings.SplitSeq(text, "\n") {
+		line = strings.TrimSpace(_consecutiveSpacesRegexp.ReplaceAllString(line, " "))
+		if len(line) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatPDFPages formats texts of pages with page markers.
+func formatPDFPages(pages []string) string {
+	var sb strings.Builder
+	for i, page := range pages {
+		fmt.Fprintf(&sb, "<page number=\"%d\">\n%s\n</page>\n", i+1, page)
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// cache of rendered pages of PDF documents, keyed by hashes of their contents
+//
+// (for not rendering the same documents again on recursive generations)
+type pdfPagesCache struct {
+	mutex sync.Mutex
+	pages map[[sha256.Size]byte]*renderedPDFPages
+}
+
+// rendered (or being rendered) pages of a PDF document
+type renderedPDFPages struct {
+	done   chan struct{} // closed when rendering is finished
+	images [][]byte
+	err    error
+}
+
+// newPDFPagesCache returns a new cache of rendered pages of PDF documents.
+func newPDFPagesCache() *pdfPagesCache {
+	return &pdfPagesCache{
+		pages: map[[sha256.Size]byte]*renderedPDFPages{},
+	}
+}
+
+// render returns rendered pages of given PDF document from the cache, or renders them with `renderPDFPages`.
+//
+// (renders without caching if the cache is nil)
+//
+// NOTE: different documents are rendered concurrently, and callers of a document being rendered wait for its result.
+func (c *pdfPagesCache) render(data []byte, maxPages int) (images [][]byte, err error) {
+	if c == nil {
+		return renderPDFPages(data, maxPages)
+	}
+
+	key := sha256.Sum256(data)
+
+	c.mutex.Lock()
+	if rendered, exists := c.pages[key]; exists {
+		c.mutex.Unlock()
+
+		<-rendered.done
+		return rendered.images, rendered.err
+	}
+	rendered := &renderedPDFPages{done: make(chan struct{})}
+	c.pages[key] = rendered
+	c.mutex.Unlock()
+
+	rendered.images, rendered.err = renderPDFPages(data, maxPages)
+	if rendered.err != nil {
+		// NOTE: failed renders are not cached, so they can be retried later
+		c.mutex.Lock()
+		delete(c.pages, key)
+		c.mutex.Unlock()
+	}
+	close(rendered.done)
+
+	return rendered.images, rendered.err
+}
+
+// renderPDFPages renders pages of given PDF document to PNG images (up to `maxPages` pages).
+//
+// NOTE: `pdftoppm` (from poppler) is needed, and it is killed after `pdfRenderTimeoutSeconds`.
+func renderPDFPages(data []byte, maxPages int) (images [][]byte, err error) {
+	if _, err := exec.LookPath(pdfRendererCommand); err != nil {
+		return nil, fmt.Errorf("'%s' (from poppler) is needed for rendering PDF pages: %w", pdfRendererCommand, err)
+	}
+
+	dir, err := os.MkdirTemp("", "oll-pdf-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	input := filepath.Join(dir, "input.pdf")
+	if err := os.WriteFile(input, data, 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write temporary PDF file: %w", err)
+	}
+
+	args := []string{"-png", "-r", strconv.Itoa(pdfRenderDPI)}
+	if maxPages > 0 {
+		args = append(args, "-l", strconv.Itoa(maxPages))
+	}
+	args = append(args, input, filepath.Join(dir, "page"))
+
+	ctx, cancel := context.WithTimeout(
+		context.Background(),
+		pdfRenderTimeoutSeconds*time.Second,
+	)
+	defer cancel()
+
+	if out, err := exec.CommandContext(ctx, pdfRendererCommand, args...).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("failed to render PDF pages: %w (%s)", err, strings.TrimSpace(string(out)))
+	}
+
+	// NOTE: page numbers in filenames are zero-padded, so they can be sorted lexically
+	rendered, err := filepath.Glob(filepath.Join(dir, "page-*.png"))
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(rendered)
+	for _, path := range rendered {
+		image, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rendered page: %w", err)
+		}
+		images = append(images, image)
+	}
+
+	return images, nil
+}
@@ -0,0 +1,219 @@
+// pdf_test.go
+
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// buildTestPDF builds a PDF document with given objects (the first one should be the catalog).
+func buildTestPDF(objects []string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n")
+	for i, obj := range objects {
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\n%%%%EOF\n", len(objects)+1)
+	return buf.Bytes()
+}
+
+// testPDFStream returns a stream object with given data (compressed with FlateDecode).
+func testPDFStream(data string) string {
+	var compressed bytes.Buffer
+	w := zlib.NewWriter(&compressed)
+	_, _ = w.Write([]byte(data))
+	_ = w.Close()
+
+	return fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", compressed.Len(), compressed.String())
+}
+
+// test `pdfToText` and `formatPDFPages` for extracting texts of pages
+func TestPDFToText(t *testing.T) {
+	toUnicode := `/CIDInit /ProcSet findresource begin
+begincmap
+1 begincodespacerange <0000> <FFFF> endcodespacerange
+2 beginbfchar
+<0001> <C548>
+<0002> <B155>
+endbfchar
+1 beginbfrange
+<0003> <0004> <0041>
+endbfrange
+endcmap`
+
+	data := buildTestPDF([]string{
+		`<< /Type /Catalog /Pages 2 0 R >>`,
+		`<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 /Resources << /Font << /F1 5 0 R /F2 6 0 R >> >> >>`,
+		`<< /Type /Page /Parent 2 0 R /Contents 7 0 R >>`,
+		`<< /Type /Page /Parent 2 0 R /Contents [8 0 R] >>`,
+		`<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding << /Differences [128 /fi /uni00E9] >> >>`,
+		`<< /Type /Font /Subtype /Type0 /BaseFont /Test /Encoding /Identity-H /ToUnicode 9 0 R >>`,
+		testPDFStream(`BT /F1 12 Tf 72 720 Td (Hello, \(World\)!) Tj 0 -14 Td [(Sec)-50(ond) -300 (line \223quoted\224)] TJ 0 -14 Td (\200ne caf\201) Tj ET`),
+		testPDFStream(`BT /F2 12 Tf <00010002> Tj T* <00030004> Tj ET`),
+		testPDFStream(toUnicode),
+	})
+
+	pages, err := pdfToText(data)
+	if err != nil {
+		t.Fatalf("failed to extract texts from PDF: %s", err)
+	}
+	if len(pages) != 2 {
+		t.Fatalf("expected 2 pages, got %d", len(pages))
+	}
+	if expected := "Hello, (World)!\nSecond line “quoted”\nfine café"; pages[0] != expected {
+		t.Errorf("expected '%s', got '%s'", expected, pages[0])
+	}
+	if expected := "안녕\nAB"; pages[1] != expected {
+		t.Errorf("expected '%s', got '%s'", expected, pages[1])
+	}
+
+	formatted := formatPDFPages(pages)
+	if !strings.HasPrefix(formatted, "<page number=\"1\">\nHello") || !strings.HasSuffix(formatted, "<page number=\"2\">\n안녕\nAB\n</page>") {
+		t.Errorf("unexpected formatted pages: '%s'", formatted)
+	}
+
+	// not a PDF
+	if _, err := pdfToText([]byte("hello")); err == nil {
+		t.Errorf("expected an error for non-PDF data")
+	}
+
+	// encrypted PDF
+	encrypted := bytes.Replace(data, []byte("/Root 1 0 R"), []byte("/Root 1 0 R /Encrypt << /Filter /Standard >>"), 1)
+	if _, err := pdfToText(encrypted); err != errPDFEncrypted {
+		t.Errorf("expected an error for encrypted PDF, got %v", err)
+	}
+}
+
+// test `pdfLexer.parseObject` for parsing PDF objects
+func TestPDFParseObject(t *testing.T) {
+	l := &pdfLexer{data: []byte(`<< /Name /A#20B /Num -1.5 /Ref 12 0 R /Arr [1 (str\051) <414> true null] >>`)}
+	obj, err := l.parseObject()
+	if err != nil {
+		t.Fatalf("failed to parse object: %s", err)
+	}
+	dict, ok := obj.(pdfDict)
+	if !ok {
+		t.Fatalf("expected a dictionary, got %T", obj)
+	}
+	if dict["Name"] != pdfName("A B") {
+		t.Errorf("expected name 'A B', got %v", dict["Name"])
+	}
+	if dict["Num"] != -1.5 {
+		t.Errorf("expected -1.5, got %v", dict["Num"])
+	}
+	if dict["Ref"] != (pdfRef{num: 12, gen: 0}) {
+		t.Errorf("expected reference 12 0 R, got %v", dict["Ref"])
+	}
+	if arr, ok := dict["Arr"].([]any); !ok || len(arr) != 5 ||
+		string(arr[1].(pdfString)) != "str)" ||
+		string(arr[2].(pdfString)) != "A@" ||
+		arr[3] != true || arr[4] != nil {
+		t.Errorf("unexpected array: %v", dict["Arr"])
+	}
+}
+
+// malformed PDF documents (for testing that they are handled without panics)
+func malformedTestPDFs() map[string][]byte {
+	catalog := []string{
+		`<< /Type /Catalog /Pages 2 0 R >>`,
+		`<< /Type /Pages /Kids [3 0 R] /Count 1 >>`,
+		`<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>`,
+	}
+	objectStream := "1 -50 << /Type /Catalog >> 2 0 (x)"
+
+	return map[string][]byte{
+		"huge length": buildTestPDF(append(catalog,
+			"<< /Length 99999999999999999999999 >>\nstream\nBT (hello) Tj ET\nendstream",
+		)),
+		"negative length": buildTestPDF(append(catalog,
+			"<< /Length -10 >>\nstream\nBT (hello) Tj ET\nendstream",
+		)),
+		"negative offset in object stream": buildTestPDF(append(catalog,
+			fmt.Sprintf("<< /Type /ObjStm /N 2 /First 0 /Length %d >>\nstream\n%s\nendstream", len(objectStream), objectStream),
+		)),
+		"huge values in object stream": buildTestPDF(append(catalog,
+			fmt.Sprintf("<< /Type /ObjStm /N 1e30 /First 99999999999999999999999 /Length %d >>\nstream\n%s\nendstream", len(objectStream), objectStream),
+		)),
+		"huge columns of predictor": buildTestPDF(append(catalog,
+			strings.Replace(testPDFStream("BT (hello) Tj ET"), "/Filter /FlateDecode", "/Filter /FlateDecode /DecodeParms << /Predictor 12 /Columns 99999999999999999999 >>", 1),
+		)),
+		"deeply nested arrays": buildTestPDF(append(catalog,
+			strings.Repeat("[", 100000),
+		)),
+		"truncated":    buildTestPDF(catalog)[:60],
+		"unterminated": []byte("%PDF-1.7\n1 0 obj\n<< /Type /Catalog /Pages (unterminated <abc /Name#"),
+	}
+}
+
+// test `pdfToText` with malformed PDF documents
+func TestPDFToTextMalformed(t *testing.T) {
+	for name, data := range malformedTestPDFs() {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("[%s] panicked: %v", name, r)
+				}
+			}()
+			_, _ = pdfToText(data)
+		}()
+	}
+
+	// nested objects over the limit
+	l := &pdfLexer{data: []byte(strings.Repeat("[", maxPDFNestingDepth+1))}
+	if _, err := l.parseObject(); err == nil {
+		t.Errorf("expected an error for too deeply nested objects")
+	}
+
+	// positions out of range
+	l = &pdfLexer{data: []byte("<< /A 1 >>"), pos: -5}
+	if _, err := l.next(); err == nil {
+		t.Errorf("expected an error for a position out of range")
+	}
+
+	// streams inflated over the limit (decompression bombs)
+	var bomb bytes.Buffer
+	w := zlib.NewWriter(&bomb)
+	_, _ = w.Write(make([]byte, maxPDFStreamBytes+1))
+	_ = w.Close()
+	if _, err := inflatePDFData(bomb.Bytes()); err == nil {
+		t.Errorf("expected an error for a stream inflated over the limit")
+	}
+}
+
+// fuzz `pdfToText` for not panicking with broken PDF documents
+func FuzzPDFToText(f *testing.F) {
+	f.Add(buildTestPDF([]string{
+		`<< /Type /Catalog /Pages 2 0 R >>`,
+		`<< /Type /Pages /Kids [3 0 R] /Count 1 /Resources << /Font << /F1 5 0 R >> >> >>`,
+		`<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>`,
+		testPDFStream(`BT /F1 12 Tf 72 720 Td (Hello, World!) Tj ET`),
+		`<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>`,
+	}))
+	for _, data := range malformedTestPDFs() {
+		f.Add(data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, _ = pdfToText(data)
+	})
+}
+
+// test `pdfPagesCache` for returning cached pages without rendering them again
+func TestPDFPagesCache(t *testing.T) {
+	data := []byte("%PDF-1.7 not rendered")
+
+	cache := newPDFPagesCache()
+	rendered := &renderedPDFPages{done: make(chan struct{}), images: [][]byte{[]byte("page 1")}}
+	close(rendered.done)
+	cache.pages[sha256.Sum256(data)] = rendered
+
+	images, err := cache.render(data, maxRenderedPDFPages)
+	if err != nil || len(images) != 1 || string(images[0]) != "page 1" {
+		t.Errorf("expected cached pages, got %q (err: %v)", images, err)
+	}
+}
@@ -0,0 +1,112 @@
+// profile.go
+//
+// things for named profiles in config
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// profile struct
+//
+// (values of a profile override the top-level values of config, but not the parameters from command line)
+type profile struct {
+	Model                *string `json:"model,omitempty"`
+	ImageGenerationModel *string `json:"image_generation_model,omitempty"`
+
+	SystemInstruction *string  `json:"system_instruction,omitempty"`
+	Temperature       *float32 `json:"temperature,omitempty"`
+	TopP              *float32 `json:"top_p,omitempty"`
+	TopK              *int32   `json:"top_k,omitempty"`
+
+	ContextWindowSize *int `json:"context_window_size,omitempty"`
+
+	// MCP servers
+	MCPStreamableURLs []string `json:"mcp_streamable_urls,omitempty"`
+	MCPStdioCommands  []string `json:"mcp_stdio_commands,omitempty"`
+	MCPServers        []string `json:"mcp_servers,omitempty"` // names of MCP servers in config
+
+	// local tools and their callbacks
+	Tools                json.RawMessage   `json:"tools,omitempty"`
+	ToolCallbacks        map[string]string `json:"tool_callbacks,omitempty"`
+	ToolCallbacksConfirm map[string]bool   `json:"tool_callbacks_confirm,omitempty"`
+	LocalTools           []string          `json:"local_tools,omitempty"` // names of local tools in config
+}
+
+// applyProfile applies the profile with given name to params.
+//
+// Only the parameters which are not given from command line will be overridden,
+// and MCP servers and tool callbacks will be merged.
+//
+// (sampling parameters of the profile are not applied here, but in `generationOptionsFor`)
+func applyProfile(
+	conf config,
+	name string,
+	p *params,
+) error {
+	prof, exists := conf.Profiles[name]
+	if !exists {
+		if len(conf.Profiles) > 0 {
+			return fmt.Errorf(
+				"no such profile: '%s' (available: %s)",
+				name,
+				strings.Join(slices.Sorted(maps.Keys(conf.Profiles)), ", "),
+			)
+		}
+		return fmt.Errorf("no such profile: '%s' (no profiles in config)", name)
+	}
+
+	// model
+	if p.Model == nil {
+		if !p.Generation.Image.WithImages {
+			p.Model = prof.Model
+		} else {
+			p.Model = prof.ImageGenerationModel
+		}
+	}
+
+	// generation options
+	if p.Generation.DetailedOptions.SystemInstruction == nil {
+		p.Generation.DetailedOptions.SystemInstruction = prof.SystemInstruction
+	}
+	// (NOTE: sampling parameters are resolved with other options in `generationOptionsFor`)
+	if p.ContextWindowSize == nil {
+		p.ContextWindowSize = prof.ContextWindowSize
+	}
+
+	// MCP servers
+	p.MCPTools.StreamableURLs = uniq(append(p.MCPTools.StreamableURLs, prof.MCPStreamableURLs...))
+	p.MCPTools.StdioCommands = uniq(append(p.MCPTools.StdioCommands, prof.MCPStdioCommands...))
+	p.MCPTools.ConfiguredServers = uniq(append(p.MCPTools.ConfiguredServers, prof.MCPServers...))
+
+	// local tools and their callbacks
+	if p.LocalTools.Tools == nil && len(prof.Tools) > 0 {
+		p.LocalTools.Tools = ptr(string(prof.Tools))
+	}
+	p.LocalTools.ToolCallbacks = mergeMissing(p.LocalTools.ToolCallbacks, prof.ToolCallbacks)
+	p.LocalTools.ToolCallbacksConfirm = mergeMissing(p.LocalTools.ToolCallbacksConfirm, prof.ToolCallbacksConfirm)
+	p.LocalTools.ConfiguredTools = uniq(append(p.LocalTools.ConfiguredTools, prof.LocalTools...))
+
+	return nil
+}
+
+// mergeMissing merges values of `from` into `to`, only for the keys which do not exist in `to`.
+func mergeMissing[K comparable, V any](to, from map[K]V) map[K]V {
+	if len(from) <= 0 {
+		return to
+	}
+	if to == nil {
+		to = map[K]V{}
+	}
+	for k, v := range from {
+		if _, exists := to[k]; !exists {
+			to[k] = v
+		}
+	}
+	return to
+}
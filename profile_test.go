@@ -0,0 +1,127 @@
+// profile_test.go
+
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// test `applyProfile` (and `overrideWithConfig`) for the precedence of parameters, profile, and config
+func TestApplyProfile(t *testing.T) {
+	conf := config{
+		DefaultModel:         ptr("config-model"),
+		ImageGenerationModel: ptr("config-image-model"),
+		SystemInstruction:    ptr("config instruction"),
+		Profiles: map[string]profile{
+			"work": {
+				Model:                ptr("profile-model"),
+				ImageGenerationModel: ptr("profile-image-model"),
+				Temperature:          ptr(float32(0.2)),
+				TopK:                 ptr(int32(40)),
+				MCPStreamableURLs:    []string{"http://localhost:8080/mcp", "http://localhost:9090/mcp"},
+				MCPServers:           []string{"fs"},
+				Tools:                json.RawMessage(`[{"type":"function"}]`),
+				ToolCallbacks:        map[string]string{"fn_a": "/profile/a.sh", "fn_b": "/profile/b.sh"},
+				ToolCallbacksConfirm: map[string]bool{"fn_b": true},
+				LocalTools:           []string{"clock"},
+			},
+			"empty": {},
+		},
+	}
+
+	// parameters over profile, profile over config
+	var p params
+	p.Profile = ptr("work")
+	p.Generation.DetailedOptions.Temperature = ptr(float32(0.9))
+	p.MCPTools.StreamableURLs = []string{"http://localhost:8080/mcp"}
+	p.LocalTools.ToolCallbacks = map[string]string{"fn_a": "/flag/a.sh"}
+	if err := applyProfile(conf, "work", &p); err != nil {
+		t.Fatalf("failed to apply profile: %s", err)
+	}
+	overrideWithConfig(conf, &p)
+
+	if *p.Model != "profile-model" {
+		t.Errorf("expected the profile to take precedence over config, got '%s'", *p.Model)
+	}
+	if *p.Generation.DetailedOptions.SystemInstruction != "config instruction" {
+		t.Errorf("expected config to fill the system instruction missing in the profile, got '%s'", *p.Generation.DetailedOptions.SystemInstruction)
+	}
+	if options, err := generationOptionsFor(conf, p, *p.Model); err != nil || options["temperature"] != float32(0.9) || options["top_k"] != int32(40) {
+		t.Errorf("expected the parameter to take precedence over the profile, and top-k from the profile, got %v (err: %v)", options, err)
+	}
+
+	// pointer fields which are not in the profile (or sampling parameters, which are resolved later) should be left nil
+	if p.Generation.DetailedOptions.TopP != nil || p.Generation.DetailedOptions.TopK != nil || p.ContextWindowSize != nil {
+		t.Errorf("expected fields missing in the profile to be left nil")
+	}
+
+	// merged values
+	if expected := []string{"http://localhost:8080/mcp", "http://localhost:9090/mcp"}; !slices.Equal(p.MCPTools.StreamableURLs, expected) {
+		t.Errorf("expected %v, got %v", expected, p.MCPTools.StreamableURLs)
+	}
+	if !slices.Equal(p.MCPTools.ConfiguredServers, []string{"fs"}) || !slices.Equal(p.LocalTools.ConfiguredTools, []string{"clock"}) {
+		t.Errorf("unexpected configured servers and tools: %v, %v", p.MCPTools.ConfiguredServers, p.LocalTools.ConfiguredTools)
+	}
+	if p.LocalTools.Tools == nil || *p.LocalTools.Tools != `[{"type":"function"}]` {
+		t.Errorf("unexpected tools: %v", p.LocalTools.Tools)
+	}
+	if p.LocalTools.ToolCallbacks["fn_a"] != "/flag/a.sh" || p.LocalTools.ToolCallbacks["fn_b"] != "/profile/b.sh" {
+		t.Errorf("unexpected tool callbacks: %v", p.LocalTools.ToolCallbacks)
+	}
+	if !p.LocalTools.ToolCallbacksConfirm["fn_b"] {
+		t.Errorf("unexpected confirmations of tool callbacks: %v", p.LocalTools.ToolCallbacksConfirm)
+	}
+
+	// model for image generation
+	p = params{}
+	p.Generation.Image.WithImages = true
+	if err := applyProfile(conf, "work", &p); err != nil || *p.Model != "profile-image-model" {
+		t.Errorf("expected the model for image generation from the profile, got '%v' (err: %v)", p.Model, err)
+	}
+
+	// empty profile: everything is left nil, and config fills the rest
+	p = params{}
+	if err := applyProfile(conf, "empty", &p); err != nil {
+		t.Fatalf("failed to apply profile: %s", err)
+	}
+	if p.Model != nil ||
+		p.Generation.DetailedOptions.SystemInstruction != nil ||
+		p.Generation.DetailedOptions.Temperature != nil ||
+		p.Generation.DetailedOptions.TopK != nil ||
+		p.LocalTools.Tools != nil ||
+		p.LocalTools.ToolCallbacks != nil {
+		t.Errorf("expected parameters to be left nil with an empty profile, got %+v", p)
+	}
+	overrideWithConfig(conf, &p)
+	if *p.Model != "config-model" {
+		t.Errorf("expected the model from config, got '%s'", *p.Model)
+	}
+
+	// unknown profile
+	if err := applyProfile(conf, "unknown", &params{}); err == nil || !strings.Contains(err.Error(), "available: empty, work") {
+		t.Errorf("expected an error with available profiles, got %v", err)
+	}
+	if err := applyProfile(config{}, "unknown", &params{}); err == nil || !strings.Contains(err.Error(), "no profiles") {
+		t.Errorf("expected an error without profiles, got %v", err)
+	}
+}
+
+// test `mergeMissing`
+func TestMergeMissing(t *testing.T) {
+	if merged := mergeMissing(nil, map[string]int{"a": 1}); !maps.Equal(merged, map[string]int{"a": 1}) {
+		t.Errorf("unexpected merge into nil: %v", merged)
+	}
+	if merged := mergeMissing(map[string]int{"a": 1}, nil); !maps.Equal(merged, map[string]int{"a": 1}) {
+		t.Errorf("unexpected merge from nil: %v", merged)
+	}
+	if merged := mergeMissing[string, int](nil, nil); merged != nil {
+		t.Errorf("expected nil, got %v", merged)
+	}
+	if merged := mergeMissing(map[string]int{"a": 1, "b": 2}, map[string]int{"b": 20, "c": 30}); !maps.Equal(merged, map[string]int{"a": 1, "b": 2, "c": 30}) {
+		t.Errorf("expected existing values to be kept, got %v", merged)
+	}
+}
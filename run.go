@@ -5,6 +5,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"time"
@@ -51,6 +52,24 @@ func run(
 		return output.printHelpBeforeExit(1, parser), nil
 	}
 
+	// check if the output format is supported for the requested task
+	if output.format == outputFormatNDJSON &&
+		(!(p.hasPrompt() || p.Chat) || p.Embeddings.GenerateEmbeddings || p.Generation.Image.WithImages) {
+		return 1, fmt.Errorf("output format '%s' is only supported for text generation", output.format)
+	}
+	if output.format == outputFormatJSON &&
+		(!(p.hasPrompt() || p.ListModels) || p.Chat) {
+		return 1, fmt.Errorf("output format '%s' is only supported for single-shot generations and listing models", output.format)
+	}
+	if p.Compare.Models != nil {
+		if !p.hasPrompt() || p.Chat || p.Embeddings.GenerateEmbeddings || p.Generation.Image.WithImages {
+			return 1, fmt.Errorf("comparison of models is only supported for single-shot text generations")
+		}
+		if output.machineReadable() {
+			return 1, fmt.Errorf("output format '%s' is not supported for comparison of models (use --compare-report instead)", output.format)
+		}
+	}
+
 	// early return after printing the version
 	if p.ShowVersion {
 		output.printColored(
@@ -63,27 +82,32 @@ func run(
 		return output.printHelpBeforeExit(0, parser), nil
 	}
 
-	// read and apply configs
+	// read configs
 	var conf config
-	if conf, err = readConfig(resolveConfigFilepath(p.ConfigFilepath)); err == nil {
-		if p.Generation.DetailedOptions.SystemInstruction == nil && conf.SystemInstruction != nil {
-			p.Generation.DetailedOptions.SystemInstruction = conf.SystemInstruction
-		}
-	} else {
+	if conf, err = readConfig(resolveConfigFilepath(p.ConfigFilepath)); err != nil {
 		return 1, fmt.Errorf("failed to read configuration: %w", err)
 	}
 
-	// override parameters with config if parameters are not given
-	if !p.Generation.Image.WithImages {
-		if conf.DefaultModel != nil && p.Model == nil {
-			p.Model = conf.DefaultModel
-		}
-	} else {
-		if conf.ImageGenerationModel != nil && p.Model == nil {
-			p.Model = conf.ImageGenerationModel
+	// resume a saved session and apply the profile, if parameters are not given
+	sess, err := resumeSessionAndApplyProfile(output, conf, &p)
+	if err != nil {
+		return 1, err
+	}
+
+	// render generated markdown contents in terminal
+	if (p.RenderMarkdown || conf.RenderMarkdown) && (p.hasPrompt() || p.Chat) {
+		if !output.enableMarkdownRendering() {
+			output.verbose(
+				verboseMedium,
+				p.Verbose,
+				"markdown rendering is not available, falling back to plain texts",
+			)
 		}
 	}
 
+	// override parameters with config if parameters are not given
+	overrideWithConfig(conf, &p)
+
 	// set default values if parameters are still missing
 	if p.Model == nil {
 		if !p.Generation.Image.WithImages {
@@ -94,18 +118,30 @@ func run(
 	}
 	if p.Generation.DetailedOptions.SystemInstruction == nil {
 		p.Generation.DetailedOptions.SystemInstruction = ptr(defaultSystemInstruction(p))
+		p.Generation.DetailedOptions.SystemInstructionIsDefault = true
 	}
 	if p.UserAgent == nil {
 		p.UserAgent = ptr(defaultUserAgent)
 	}
 
+	// limits of attached files
+	fileOpts, err := fileOptionsFrom(conf, p)
+	if err != nil {
+		return 1, err
+	}
+
 	// expand filepaths (recurse directories)
-	p.Generation.Filepaths, err = expandFilepaths(output, p)
+	p.Generation.Filepaths, err = expandFilepaths(output, p, fileOpts)
 	if err != nil {
 		return 1, fmt.Errorf("failed to read given filepaths: %w", err)
 	}
 
-	if p.hasPrompt() { // if prompt is given,
+	// early return after printing files to be attached
+	if p.Generation.Files.DryRunFiles {
+		return doDryRunFiles(output, p.Generation.Filepaths, fileOpts)
+	}
+
+	if p.hasPrompt() || p.Chat { // if prompt is given, or chat is requested,
 		if p.Embeddings.GenerateEmbeddings {
 			output.verbose(
 				verboseMaximum,
@@ -115,6 +151,15 @@ func run(
 			)
 
 			return doEmbeddingsGeneration(context.TODO(), output, conf, p)
+		} else if p.Compare.Models != nil {
+			output.verbose(
+				verboseMaximum,
+				p.Verbose,
+				"comparison request params with prompt: %s\n\n",
+				prettify(p),
+			)
+
+			return doCompare(context.TODO(), output, conf, p)
 		} else {
 			output.verbose(
 				verboseMaximum,
@@ -134,8 +179,18 @@ func run(
 					}
 				}
 			}
+			// (declared in config)
+			if configuredTools, err := localToolsFromConfig(conf, p.LocalTools.ConfiguredTools, &p); err == nil {
+				localTools = append(localTools, configuredTools...)
+			} else {
+				return 1, err
+			}
 
 			// tools (MCP)
+			// (declared in config)
+			if err := applyMCPServersFromConfig(conf, p.MCPTools.ConfiguredServers, &p); err != nil {
+				return 1, err
+			}
 			var allMCPTools mcpConnectionsAndTools = nil // key: streamable http url, value: tools
 			for _, serverURL := range p.MCPTools.StreamableURLs {
 				output.verbose(
@@ -147,7 +202,7 @@ func run(
 
 				// connect,
 				var mc *mcp.ClientSession
-				if mc, err = mcpConnect(context.TODO(), serverURL); err == nil {
+				if mc, err = mcpConnect(context.TODO(), serverURL, p.MCPTools.Headers[serverURL]); err == nil {
 					// fetch tools,
 					var fetchedTools []*mcp.Tool
 					if fetchedTools, err = fetchMCPTools(
@@ -201,7 +256,7 @@ func run(
 
 				// connect,
 				var mc *mcp.ClientSession
-				if mc, err = mcpRun(context.TODO(), cmd); err == nil {
+				if mc, err = mcpRun(context.TODO(), cmd, p.MCPTools.Envs[cmd]); err == nil {
 					// fetch tools,
 					var fetchedTools []*mcp.Tool
 					if fetchedTools, err = fetchMCPTools(
@@ -289,49 +344,223 @@ func run(
 				}
 			}()
 
-			if !p.Generation.Image.WithImages {
-				return doGeneration(
+			if p.Chat {
+				if p.Generation.Image.WithImages {
+					return 1, fmt.Errorf("image generation is not supported in chat mode")
+				}
+				if p.OutputFile != nil || p.ThinkingFile != nil || p.ExtractCodeToDir != nil {
+					return 1, fmt.Errorf("writing outputs to files is not supported in chat mode")
+				}
+
+				return doChat(
+					context.TODO(),
+					output,
+					conf,
+					p,
+					sess,
+					localTools,
+					allMCPTools,
+				)
+			} else if !p.Generation.Image.WithImages {
+				var history []api.Message = nil
+				if sess != nil {
+					history = sess.history()
+				}
+
+				options, err := generationOptionsFor(conf, p, *p.Model)
+				if err != nil {
+					return 1, err
+				}
+				keepAlive, err := resolveKeepAlive(conf, p)
+				if err != nil {
+					return 1, err
+				}
+
+				exit, conversation, err := doGeneration(
 					context.TODO(),
 					output,
 					conf,
 					*p.Model,
 					*p.Generation.DetailedOptions.SystemInstruction,
-					p.Generation.DetailedOptions.Temperature,
-					p.Generation.DetailedOptions.TopP,
-					p.Generation.DetailedOptions.TopK,
 					p.Generation.DetailedOptions.Stop,
+					options,
+					keepAlive,
 					p.Generation.OutputJSONScheme,
 					p.Generation.Thinking.WithThinking,
 					p.Generation.Thinking.HideReasoning,
 					p.ContextWindowSize,
+					p.ContextOverflow,
 					*p.Generation.Prompt,
 					p.Generation.Filepaths,
+					fileOpts,
+					history,
 					p.Tools.ShowCallbackResults,
 					p.Tools.RecurseOnCallbackResults,
 					p.Tools.ForceCallDestructiveTools,
+					toolCallWorkersFrom(conf, p),
 					localTools,
 					p.LocalTools.ToolCallbacks,
 					p.LocalTools.ToolCallbacksConfirm,
 					allMCPTools,
+					newAgentLoop(agentLoopLimitsFrom(conf, p)),
 					nil,
 					p.UserAgent,
 					p.ReplaceHTTPURLsInPrompt,
 					p.Verbose,
 				)
+
+				// save the session (NOTE: conversation can be returned with an error, eg. when stopped by limits of agent loop)
+				if sess != nil && len(conversation) > 0 {
+					if saveErr := updateSession(sess, *p.Model, conversation); saveErr != nil {
+						return 1, errors.Join(err, saveErr)
+					}
+
+					output.verbose(
+						verboseMedium,
+						p.Verbose,
+						"saved session '%s' with %d message(s)",
+						sess.Name,
+						len(sess.Messages),
+					)
+				}
+
+				// write outputs to files
+				if err == nil {
+					if err := writeOutputFiles(
+						output,
+						conversation,
+						p.OutputFile,
+						p.ThinkingFile,
+						p.Verbose,
+					); err != nil {
+						return 1, err
+					}
+
+					// extract code blocks to files
+					if p.ExtractCodeToDir != nil {
+						extracted, err := extractCodeBlocks(
+							output,
+							finalContentOf(generatedMessages(conversation)),
+							*p.ExtractCodeToDir,
+							p.OverwriteCode,
+							p.Verbose,
+						)
+						output.result.CodeBlocks = extracted
+						printCodeBlocksManifest(output, extracted)
+						if err != nil {
+							return 1, err
+						}
+					}
+				}
+
+				return exit, err
 			} else {
+				keepAlive, err := resolveKeepAlive(conf, p)
+				if err != nil {
+					return 1, err
+				}
+
 				return doImageGeneration(
 					context.TODO(),
 					output,
 					conf,
 					*p.Model,
 					*p.Generation.Prompt, p.Generation.Image.NegativePrompt, p.Generation.Filepaths,
+					fileOpts,
 					p.Generation.Image.Width, p.Generation.Image.Height,
 					p.Generation.Image.Seed,
 					p.Generation.Image.SaveImagesToDir, p.Generation.Image.DisplayImagesInTerminal,
+					keepAlive,
 					p.Verbose,
 				)
 			}
 		}
+	} else if p.Sessions.ListSessions {
+		return doListSessions(
+			context.TODO(),
+			output,
+			p,
+		)
+	} else if p.Sessions.ShowSession != nil {
+		return doShowSession(
+			context.TODO(),
+			output,
+			p,
+		)
+	} else if p.Sessions.ForkSession != nil {
+		return doForkSession(
+			context.TODO(),
+			output,
+			p,
+		)
+	} else if p.Sessions.DeleteSession != nil {
+		return doDeleteSession(
+			context.TODO(),
+			output,
+			p,
+		)
+	} else if p.Batch.Filepath != nil {
+		return doBatch(
+			context.TODO(),
+			output,
+			conf,
+			p,
+		)
+	} else if p.Benchmark.Benchmark {
+		return doBenchmark(
+			context.TODO(),
+			output,
+			conf,
+			p,
+		)
+	} else if p.Models.Pull != nil {
+		return doPullModel(
+			context.TODO(),
+			output,
+			p,
+		)
+	} else if p.Models.Delete != nil {
+		return doDeleteModel(
+			context.TODO(),
+			output,
+			conf,
+			p,
+		)
+	} else if p.Models.Copy != nil {
+		return doCopyModel(
+			context.TODO(),
+			output,
+			conf,
+			p,
+		)
+	} else if p.Models.Show != nil {
+		return doShowModel(
+			context.TODO(),
+			output,
+			conf,
+			p,
+		)
+	} else if p.Models.ListRunning {
+		return doListRunningModels(
+			context.TODO(),
+			output,
+			conf,
+			p,
+		)
+	} else if p.PreloadModel != nil {
+		return doPreloadModel(
+			context.TODO(),
+			output,
+			conf,
+			p,
+		)
+	} else if p.UnloadModel != nil {
+		return doUnloadModel(
+			context.TODO(),
+			output,
+			conf,
+			p,
+		)
 	} else if p.ListModels {
 		return doListModels(
 			context.TODO(),
@@ -355,6 +584,83 @@ func run(
 	// should not reach here
 }
 
+// resumeSessionAndApplyProfile resumes a saved session and applies the profile to params.
+//
+// Parameters from command line take precedence over the resumed session,
+// and the session takes precedence over the profile.
+//
+// Sessions are not supported for comparison of models, embeddings, and image generations.
+func resumeSessionAndApplyProfile(
+	output *outputWriter,
+	conf config,
+	p *params,
+) (sess *session, err error) {
+	if p.Sessions.Session != nil &&
+		(p.Compare.Models != nil || p.Embeddings.GenerateEmbeddings || p.Generation.Image.WithImages) {
+		return nil, fmt.Errorf("session '%s' cannot be used for comparison of models, embeddings, or image generations (only for text generations and chat)", *p.Sessions.Session)
+	}
+
+	// resume a saved session, and override parameters with it if parameters are not given
+	if p.Sessions.Session != nil && (p.hasPrompt() || p.Chat) {
+		if s, exists, err := loadSession(*p.Sessions.Session); err == nil {
+			if exists {
+				output.verbose(
+					verboseMedium,
+					p.Verbose,
+					"resuming session '%s' with %d message(s)",
+					s.Name,
+					len(s.Messages),
+				)
+
+				if p.Model == nil && len(s.Model) > 0 {
+					p.Model = ptr(s.Model)
+				}
+				if p.Generation.DetailedOptions.SystemInstruction == nil {
+					p.Generation.DetailedOptions.SystemInstruction = s.systemInstruction()
+				}
+			}
+			sess = &s
+		} else {
+			return nil, fmt.Errorf("failed to resume session: %w", err)
+		}
+	}
+
+	// override parameters with the profile if parameters are not given
+	if p.Profile != nil {
+		if err := applyProfile(conf, *p.Profile, p); err != nil {
+			return nil, err
+		}
+
+		output.verbose(
+			verboseMedium,
+			p.Verbose,
+			"applied profile '%s'",
+			*p.Profile,
+		)
+	}
+
+	return sess, nil
+}
+
+// overrideWithConfig overrides params with config, only for the parameters which are not given.
+func overrideWithConfig(
+	conf config,
+	p *params,
+) {
+	if p.Generation.DetailedOptions.SystemInstruction == nil && conf.SystemInstruction != nil {
+		p.Generation.DetailedOptions.SystemInstruction = conf.SystemInstruction
+	}
+	if !p.Generation.Image.WithImages {
+		if conf.DefaultModel != nil && p.Model == nil {
+			p.Model = conf.DefaultModel
+		}
+	} else {
+		if conf.ImageGenerationModel != nil && p.Model == nil {
+			p.Model = conf.ImageGenerationModel
+		}
+	}
+}
+
 // defaultSystemInstruction generates a default system instruction with given params.
 func defaultSystemInstruction(p params) string {
 	datetime := time.Now().Format("2006-01-02 15:04:05 MST (Mon)")
@@ -368,3 +674,14 @@ func defaultSystemInstruction(p params) string {
 		hostname,
 	)
 }
+
+// systemInstructionFor returns the system instruction of params for given model.
+//
+// (the default one is generated again for the model, as it contains the name of model)
+func systemInstructionFor(p params, model string) string {
+	if p.Generation.DetailedOptions.SystemInstruction == nil ||
+		p.Generation.DetailedOptions.SystemInstructionIsDefault {
+		return defaultSystemInstruction(paramsWithModel(p, model))
+	}
+	return *p.Generation.DetailedOptions.SystemInstruction
+}
@@ -11,6 +11,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"maps"
 	"math/rand/v2"
 	"net/http"
 	"net/url"
@@ -199,6 +200,11 @@ func buildSelfServer(
 						Description: `Seed for image generation. Ignored unless 'modality' is 'image'.`,
 						Type:        "integer",
 					},
+					"options": {
+						Title:       "options",
+						Description: `Ollama options for generation (eg. {"seed": 42, "num_predict": 256, "repeat_penalty": 1.1, "min_p": 0.05}). Ignored unless 'modality' is 'text'.`,
+						Type:        "object",
+					},
 				},
 				Required: []string{"prompt", "modality"},
 			},
@@ -987,15 +993,17 @@ func selfGenerateText(
 	}
 
 	// system instruction
-	systemInstruction := defaultSystemInstruction(paramsWithModel(p, model))
-	if p.Generation.DetailedOptions.SystemInstruction != nil {
-		systemInstruction = *p.Generation.DetailedOptions.SystemInstruction
-	} else if conf.SystemInstruction != nil {
+	systemInstruction := systemInstructionFor(p, model)
+	if p.Generation.DetailedOptions.SystemInstruction == nil && conf.SystemInstruction != nil {
 		systemInstruction = *conf.SystemInstruction
 	}
 
 	// convert prompt + files
-	prompt, mediaFiles, err := convertPromptAndFiles(prompt, filesInPrompt, filepaths)
+	fileOpts, err := fileOptionsFrom(conf, p)
+	if err != nil {
+		return mcpErrorResult("Failed to resolve options of files: %s", err)
+	}
+	prompt, mediaFiles, err := convertPromptAndFiles(output, prompt, filesInPrompt, filepaths, fileOpts, p.Verbose)
 	if err != nil {
 		return mcpErrorResult("Failed to convert prompt and files: %s", err)
 	}
@@ -1004,6 +1012,19 @@ func selfGenerateText(
 		media = append(media, api.ImageData(mf))
 	}
 
+	// options (config and params, then arguments)
+	options, err := generationOptionsFor(conf, p, model)
+	if err != nil {
+		return mcpErrorResult("Failed to get options: %s", err)
+	}
+	if opts, _ := funcArg[map[string]any](args, "options"); opts != nil {
+		converted, err := convertOptions(*opts)
+		if err != nil {
+			return mcpErrorResult("Failed to convert argument 'options': %s", err)
+		}
+		maps.Copy(options, converted)
+	}
+
 	req := &api.ChatRequest{
 		Model: model,
 		Messages: []api.Message{
@@ -1017,6 +1038,10 @@ func selfGenerateText(
 		},
 		Think: &api.ThinkValue{Value: thinkVal},
 	}
+	maps.Copy(req.Options, options)
+	if req.KeepAlive, err = resolveKeepAlive(conf, p); err != nil {
+		return mcpErrorResult("Failed to get keep-alive: %s", err)
+	}
 
 	var sb strings.Builder
 	if err := client.Chat(ctx, req, func(resp api.ChatResponse) error {
@@ -1069,7 +1094,11 @@ func selfGenerateImage(
 	}
 
 	// convert prompt + files
-	prompt, mediaFiles, err := convertPromptAndFiles(prompt, nil, filepaths)
+	fileOpts, err := fileOptionsFrom(conf, p)
+	if err != nil {
+		return mcpErrorResult("Failed to resolve options of files: %s", err)
+	}
+	prompt, mediaFiles, err := convertPromptAndFiles(output, prompt, nil, filepaths, fileOpts, p.Verbose)
 	if err != nil {
 		return mcpErrorResult("Failed to convert prompt and files: %s", err)
 	}
@@ -0,0 +1,366 @@
+// session.go
+//
+// things for saving and resuming sessions (history of conversation)
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/fatih/color"
+	"github.com/ollama/ollama/api"
+)
+
+const (
+	sessionsDirname      = "sessions"
+	sessionFileExtension = ".json"
+
+	sessionNameRegexp = `^[a-zA-Z0-9][a-zA-Z0-9._-]*$`
+)
+
+// session struct
+type session struct {
+	Name      string    `json:"name"`
+	Model     string    `json:"model,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Messages []api.Message `json:"messages"` // NOTE: includes the system instruction
+}
+
+// systemInstruction returns the system instruction of the session, if any.
+func (s session) systemInstruction() *string {
+	if len(s.Messages) > 0 && s.Messages[0].Role == "system" {
+		return ptr(s.Messages[0].Content)
+	}
+	return nil
+}
+
+// history returns the messages of the session without the system instruction.
+func (s session) history() []api.Message {
+	if len(s.Messages) > 0 && s.Messages[0].Role == "system" {
+		return s.Messages[1:]
+	}
+	return s.Messages
+}
+
+// resolveSessionsDirpath resolves the directory path of sessions.
+func resolveSessionsDirpath() string {
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome != "" {
+		return filepath.Join(stateHome, appName, sessionsDirname)
+	}
+
+	return filepath.Join(os.Getenv("HOME"), ".local", "state", appName, sessionsDirname)
+}
+
+// sessionFilepath returns the filepath of the session with given name.
+func sessionFilepath(name string) (string, error) {
+	if !regexp.MustCompile(sessionNameRegexp).MatchString(name) {
+		return "", fmt.Errorf("invalid session name: '%s' (should match `%s`)", name, sessionNameRegexp)
+	}
+
+	return filepath.Join(resolveSessionsDirpath(), name+sessionFileExtension), nil
+}
+
+// loadSession loads a session with given name.
+//
+// If there is no such session, `exists` will be false with no error.
+func loadSession(name string) (s session, exists bool, err error) {
+	var fpath string
+	if fpath, err = sessionFilepath(name); err != nil {
+		return s, false, err
+	}
+
+	var bytes []byte
+	if bytes, err = os.ReadFile(fpath); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return session{Name: name}, false, nil
+		}
+		return s, false, fmt.Errorf("failed to read session '%s': %w", name, err)
+	}
+	if err = json.Unmarshal(bytes, &s); err != nil {
+		return s, false, fmt.Errorf("failed to parse session '%s': %w", name, err)
+	}
+	s.Name = name
+
+	return s, true, nil
+}
+
+// saveSession saves given session to its file.
+func saveSession(s session) (err error) {
+	var fpath string
+	if fpath, err = sessionFilepath(s.Name); err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(fpath), 0o700); err != nil {
+		return fmt.Errorf("failed to create directory for sessions: %w", err)
+	}
+
+	now := time.Now()
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt = now
+	}
+	s.UpdatedAt = now
+
+	var marshalled []byte
+	if marshalled, err = json.MarshalIndent(s, "", "  "); err != nil {
+		return fmt.Errorf("failed to marshal session '%s': %w", s.Name, err)
+	}
+
+	// NOTE: write to a temporary file first, for not breaking the existing one
+	tmp := fpath + ".tmp"
+	if err = os.WriteFile(tmp, marshalled, 0o600); err != nil {
+		return fmt.Errorf("failed to write session '%s': %w", s.Name, err)
+	}
+	if err = os.Rename(tmp, fpath); err != nil {
+		return fmt.Errorf("failed to save session '%s': %w", s.Name, err)
+	}
+
+	return nil
+}
+
+// updateSession updates given session with the model and messages of conversation, and saves it.
+func updateSession(
+	s *session,
+	model string,
+	conversation []api.Message,
+) error {
+	s.Model = model
+	s.Messages = conversation
+
+	return saveSession(*s)
+}
+
+// listSessions lists all saved sessions (sorted by the time of last update, latest first).
+func listSessions() (sessions []session, err error) {
+	var entries []os.DirEntry
+	if entries, err = os.ReadDir(resolveSessionsDirpath()); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read directory of sessions: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name, isSession := strings.CutSuffix(entry.Name(), sessionFileExtension)
+		if !isSession {
+			continue
+		}
+
+		if s, exists, err := loadSession(name); err == nil && exists {
+			sessions = append(sessions, s)
+		}
+	}
+
+	slices.SortFunc(sessions, func(a, b session) int {
+		return b.UpdatedAt.Compare(a.UpdatedAt)
+	})
+
+	return sessions, nil
+}
+
+// doListSessions lists saved sessions.
+func doListSessions(
+	ctx context.Context,
+	output *outputWriter,
+	p params,
+) (exit int, e error) {
+	output.verbose(
+		verboseMedium,
+		p.Verbose,
+		"listing sessions in '%s'...",
+		resolveSessionsDirpath(),
+	)
+
+	sessions, err := listSessions()
+	if err != nil {
+		return 1, err
+	}
+
+	if len(sessions) > 0 {
+		// print headers
+		output.printColored(
+			color.FgWhite,
+			"%24s\t%24s\t%s\t%s\n----\n",
+			"name",
+			"model",
+			"messages",
+			"updated",
+		)
+
+		for _, s := range sessions {
+			output.printColored(
+				color.FgHiWhite,
+				"%24s\t%24s\t%d\t%s\n",
+				s.Name,
+				s.Model,
+				len(s.Messages),
+				humanize.Time(s.UpdatedAt),
+			)
+		}
+	} else {
+		output.printColored(
+			color.FgHiRed,
+			"no sessions were found.\n",
+		)
+	}
+
+	return 0, nil
+}
+
+// doShowSession shows messages of a saved session.
+func doShowSession(
+	ctx context.Context,
+	output *outputWriter,
+	p params,
+) (exit int, e error) {
+	name := *p.Sessions.ShowSession
+
+	s, exists, err := loadSession(name)
+	if err != nil {
+		return 1, err
+	}
+	if !exists {
+		return 1, fmt.Errorf("no such session: '%s'", name)
+	}
+
+	output.printColored(
+		color.FgGreen,
+		"Session '%s' (model: %s, created: %s, updated: %s)\n\n",
+		s.Name,
+		s.Model,
+		s.CreatedAt.Format(time.RFC3339),
+		s.UpdatedAt.Format(time.RFC3339),
+	)
+
+	for _, message := range s.Messages {
+		printMessage(output, message)
+	}
+
+	return 0, nil
+}
+
+// printMessage prints given message with its role.
+func printMessage(
+	output *outputWriter,
+	message api.Message,
+) {
+	roleColor := color.FgHiWhite
+	switch message.Role {
+	case "system":
+		roleColor = color.FgMagenta
+	case "user":
+		roleColor = color.FgHiBlue
+	case "assistant":
+		roleColor = color.FgGreen
+	case "tool":
+		roleColor = color.FgHiCyan
+	}
+
+	if len(message.ToolName) > 0 {
+		output.printColored(roleColor, "[%s: %s]\n", message.Role, message.ToolName)
+	} else {
+		output.printColored(roleColor, "[%s]\n", message.Role)
+	}
+	if len(message.Thinking) > 0 {
+		output.printColored(color.FgHiGreen, "%s\n%s\n%s\n", thinkingTagBegin, strings.TrimSpace(message.Thinking), thinkingTagEnd)
+	}
+	if len(message.Content) > 0 {
+		output.printColored(color.FgHiWhite, "%s\n", strings.TrimSpace(message.Content))
+	}
+	for _, call := range message.ToolCalls {
+		output.printColored(
+			color.FgHiCyan,
+			"(tool call) %s(%s)\n",
+			call.Function.Name,
+			prettify(call.Function.Arguments, true),
+		)
+	}
+	if len(message.Images) > 0 {
+		output.printColored(color.FgHiWhite, "(%d attached media file(s))\n", len(message.Images))
+	}
+	output.println()
+}
+
+// doForkSession copies a saved session to a new one.
+func doForkSession(
+	ctx context.Context,
+	output *outputWriter,
+	p params,
+) (exit int, e error) {
+	if p.Sessions.Session == nil {
+		return 1, fmt.Errorf("the session to fork from should be given with --session")
+	}
+	from, to := *p.Sessions.Session, *p.Sessions.ForkSession
+
+	s, exists, err := loadSession(from)
+	if err != nil {
+		return 1, err
+	}
+	if !exists {
+		return 1, fmt.Errorf("no such session: '%s'", from)
+	}
+	if _, exists, err := loadSession(to); err != nil {
+		return 1, err
+	} else if exists {
+		return 1, fmt.Errorf("session '%s' already exists", to)
+	}
+
+	s.Name = to
+	s.CreatedAt = time.Time{}
+	if err := saveSession(s); err != nil {
+		return 1, err
+	}
+
+	output.printColored(
+		color.FgGreen,
+		"Forked session '%s' to '%s'.\n",
+		from,
+		to,
+	)
+
+	return 0, nil
+}
+
+// doDeleteSession deletes a saved session.
+func doDeleteSession(
+	ctx context.Context,
+	output *outputWriter,
+	p params,
+) (exit int, e error) {
+	name := *p.Sessions.DeleteSession
+
+	fpath, err := sessionFilepath(name)
+	if err != nil {
+		return 1, err
+	}
+	if err := os.Remove(fpath); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return 1, fmt.Errorf("no such session: '%s'", name)
+		}
+		return 1, fmt.Errorf("failed to delete session '%s': %w", name, err)
+	}
+
+	output.printColored(
+		color.FgGreen,
+		"Deleted session '%s'.\n",
+		name,
+	)
+
+	return 0, nil
+}
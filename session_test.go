@@ -0,0 +1,291 @@
+// session_test.go
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// test `saveSession`, `loadSession`, and `updateSession`
+func TestSaveAndLoadSession(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	if _, exists, err := loadSession("new"); err != nil || exists {
+		t.Fatalf("expected a non-existing session without error, got exists: %v, err: %v", exists, err)
+	}
+
+	s := session{Name: "new"}
+	if err := updateSession(&s, "model-a", []api.Message{
+		{Role: "system", Content: "be helpful"},
+		{Role: "user", Content: "hello"},
+		{Role: "assistant", Content: "hi"},
+	}); err != nil {
+		t.Fatalf("failed to save session: %s", err)
+	}
+
+	loaded, exists, err := loadSession("new")
+	if err != nil || !exists {
+		t.Fatalf("expected the saved session, got exists: %v, err: %v", exists, err)
+	}
+	if loaded.Name != "new" || loaded.Model != "model-a" || len(loaded.Messages) != 3 {
+		t.Errorf("unexpected session: %+v", loaded)
+	}
+	if loaded.CreatedAt.IsZero() || loaded.UpdatedAt.Before(loaded.CreatedAt) {
+		t.Errorf("unexpected times: created at %s, updated at %s", loaded.CreatedAt, loaded.UpdatedAt)
+	}
+	if instruction := loaded.systemInstruction(); instruction == nil || *instruction != "be helpful" {
+		t.Errorf("unexpected system instruction: %v", instruction)
+	}
+	if history := loaded.history(); len(history) != 2 || history[0].Content != "hello" {
+		t.Errorf("unexpected history: %+v", history)
+	}
+
+	// the time of creation should be kept
+	createdAt := loaded.CreatedAt
+	if err := updateSession(&loaded, "model-b", append(loaded.Messages, api.Message{Role: "user", Content: "bye"})); err != nil {
+		t.Fatalf("failed to update session: %s", err)
+	}
+	if reloaded, _, _ := loadSession("new"); !reloaded.CreatedAt.Equal(createdAt) || reloaded.Model != "model-b" || len(reloaded.Messages) != 4 {
+		t.Errorf("unexpected updated session: %+v", reloaded)
+	}
+
+	// session without a system instruction
+	if instruction := (session{Messages: []api.Message{{Role: "user", Content: "hello"}}}).systemInstruction(); instruction != nil {
+		t.Errorf("expected no system instruction, got '%s'", *instruction)
+	}
+}
+
+// test `sessionFilepath` for invalid names
+func TestSessionFilepath(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", "/state")
+
+	if fpath, err := sessionFilepath("my-session_1.0"); err != nil || fpath != filepath.Join("/state", appName, sessionsDirname, "my-session_1.0"+sessionFileExtension) {
+		t.Errorf("unexpected filepath: '%s' (err: %v)", fpath, err)
+	}
+
+	for _, name := range []string{
+		"",
+		".hidden",
+		"..",
+		"../escaped",
+		"a/b",
+		`a\b`,
+		"with space",
+	} {
+		if _, err := sessionFilepath(name); err == nil {
+			t.Errorf("expected an error for session name '%s'", name)
+		}
+		if _, _, err := loadSession(name); err == nil {
+			t.Errorf("expected an error for loading session '%s'", name)
+		}
+		if err := saveSession(session{Name: name}); err == nil {
+			t.Errorf("expected an error for saving session '%s'", name)
+		}
+	}
+}
+
+// test `listSessions`
+func TestListSessions(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	if sessions, err := listSessions(); err != nil || len(sessions) != 0 {
+		t.Errorf("expected no sessions without error, got %d session(s) (err: %v)", len(sessions), err)
+	}
+
+	for _, name := range []string{"first", "second", "third"} {
+		if err := saveSession(session{Name: name}); err != nil {
+			t.Fatalf("failed to save session: %s", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// files which are not sessions should be skipped
+	dir := resolveSessionsDirpath()
+	_ = os.WriteFile(filepath.Join(dir, "note.txt"), []byte("not a session"), 0o600)
+	_ = os.WriteFile(filepath.Join(dir, "broken"+sessionFileExtension), []byte("{"), 0o600)
+	_ = os.Mkdir(filepath.Join(dir, "dir"+sessionFileExtension), 0o700)
+
+	sessions, err := listSessions()
+	if err != nil {
+		t.Fatalf("failed to list sessions: %s", err)
+	}
+	names := []string{}
+	for _, s := range sessions {
+		names = append(names, s.Name)
+	}
+	if expected := []string{"third", "second", "first"}; !slices.Equal(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+}
+
+// test `doForkSession` and `doDeleteSession`
+func TestForkAndDeleteSession(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	output := newOutputWriter()
+	ctx := context.Background()
+
+	original := session{
+		Name:     "original",
+		Model:    "model-a",
+		Messages: []api.Message{{Role: "user", Content: "hello"}},
+	}
+	if err := saveSession(original); err != nil {
+		t.Fatalf("failed to save session: %s", err)
+	}
+
+	var p params
+	p.Sessions.Session = ptr("original")
+	p.Sessions.ForkSession = ptr("forked")
+
+	// fork
+	if _, err := doForkSession(ctx, output, p); err != nil {
+		t.Fatalf("failed to fork session: %s", err)
+	}
+	if forked, exists, err := loadSession("forked"); err != nil || !exists || forked.Model != "model-a" || len(forked.Messages) != 1 {
+		t.Errorf("unexpected forked session: %+v (exists: %v, err: %v)", forked, exists, err)
+	}
+
+	// fork to an existing session
+	if _, err := doForkSession(ctx, output, p); err == nil {
+		t.Errorf("expected an error for forking to an existing session")
+	}
+
+	// fork from a non-existing session
+	p.Sessions.Session = ptr("missing")
+	p.Sessions.ForkSession = ptr("another")
+	if _, err := doForkSession(ctx, output, p); err == nil {
+		t.Errorf("expected an error for forking from a non-existing session")
+	}
+
+	// fork to an invalid name
+	p.Sessions.Session = ptr("original")
+	p.Sessions.ForkSession = ptr("../escaped")
+	if _, err := doForkSession(ctx, output, p); err == nil {
+		t.Errorf("expected an error for forking to an invalid name")
+	}
+
+	// delete
+	p.Sessions.DeleteSession = ptr("forked")
+	if _, err := doDeleteSession(ctx, output, p); err != nil {
+		t.Fatalf("failed to delete session: %s", err)
+	}
+	if _, exists, _ := loadSession("forked"); exists {
+		t.Errorf("expected the session to be deleted")
+	}
+	if _, exists, _ := loadSession("original"); !exists {
+		t.Errorf("expected the original session not to be deleted")
+	}
+
+	// delete a non-existing session, or an invalid name
+	for _, name := range []string{"forked", "../original"} {
+		p.Sessions.DeleteSession = ptr(name)
+		if _, err := doDeleteSession(ctx, output, p); err == nil {
+			t.Errorf("expected an error for deleting session '%s'", name)
+		}
+	}
+}
+
+// test `resumeSessionAndApplyProfile` for the order of parameters, session, and profile
+func TestResumeSessionAndApplyProfile(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	output := newOutputWriter()
+	conf := config{
+		Profiles: map[string]profile{
+			"work": {
+				Model:             ptr("profile-model"),
+				SystemInstruction: ptr("profile instruction"),
+				Temperature:       ptr(float32(0.2)),
+			},
+		},
+	}
+
+	if err := saveSession(session{
+		Name:  "resumed",
+		Model: "session-model",
+		Messages: []api.Message{
+			{Role: "system", Content: "session instruction"},
+			{Role: "user", Content: "hello"},
+		},
+	}); err != nil {
+		t.Fatalf("failed to save session: %s", err)
+	}
+
+	newParams := func() params {
+		var p params
+		p.Generation.Prompt = ptr("continue")
+		p.Sessions.Session = ptr("resumed")
+		p.Profile = ptr("work")
+		return p
+	}
+
+	// session over profile
+	p := newParams()
+	sess, err := resumeSessionAndApplyProfile(output, conf, &p)
+	if err != nil || sess == nil || len(sess.history()) != 1 {
+		t.Fatalf("unexpected resumed session: %+v (err: %v)", sess, err)
+	}
+	if *p.Model != "session-model" || *p.Generation.DetailedOptions.SystemInstruction != "session instruction" {
+		t.Errorf("expected the session to take precedence over the profile, got model: '%s', system instruction: '%s'", *p.Model, *p.Generation.DetailedOptions.SystemInstruction)
+	}
+	if options, err := generationOptionsFor(conf, p, *p.Model); err != nil || options["temperature"] != float32(0.2) {
+		t.Errorf("expected the profile to fill the remaining parameters, got %v (err: %v)", options, err)
+	}
+
+	// parameters over session
+	p = newParams()
+	p.Model = ptr("flag-model")
+	if _, err := resumeSessionAndApplyProfile(output, conf, &p); err != nil || *p.Model != "flag-model" {
+		t.Errorf("expected the parameter to take precedence over the session, got '%s' (err: %v)", *p.Model, err)
+	}
+
+	// new session: profile applies
+	p = newParams()
+	p.Sessions.Session = ptr("new")
+	if sess, err := resumeSessionAndApplyProfile(output, conf, &p); err != nil || sess == nil || len(sess.Messages) != 0 {
+		t.Errorf("unexpected new session: %+v (err: %v)", sess, err)
+	} else if *p.Model != "profile-model" || *p.Generation.DetailedOptions.SystemInstruction != "profile instruction" {
+		t.Errorf("expected the profile to be applied, got model: '%s'", *p.Model)
+	}
+
+	// no prompt: session is not resumed
+	p = newParams()
+	p.Generation.Prompt = nil
+	if sess, err := resumeSessionAndApplyProfile(output, conf, &p); err != nil || sess != nil {
+		t.Errorf("expected no session to be resumed without prompt, got %+v (err: %v)", sess, err)
+	}
+
+	// session with tasks which don't support it
+	for name, modify := range map[string]func(p *params){
+		"compare":    func(p *params) { p.Compare.Models = ptr("model-a,model-b") },
+		"embeddings": func(p *params) { p.Embeddings.GenerateEmbeddings = true },
+		"images":     func(p *params) { p.Generation.Image.WithImages = true },
+	} {
+		p = newParams()
+		p.Sessions.Session = ptr("saved")
+		modify(&p)
+		if _, err := resumeSessionAndApplyProfile(output, conf, &p); err == nil {
+			t.Errorf("expected an error for a session with %s", name)
+		}
+	}
+
+	// invalid session name, or unknown profile
+	p = newParams()
+	p.Sessions.Session = ptr("../escaped")
+	if _, err := resumeSessionAndApplyProfile(output, conf, &p); err == nil {
+		t.Errorf("expected an error for an invalid session name")
+	}
+	p = newParams()
+	p.Profile = ptr("unknown")
+	if _, err := resumeSessionAndApplyProfile(output, conf, &p); err == nil {
+		t.Errorf("expected an error for an unknown profile")
+	}
+}
@@ -0,0 +1,416 @@
+// toolcalls.go
+//
+// things for executing tool calls (sequentially or in parallel)
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/fatih/color"
+	"github.com/ollama/ollama/api"
+)
+
+const (
+	defaultToolCallWorkers = 1 // NOTE: sequential
+)
+
+// a tool call planned to be executed
+type plannedToolCall struct {
+	call api.ToolCall
+	fn   string // function call for printing (eg. `fn_name({"arg": "value"})`)
+
+	run    func(ctx context.Context) (string, error) // nil if it should not be run
+	target string                                    // what is executed, for printing (eg. `callback '/path/to/callback' for function 'fn_name(...)'`)
+	isMCP  bool
+	status string
+
+	result string
+	err    error
+}
+
+// toolCallWorkersFrom returns the number of workers for tool calls from params and config.
+//
+// (params take precedence over config)
+func toolCallWorkersFrom(conf config, p params) int {
+	workers := defaultToolCallWorkers
+	if conf.ToolCallWorkers > 0 {
+		workers = conf.ToolCallWorkers
+	}
+	if p.Tools.ToolCallWorkers != nil && *p.Tools.ToolCallWorkers > 0 {
+		workers = *p.Tools.ToolCallWorkers
+	}
+	return workers
+}
+
+// executeToolCalls executes given tool calls, and returns their results as messages (in the original order).
+//
+// Confirmations (and inputs from stdin) are asked one by one in the original order,
+// then the confirmed tool calls are executed with `workers` number of workers.
+//
+// A result is returned for every tool call (even for skipped, not called, unhandled, or failed ones),
+// so that tool calls in the history are always paired with their results.
+// `handled` is false if none of them had a callback (so there is nothing to recurse on).
+func executeToolCalls(
+	ctx context.Context,
+	conf config,
+	output *outputWriter,
+	calls []api.ToolCall,
+	previousGenerations []api.Message,
+	showCallbackResults, recurseOnCallbackResults, forceCallDestructiveTools bool,
+	workers int,
+	localToolCallbacks map[string]string,
+	localToolCallbacksConfirm map[string]bool,
+	mcpConnsAndTools mcpConnectionsAndTools,
+	loop *agentLoop,
+	vbs []bool,
+) (results []api.Message, handled bool, err error) {
+	// plan tool calls (check limits, and ask for confirmations in order)
+	planned := []*plannedToolCall{}
+	for _, call := range calls {
+		p, err := planToolCall(
+			ctx,
+			conf,
+			output,
+			call,
+			previousGenerations,
+			forceCallDestructiveTools,
+			localToolCallbacks,
+			localToolCallbacksConfirm,
+			mcpConnsAndTools,
+			loop,
+			vbs,
+		)
+		if err != nil {
+			return nil, false, err
+		}
+		planned = append(planned, p)
+	}
+
+	// execute tool calls
+	runToolCalls(ctx, output, planned, workers, vbs)
+
+	// handle results in the original order
+	for i, p := range planned {
+		if p.err != nil {
+			loop.record(p.fn, toolCallStatusFailed)
+
+			// NOTE: pair the failed and remaining tool calls with results too
+			results = appendToolResultToPastGenerations(
+				results,
+				p.call,
+				fmt.Sprintf(`Function '%s' failed: %s.`, p.fn, p.err),
+			)
+			for _, remaining := range planned[i+1:] {
+				results = appendToolResultToPastGenerations(
+					results,
+					remaining.call,
+					fmt.Sprintf(`Function '%s' was not called: a previous function call failed.`, remaining.fn),
+				)
+			}
+
+			if p.isMCP {
+				return results, true, fmt.Errorf("failed to call MCP tool: %w", p.err)
+			}
+			return results, true, fmt.Errorf("tool callback failed: %s", p.err)
+		}
+
+		if p.status == toolCallStatusCalled {
+			// warn that there are ignored tool callbacks
+			if !p.isMCP && !recurseOnCallbackResults {
+				output.warn(
+					"Not recursing, ignoring the result of '%s'.",
+					p.fn,
+				)
+			}
+
+			// print the result of execution
+			if showCallbackResults ||
+				verboseLevel(vbs) >= verboseMinimum {
+				if p.isMCP {
+					output.printColored(
+						color.FgHiCyan,
+						"Tool call result of '%s':\n%s\n",
+						p.fn,
+						p.result,
+					)
+				} else {
+					output.printColored(
+						color.FgHiCyan,
+						"%s\n",
+						p.result,
+					)
+				}
+			}
+		}
+		loop.record(p.fn, p.status)
+
+		switch p.status {
+		case toolCallStatusCalled:
+			output.emit(outputEvent{
+				Type:   eventToolResult,
+				Name:   p.call.Function.Name,
+				Result: ptr(p.result),
+			})
+		default:
+			output.emit(outputEvent{
+				Type:   eventToolSkipped,
+				Name:   p.call.Function.Name,
+				Status: p.status,
+				Reason: p.result,
+			})
+		}
+
+		// append function call result
+		results = appendToolResultToPastGenerations(
+			results,
+			p.call,
+			p.result,
+		)
+		if p.status != toolCallStatusUnhandled {
+			handled = true
+		}
+	}
+
+	return results, handled, nil
+}
+
+// planToolCall checks limits and asks for confirmation of given tool call,
+// and returns a planned tool call to be executed.
+func planToolCall(
+	ctx context.Context,
+	conf config,
+	output *outputWriter,
+	call api.ToolCall,
+	previousGenerations []api.Message,
+	forceCallDestructiveTools bool,
+	localToolCallbacks map[string]string,
+	localToolCallbacksConfirm map[string]bool,
+	mcpConnsAndTools mcpConnectionsAndTools,
+	loop *agentLoop,
+	vbs []bool,
+) (planned *plannedToolCall, err error) {
+	output.verbose(
+		verboseMedium,
+		vbs,
+		"calling callback for tool call: %s",
+		call.Function.Name,
+	)
+
+	planned = &plannedToolCall{
+		call: call,
+		fn: fmt.Sprintf(
+			"%s(%s)",
+			call.Function.Name,
+			prettify(call.Function.Arguments, true),
+		),
+	}
+	fn := planned.fn
+
+	output.emit(outputEvent{
+		Type:      eventToolCall,
+		Name:      call.Function.Name,
+		Arguments: call.Function.Arguments,
+	})
+
+	// check limits of agent loop (calls are counted only when they are run)
+	_, isLocal := localToolCallbacks[call.Function.Name]
+	_, _, _, _, isMCP := mcpToolFrom(mcpConnsAndTools, call.Function.Name)
+	if (isLocal || isMCP) && !loop.allowCall(call.Function.Name) {
+		planned.status = toolCallStatusNotCalled
+		planned.result = fmt.Sprintf(
+			`Function '%s' was not called: %s.`,
+			fn,
+			loop.stopReason,
+		)
+
+		return planned, nil
+	}
+
+	if callbackPath, exists := localToolCallbacks[call.Function.Name]; exists {
+		// with local tools,
+		fnCallback, okToRun := checkCallbackPath(
+			conf,
+			output,
+			callbackPath,
+			localToolCallbacksConfirm,
+			forceCallDestructiveTools,
+			call.Function,
+		)
+
+		if okToRun {
+			loop.countCall(call.Function.Name)
+
+			planned.status = toolCallStatusCalled
+			planned.target = fmt.Sprintf("callback '%s' for function '%s'", callbackPath, fn)
+
+			if callbackPath == fnCallbackStdin {
+				// NOTE: inputs from stdin should be read in order, so run it now
+				printToolCallExecution(output, planned, vbs)
+
+				planned.result, planned.err = fnCallback(ctx)
+			} else {
+				planned.run = fnCallback
+			}
+		} else {
+			output.printColored(
+				color.FgHiWhite,
+				"Skipped execution of callback '%s' for function '%s'.\n",
+				callbackPath,
+				fn,
+			)
+
+			// function call result (not called)
+			planned.status = toolCallStatusSkipped
+			planned.result = fmt.Sprintf(
+				`User chose not to call function '%s'.`,
+				fn,
+			)
+		}
+	} else if serverKey, serverType, mc, tool, exists := mcpToolFrom(
+		mcpConnsAndTools,
+		call.Function.Name,
+	); exists {
+		planned.isMCP = true
+
+		// NOTE: avoid infinite loops
+		if toolCallRepeated(previousGenerations, call) {
+			return nil, fmt.Errorf("possible infinite loop detected: '%s'", fn)
+		}
+
+		okToRun := false
+
+		// check if matched MCP tool requires confirmation
+		if tool.Annotations != nil &&
+			tool.Annotations.DestructiveHint != nil &&
+			*tool.Annotations.DestructiveHint &&
+			!forceCallDestructiveTools {
+			okToRun = confirm(fmt.Sprintf(
+				"May I call tool '%s' from '%s' for function '%s'?",
+				call.Function.Name,
+				stripServerInfo(serverType, serverKey),
+				fn,
+			))
+		} else {
+			okToRun = true
+		}
+
+		if okToRun {
+			loop.countCall(call.Function.Name)
+
+			planned.status = toolCallStatusCalled
+			planned.target = fmt.Sprintf("MCP tool '%s' from '%s' for function '%s'", call.Function.Name, stripServerInfo(serverType, serverKey), fn)
+			planned.run = func(ctx context.Context) (string, error) {
+				res, err := fetchToolCallResult(
+					ctx,
+					mc,
+					call.Function.Name,
+					call.Function.Arguments,
+				)
+				if err != nil {
+					return "", err
+				}
+				return mcpToolResultToText(res), nil
+			}
+		} else {
+			output.printColored(
+				color.FgHiYellow,
+				"Skipped execution of MCP tool '%s' from '%s' for function '%s'.\n",
+				call.Function.Name,
+				stripServerInfo(serverType, serverKey),
+				fn,
+			)
+
+			// function call result (not called)
+			planned.status = toolCallStatusSkipped
+			planned.result = fmt.Sprintf(
+				`User chose not to call function '%s'.`,
+				fn,
+			)
+		}
+	} else {
+		// print generated content
+		// (NOTE: a result is still appended for pairing it with the tool call, but it is not recursed on)
+		output.printColored(
+			color.FgHiWhite,
+			"Generated tool call: %s\n",
+			fn,
+		)
+
+		planned.status = toolCallStatusUnhandled
+		planned.result = fmt.Sprintf(
+			`Function '%s' was not called: no callback for the function.`,
+			fn,
+		)
+	}
+
+	return planned, nil
+}
+
+// printToolCallExecution prints that given planned tool call is being executed.
+func printToolCallExecution(
+	output *outputWriter,
+	planned *plannedToolCall,
+	vbs []bool,
+) {
+	output.verbose(
+		verboseMinimum,
+		vbs,
+		"executing %s...",
+		planned.target,
+	)
+}
+
+// runToolCalls runs planned tool calls with given number of workers.
+//
+// NOTE: workers should not print anything, as `outputWriter` is not safe for concurrent use
+// (so everything is printed here, or before and after this function)
+func runToolCalls(
+	ctx context.Context,
+	output *outputWriter,
+	planned []*plannedToolCall,
+	workers int,
+	vbs []bool,
+) {
+	runnable := []*plannedToolCall{}
+	for _, p := range planned {
+		if p.run != nil {
+			runnable = append(runnable, p)
+		}
+	}
+	if len(runnable) <= 0 {
+		return
+	}
+
+	workers = max(1, min(workers, len(runnable)))
+	if workers > 1 {
+		output.verbose(
+			verboseMedium,
+			vbs,
+			"executing %d tool calls with %d workers...",
+			len(runnable),
+			workers,
+		)
+	}
+
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for _, p := range runnable {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		printToolCallExecution(output, p, vbs)
+
+		go func(p *plannedToolCall) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			p.result, p.err = p.run(ctx)
+		}(p)
+	}
+	wg.Wait()
+}
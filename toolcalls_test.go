@@ -0,0 +1,224 @@
+// toolcalls_test.go
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// test `runToolCalls` for the number of workers
+func TestRunToolCallsWorkers(t *testing.T) {
+	output := newOutputWriter()
+
+	for _, tc := range []struct {
+		workers  int
+		expected int
+	}{
+		{workers: 0, expected: 1},
+		{workers: 1, expected: 1},
+		{workers: 3, expected: 3},
+		{workers: 100, expected: 8},
+	} {
+		var running, maxRunning atomic.Int32
+
+		planned := []*plannedToolCall{}
+		for i := range 8 {
+			planned = append(planned, &plannedToolCall{
+				run: func(_ context.Context) (string, error) {
+					n := running.Add(1)
+					defer running.Add(-1)
+					for {
+						if m := maxRunning.Load(); n <= m || maxRunning.CompareAndSwap(m, n) {
+							break
+						}
+					}
+
+					// (later ones finish earlier)
+					time.Sleep(time.Duration(8-i) * 10 * time.Millisecond)
+
+					return fmt.Sprintf("result %d", i), nil
+				},
+			})
+		}
+		planned = append(planned, &plannedToolCall{result: "not run"}) // (should not be run)
+
+		runToolCalls(context.Background(), output, planned, tc.workers, nil)
+
+		if m := int(maxRunning.Load()); m != tc.expected {
+			t.Errorf("expected %d worker(s) running at most with %d workers, got %d", tc.expected, tc.workers, m)
+		}
+		for i, p := range planned[:8] {
+			if expected := fmt.Sprintf("result %d", i); p.result != expected || p.err != nil {
+				t.Errorf("expected '%s', got '%s' (err: %v)", expected, p.result, p.err)
+			}
+		}
+		if last := planned[8]; last.result != "not run" {
+			t.Errorf("expected a tool call without `run` not to be run, got '%s'", last.result)
+		}
+	}
+}
+
+// test `executeToolCalls` for the order of results, and for asking confirmations and inputs sequentially
+func TestExecuteToolCalls(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "callback.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho executed\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// replace stdin and stderr for answering prompts
+	stdinR, stdinW, _ := os.Pipe()
+	stderrR, stderrW, _ := os.Pipe()
+	stdin, stderr := os.Stdin, os.Stderr
+	os.Stdin, os.Stderr = stdinR, stderrW
+	t.Cleanup(func() {
+		os.Stdin, os.Stderr = stdin, stderr
+		_ = stdinW.Close()
+		_ = stderrW.Close()
+	})
+
+	// answer prompts one by one, after each prompt is printed
+	prompts := make(chan string, 10)
+	go func() {
+		defer close(prompts)
+
+		reader := bufio.NewReader(stderrR)
+		numAnswers := 0
+		for {
+			prompt, err := reader.ReadString(':')
+			if err != nil {
+				return
+			}
+			prompts <- strings.TrimSpace(prompt)
+
+			if strings.HasPrefix(strings.TrimSpace(prompt), "May I") {
+				_, _ = stdinW.WriteString("y\n")
+			} else {
+				numAnswers++
+				_, _ = fmt.Fprintf(stdinW, "answer %d\n", numAnswers)
+			}
+		}
+	}()
+
+	calls := []api.ToolCall{}
+	for _, name := range []string{"first", "ask1", "run", "ask2", "last", "unknown"} {
+		calls = append(calls, api.ToolCall{Function: api.ToolCallFunction{Name: name}})
+	}
+
+	results, handled, err := executeToolCalls(
+		context.Background(),
+		config{},
+		newOutputWriter(),
+		calls,
+		nil,
+		false, true, false,
+		4,
+		map[string]string{
+			"first": fnCallbackFormatter + "=FIRST",
+			"ask1":  fnCallbackStdin,
+			"run":   script,
+			"ask2":  fnCallbackStdin,
+			"last":  fnCallbackFormatter + "=LAST",
+		},
+		map[string]bool{
+			"run": true,
+		},
+		nil,
+		newAgentLoop(agentLoopLimits{}),
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("failed to execute tool calls: %s", err)
+	}
+
+	if !handled {
+		t.Errorf("expected tool calls to be handled")
+	}
+
+	// results in the original order (with the unhandled one too)
+	contents := []string{}
+	for _, result := range results {
+		contents = append(contents, result.ToolName+"="+result.Content)
+	}
+	if expected := []string{
+		"first=FIRST",
+		"ask1=answer 1\n",
+		"run=executed\n",
+		"ask2=answer 2\n",
+		"last=LAST",
+		"unknown=Function 'unknown({})' was not called: no callback for the function.",
+	}; !slices.Equal(contents, expected) {
+		t.Errorf("expected %q, got %q", expected, contents)
+	}
+
+	// prompts in the original order
+	_ = stderrW.Close()
+	asked := []string{}
+	for prompt := range prompts {
+		asked = append(asked, prompt)
+	}
+	if len(asked) != 3 ||
+		!strings.Contains(asked[0], "'ask1(") ||
+		!strings.Contains(asked[1], "May I execute callback") ||
+		!strings.Contains(asked[2], "'ask2(") {
+		t.Errorf("unexpected prompts: %q", asked)
+	}
+}
+
+// test `executeToolCalls` for killing callbacks which run longer than the round timeout
+func TestExecuteToolCallsRoundTimeout(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "slow.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\nsleep 10\necho finished\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	loop := newAgentLoop(agentLoopLimits{RoundTimeout: 200 * time.Millisecond})
+	roundCtx, cancel := context.WithTimeout(context.Background(), loop.limits.RoundTimeout)
+	defer cancel()
+
+	started := time.Now()
+	results, _, err := executeToolCalls(
+		roundCtx,
+		config{},
+		newOutputWriter(),
+		[]api.ToolCall{
+			{Function: api.ToolCallFunction{Name: "slow"}},
+			{Function: api.ToolCallFunction{Name: "unknown"}},
+		},
+		nil,
+		false, true, false,
+		1,
+		map[string]string{
+			"slow": script,
+		},
+		nil,
+		nil,
+		loop,
+		nil,
+	)
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("expected the callback to be killed after the round timeout, but it took %s", elapsed)
+	}
+	if err == nil {
+		t.Errorf("expected an error from the killed callback")
+	}
+
+	// failed and remaining tool calls are still paired with results
+	if len(results) != 2 ||
+		results[0].ToolName != "slow" || !strings.Contains(results[0].Content, "failed") ||
+		results[1].ToolName != "unknown" || !strings.Contains(results[1].Content, "was not called") {
+		t.Errorf("expected results of all tool calls, got %+v", results)
+	}
+}